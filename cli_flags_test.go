@@ -6,7 +6,7 @@ import (
 )
 
 func TestCLIListProcessedFlag(t *testing.T) {
-	cmd := exec.Command("go", "run", "main.go", "--list-processed")
+	cmd := exec.Command("go", "run", ".", "--list-processed")
 	out, err := cmd.CombinedOutput()
 	if err != nil && cmd.ProcessState.ExitCode() != 0 {
 		// Pode falhar se não houver DB/config, mas deve mostrar mensagem amigável
@@ -17,7 +17,7 @@ func TestCLIListProcessedFlag(t *testing.T) {
 }
 
 func TestCLITenantFlag(t *testing.T) {
-	cmd := exec.Command("go", "run", "main.go", "--list-processed", "--tenant", "tenantA")
+	cmd := exec.Command("go", "run", ".", "--list-processed", "--tenant", "tenantA")
 	out, err := cmd.CombinedOutput()
 	if err != nil && cmd.ProcessState.ExitCode() != 0 {
 		if len(out) == 0 {
@@ -27,7 +27,7 @@ func TestCLITenantFlag(t *testing.T) {
 }
 
 func TestCLIKeepsourceFlag(t *testing.T) {
-	cmd := exec.Command("go", "run", "main.go", "--keep-source", "--list-processed")
+	cmd := exec.Command("go", "run", ".", "--keep-source", "--list-processed")
 	out, err := cmd.CombinedOutput()
 	if err != nil && cmd.ProcessState.ExitCode() != 0 {
 		if len(out) == 0 {
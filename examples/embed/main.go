@@ -0,0 +1,61 @@
+// Exemplo de uso do filewatcher como biblioteca: um tenant com um destino
+// local e um destino custom entregue por código, e um processador que recusa
+// arquivos vazios.
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/thiagozs/go-filewatcher/pkg/sink"
+	"github.com/thiagozs/go-filewatcher/pkg/store"
+	"github.com/thiagozs/go-filewatcher/pkg/watcher"
+)
+
+func main() {
+	cfg := &watcher.Config{Tenants: []watcher.TenantConfig{{
+		Name:     "notas",
+		WatchDir: "/tmp/notas/in",
+		Destinations: []watcher.DestinationConfig{
+			{Name: "archive", Path: "/tmp/notas/archive"},
+			{Name: "audit", Type: "custom"},
+		},
+	}}}
+
+	db, err := store.Open(store.DefaultPath)
+	if err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	audit := sink.SinkFunc(func(ctx context.Context, f sink.File) error {
+		log.Printf("[audit] %s (%d bytes) from tenant %s", f.RelPath, f.Info.Size(), f.Tenant)
+		f.Record(sink.Receipt{Location: "audit://" + f.RelPath, Method: "log"})
+		return nil
+	})
+	rejectEmpty := sink.ProcessorFunc(func(ctx context.Context, f sink.File, next sink.Sink) error {
+		if f.Info.Size() == 0 {
+			return errors.New("empty file")
+		}
+		return next.Deliver(ctx, f)
+	})
+
+	w, err := watcher.New(cfg, db,
+		watcher.WithSink("notas", "audit", audit),
+		watcher.WithProcessors(rejectEmpty),
+	)
+	if err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+	defer w.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	w.Sync()
+	w.Run(ctx)
+}
@@ -8,6 +8,8 @@ require (
 	github.com/dustin/go-humanize v1.0.1 // indirect
 	github.com/fatih/color v1.15.0 // indirect
 	github.com/google/uuid v1.6.0 // indirect
+	github.com/klauspost/cpuid/v2 v2.0.9 // indirect
+	github.com/kr/fs v0.1.0 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
 	github.com/mattn/go-runewidth v0.0.16 // indirect
@@ -23,8 +25,14 @@ require (
 )
 
 require (
+	filippo.io/age v1.2.1
+	github.com/cespare/xxhash/v2 v2.3.0
+	github.com/klauspost/compress v1.18.0
 	github.com/olekukonko/tablewriter v1.0.7
-	golang.org/x/sys v0.33.0 // indirect
+	github.com/pkg/sftp v1.13.9
+	golang.org/x/crypto v0.39.0
+	golang.org/x/sys v0.33.0
 	gopkg.in/yaml.v2 v2.4.0
+	lukechampine.com/blake3 v1.4.1
 	modernc.org/sqlite v1.38.0
 )
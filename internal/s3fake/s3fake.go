@@ -0,0 +1,199 @@
+// Package s3fake é um servidor S3 em memória para os testes: aceita PUT,
+// multipart, DELETE e GET de objetos com endereçamento path-style, confere o
+// Content-MD5 e o x-amz-content-sha256 como o S3 e exige uma assinatura
+// SigV4 com a chave de acesso esperada.
+package s3fake
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// AccessKey é a chave aceita pelo servidor.
+const AccessKey = "FAKEACCESSKEY"
+
+// Server guarda os objetos de todos os buckets em memória.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	objects  map[string][]byte // bucket/chave -> conteúdo
+	etags    map[string]string
+	uploads  map[string]map[int][]byte // uploadId -> partes
+	nextID   int
+	requests []string
+
+	// BadETag faz o servidor devolver um ETag que não confere com o conteúdo.
+	BadETag bool
+}
+
+// New inicia o servidor; feche com Close.
+func New() *Server {
+	s := &Server{
+		objects: make(map[string][]byte),
+		etags:   make(map[string]string),
+		uploads: make(map[string]map[int][]byte),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Object retorna o conteúdo de bucket/key.
+func (s *Server) Object(bucket, key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.objects[bucket+"/"+key]
+	return data, ok
+}
+
+// Keys lista as chaves gravadas, no formato bucket/chave.
+func (s *Server) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []string
+	for k := range s.objects {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Requests lista as requisições recebidas ("MÉTODO query").
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// PendingUploads conta os uploads multipart não concluídos nem abortados.
+func (s *Server) PendingUploads() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.uploads)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential="+AccessKey+"/") {
+		writeError(w, http.StatusForbidden, "InvalidAccessKeyId", "unknown access key")
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+	sha := sha256.Sum256(body)
+	if r.Header.Get("x-amz-content-sha256") != hex.EncodeToString(sha[:]) {
+		writeError(w, http.StatusBadRequest, "XAmzContentSHA256Mismatch", "payload hash mismatch")
+		return
+	}
+	sum := md5.Sum(body)
+	if m := r.Header.Get("Content-MD5"); m != "" && m != base64.StdEncoding.EncodeToString(sum[:]) {
+		writeError(w, http.StatusBadRequest, "BadDigest", "Content-MD5 mismatch")
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	q := r.URL.Query()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.RawQuery)
+	etag := hex.EncodeToString(sum[:])
+	if s.BadETag {
+		etag = strings.Repeat("0", 32)
+	}
+	switch {
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		s.nextID++
+		id := strconv.Itoa(s.nextID)
+		s.uploads[id] = make(map[int][]byte)
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+	case r.Method == http.MethodPut && q.Has("uploadId"):
+		parts, ok := s.uploads[q.Get("uploadId")]
+		n, _ := strconv.Atoi(q.Get("partNumber"))
+		if !ok || n < 1 {
+			writeError(w, http.StatusNotFound, "NoSuchUpload", "unknown upload")
+			return
+		}
+		parts[n] = body
+		w.Header().Set("ETag", `"`+etag+`"`)
+	case r.Method == http.MethodPost && q.Has("uploadId"):
+		s.complete(w, key, q.Get("uploadId"), body)
+	case r.Method == http.MethodDelete && q.Has("uploadId"):
+		delete(s.uploads, q.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		s.objects[key], s.etags[key] = body, etag
+		w.Header().Set("ETag", `"`+etag+`"`)
+	case r.Method == http.MethodGet:
+		data, ok := s.objects[key]
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchKey", "no such key")
+			return
+		}
+		w.Header().Set("ETag", `"`+s.etags[key]+`"`)
+		w.Write(data)
+	case r.Method == http.MethodDelete:
+		delete(s.objects, key)
+		delete(s.etags, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method)
+	}
+}
+
+// complete junta as partes na ordem do CompleteMultipartUpload.
+func (s *Server) complete(w http.ResponseWriter, key, id string, body []byte) {
+	parts, ok := s.uploads[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchUpload", "unknown upload")
+		return
+	}
+	var req struct {
+		Parts []struct {
+			PartNumber int
+			ETag       string
+		} `xml:"Part"`
+	}
+	if err := xml.Unmarshal(body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "MalformedXML", err.Error())
+		return
+	}
+	var data, md5s []byte
+	for _, p := range req.Parts {
+		part, ok := parts[p.PartNumber]
+		sum := md5.Sum(part)
+		if !ok || strings.Trim(p.ETag, `"`) != hex.EncodeToString(sum[:]) {
+			// O S3 responde 200 com o erro no corpo
+			fmt.Fprintf(w, "<Error><Code>InvalidPart</Code><Message>part %d</Message></Error>", p.PartNumber)
+			return
+		}
+		data = append(data, part...)
+		md5s = append(md5s, sum[:]...)
+	}
+	whole := md5.Sum(md5s)
+	etag := fmt.Sprintf("%x-%d", whole, len(req.Parts))
+	if s.BadETag {
+		etag = strings.Repeat("0", 32) + "-1"
+	}
+	delete(s.uploads, id)
+	s.objects[key], s.etags[key] = bytes.Clone(data), etag
+	fmt.Fprintf(w, `<CompleteMultipartUploadResult><Key>%s</Key><ETag>"%s"</ETag></CompleteMultipartUploadResult>`, key, etag)
+}
+
+func writeError(w http.ResponseWriter, status int, code, msg string) {
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, msg)
+}
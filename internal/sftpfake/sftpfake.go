@@ -0,0 +1,166 @@
+// Package sftpfake é um servidor SSH em processo para os testes, com o
+// subsistema sftp servindo o sistema de arquivos local. Aceita apenas a chave
+// de cliente gerada junto com o servidor.
+package sftpfake
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// User é o usuário aceito pelo servidor.
+const User = "gfw"
+
+// Server escuta em 127.0.0.1 numa porta livre.
+type Server struct {
+	Addr       string
+	HostKey    ssh.PublicKey // chave do servidor, para o pinning
+	ClientKey  ssh.Signer    // chave autorizada
+	ClientPEM  []byte        // ClientKey em PEM (OpenSSH)
+	listener   net.Listener
+	config     *ssh.ServerConfig
+	mu         sync.Mutex
+	conns      map[net.Conn]bool
+	accepted   int
+	wg         sync.WaitGroup
+	closedOnce sync.Once
+}
+
+// New gera as chaves e começa a aceitar conexões; feche com Close.
+func New() (*Server, error) {
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostPriv)
+	if err != nil {
+		return nil, err
+	}
+	_, clientPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	clientSigner, err := ssh.NewSignerFromKey(clientPriv)
+	if err != nil {
+		return nil, err
+	}
+	block, err := ssh.MarshalPrivateKey(clientPriv, "")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		HostKey:   hostSigner.PublicKey(),
+		ClientKey: clientSigner,
+		ClientPEM: pem.EncodeToMemory(block),
+		conns:     make(map[net.Conn]bool),
+	}
+	authorized := string(clientSigner.PublicKey().Marshal())
+	s.config = &ssh.ServerConfig{
+		PublicKeyCallback: func(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if meta.User() == User && string(key.Marshal()) == authorized {
+				return nil, nil
+			}
+			return nil, errors.New("unauthorized")
+		},
+	}
+	s.config.AddHostKey(hostSigner)
+	s.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s.Addr = s.listener.Addr().String()
+	s.wg.Add(1)
+	go s.accept()
+	return s, nil
+}
+
+// Accepted conta as conexões TCP aceitas.
+func (s *Server) Accepted() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.accepted
+}
+
+// DropConnections derruba as conexões abertas, como um servidor que expira
+// sessões ociosas.
+func (s *Server) DropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.conns {
+		c.Close()
+	}
+}
+
+// Close para de aceitar conexões e derruba as abertas.
+func (s *Server) Close() {
+	s.closedOnce.Do(func() {
+		s.listener.Close()
+		s.DropConnections()
+		s.wg.Wait()
+	})
+}
+
+func (s *Server) accept() {
+	defer s.wg.Done()
+	for {
+		nc, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[nc] = true
+		s.accepted++
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.serve(nc)
+			s.mu.Lock()
+			delete(s.conns, nc)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+func (s *Server) serve(nc net.Conn) {
+	defer nc.Close()
+	_, chans, reqs, err := ssh.NewServerConn(nc, s.config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for nch := range chans {
+		if nch.ChannelType() != "session" {
+			nch.Reject(ssh.UnknownChannelType, "only sessions")
+			continue
+		}
+		ch, requests, err := nch.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range requests {
+				ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+				if !ok {
+					continue
+				}
+				server, err := sftp.NewServer(ch)
+				if err != nil {
+					ch.Close()
+					return
+				}
+				server.Serve()
+				server.Close()
+				return
+			}
+		}()
+	}
+}
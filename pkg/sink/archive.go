@@ -0,0 +1,444 @@
+package sink
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Formatos dos pacotes gerados pelo lote.
+const (
+	ArchiveTarGz = "tar.gz"
+	ArchiveZip   = "zip"
+)
+
+// ManifestName é o nome do manifesto gravado como primeira entrada do pacote.
+const ManifestName = "MANIFEST.json"
+
+// ErrMemberNotFound indica que o pacote não contém a entrada pedida.
+var ErrMemberNotFound = errors.New("archive member not found")
+
+var (
+	// ErrUnsafeArchive indica uma entrada com caminho absoluto ou que sai do
+	// diretório de extração (zip-slip).
+	ErrUnsafeArchive = errors.New("unsafe archive entry")
+	// ErrArchiveLimit indica um pacote acima dos limites de extração.
+	ErrArchiveLimit = errors.New("archive exceeds extraction limits")
+)
+
+// DetectArchive retorna o formato do pacote pela extensão do nome (.zip,
+// .tar.gz ou .tgz), ou "" se não for um pacote.
+func DetectArchive(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return ArchiveZip
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return ArchiveTarGz
+	}
+	return ""
+}
+
+// TrimArchiveExt remove a extensão de pacote do nome, se houver.
+func TrimArchiveExt(name string) string {
+	lower := strings.ToLower(name)
+	for _, ext := range []string{".tar.gz", ".tgz", ".zip"} {
+		if strings.HasSuffix(lower, ext) {
+			return name[:len(name)-len(ext)]
+		}
+	}
+	return name
+}
+
+// ArchiveExt retorna a extensão do formato (".tar.gz", ".zip").
+func ArchiveExt(format string) string {
+	switch format {
+	case ArchiveTarGz:
+		return ".tar.gz"
+	case ArchiveZip:
+		return ".zip"
+	}
+	return ""
+}
+
+// ArchiveEntry é um arquivo do disco (Path) gravado no pacote como Name, com
+// barras como separador.
+type ArchiveEntry struct {
+	Name string
+	Path string
+}
+
+// WriteArchive grava em dst, de forma atômica, um pacote com o manifesto
+// seguido das entradas. O conteúdo é lido em streaming, um arquivo por vez.
+// Nenhuma entrada pode se chamar ManifestName.
+func WriteArchive(dst, format string, manifest []byte, entries []ArchiveEntry) error {
+	for _, e := range entries {
+		if path.Clean(e.Name) == ManifestName {
+			return fmt.Errorf("%s: name reserved for the archive manifest", e.Path)
+		}
+	}
+	out, err := CreateAtomic(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Abort()
+	switch format {
+	case ArchiveTarGz:
+		err = writeTarGz(out, manifest, entries)
+	case ArchiveZip:
+		err = writeZip(out, manifest, entries)
+	default:
+		err = fmt.Errorf("unknown archive format %q", format)
+	}
+	if err != nil {
+		return err
+	}
+	return out.Commit()
+}
+
+func writeTarGz(w io.Writer, manifest []byte, entries []ArchiveEntry) error {
+	zw := gzip.NewWriter(w)
+	tw := tar.NewWriter(zw)
+	now := time.Now()
+	hdr := &tar.Header{Name: ManifestName, Mode: 0644, Size: int64(len(manifest)), ModTime: now, Typeflag: tar.TypeReg}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if _, err := tw.Write(manifest); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := addTarEntry(tw, e); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func addTarEntry(tw *tar.Writer, e ArchiveEntry) error {
+	f, err := os.Open(e.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr, err := tar.FileInfoHeader(fi, "")
+	if err != nil {
+		return err
+	}
+	hdr.Name = e.Name
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if _, err := io.Copy(tw, f); err != nil {
+		return fmt.Errorf("%s: %w", e.Path, err)
+	}
+	return nil
+}
+
+func writeZip(w io.Writer, manifest []byte, entries []ArchiveEntry) error {
+	zw := zip.NewWriter(w)
+	mw, err := zw.CreateHeader(&zip.FileHeader{Name: ManifestName, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	if _, err := mw.Write(manifest); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := addZipEntry(zw, e); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func addZipEntry(zw *zip.Writer, e ArchiveEntry) error {
+	f, err := os.Open(e.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr, err := zip.FileInfoHeader(fi)
+	if err != nil {
+		return err
+	}
+	hdr.Name, hdr.Method = e.Name, zip.Deflate
+	ew, err := zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(ew, f); err != nil {
+		return fmt.Errorf("%s: %w", e.Path, err)
+	}
+	return nil
+}
+
+// ExtractMember escreve em w o conteúdo da entrada member do pacote e
+// retorna o checksum desse conteúdo.
+func ExtractMember(w io.Writer, archive, format, member, algo string) (string, error) {
+	h, err := NewHasher(algo)
+	if err != nil {
+		return "", err
+	}
+	w = io.MultiWriter(w, h)
+	switch format {
+	case ArchiveTarGz:
+		err = extractTarMember(w, archive, member)
+	case ArchiveZip:
+		err = extractZipMember(w, archive, member)
+	default:
+		err = fmt.Errorf("unknown archive format %q", format)
+	}
+	if err != nil {
+		return "", err
+	}
+	return formatChecksum(algo, h), nil
+}
+
+func extractTarMember(w io.Writer, archive, member string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", archive, err)
+	}
+	defer zr.Close()
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return fmt.Errorf("%s: %s: %w", archive, member, ErrMemberNotFound)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", archive, err)
+		}
+		if path.Clean(hdr.Name) != member || hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if _, err := io.Copy(w, tr); err != nil {
+			return fmt.Errorf("%s: %w", archive, err)
+		}
+		return nil
+	}
+}
+
+func extractZipMember(w io.Writer, archive, member string) error {
+	zr, err := zip.OpenReader(archive)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	for _, zf := range zr.File {
+		if path.Clean(zf.Name) != member || zf.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return fmt.Errorf("%s: %w", archive, err)
+		}
+		defer rc.Close()
+		if _, err := io.Copy(w, rc); err != nil {
+			return fmt.Errorf("%s: %w", archive, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("%s: %s: %w", archive, member, ErrMemberNotFound)
+}
+
+// ExtractMemberFile grava em dst, de forma atômica, a entrada member do
+// pacote (ver ExtractMember).
+func ExtractMemberFile(archive, format, member, dst, algo string) (string, error) {
+	out, err := CreateAtomic(dst)
+	if err != nil {
+		return "", err
+	}
+	defer out.Abort()
+	sum, err := ExtractMember(out, archive, format, member, algo)
+	if err != nil {
+		return "", err
+	}
+	if err := out.Commit(); err != nil {
+		return "", err
+	}
+	return sum, nil
+}
+
+// ExtractLimits protege a extração contra zip bombs. Zero desativa o limite.
+type ExtractLimits struct {
+	MaxEntries int   // entradas do pacote, incluindo diretórios
+	MaxSize    int64 // soma dos bytes descompactados
+}
+
+// ExtractArchive extrai os arquivos regulares do pacote em dir e retorna os
+// nomes (com barras) na ordem do pacote. Entradas fora de dir são recusadas
+// com ErrUnsafeArchive e pacotes acima dos limites com ErrArchiveLimit;
+// links simbólicos e arquivos especiais são ignorados. O tamanho é contado
+// pelos bytes lidos, não pelo cabeçalho.
+func ExtractArchive(archive, format, dir string, limits ExtractLimits) ([]string, error) {
+	x := &extractor{dir: dir, limits: limits, seen: make(map[string]bool)}
+	var err error
+	switch format {
+	case ArchiveTarGz:
+		err = x.tarGz(archive)
+	case ArchiveZip:
+		err = x.zip(archive)
+	default:
+		err = fmt.Errorf("unknown archive format %q", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", archive, err)
+	}
+	return x.names, nil
+}
+
+type extractor struct {
+	dir     string
+	limits  ExtractLimits
+	entries int
+	size    int64
+	names   []string
+	seen    map[string]bool
+}
+
+func (x *extractor) tarGz(archive string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := x.entry(hdr.Name, hdr.Typeflag == tar.TypeDir, hdr.Typeflag == tar.TypeReg, tr); err != nil {
+			return err
+		}
+	}
+}
+
+func (x *extractor) zip(archive string) error {
+	zr, err := zip.OpenReader(archive)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	// O diretório central já diz quantas entradas há
+	if x.limits.MaxEntries > 0 && len(zr.File) > x.limits.MaxEntries {
+		return fmt.Errorf("%d entries, limit %d: %w", len(zr.File), x.limits.MaxEntries, ErrArchiveLimit)
+	}
+	for _, zf := range zr.File {
+		mode := zf.Mode()
+		if err := x.zipEntry(zf, mode.IsDir(), mode.IsRegular()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (x *extractor) zipEntry(zf *zip.File, isDir, isRegular bool) error {
+	if !isRegular {
+		return x.entry(zf.Name, isDir, false, nil)
+	}
+	rc, err := zf.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return x.entry(zf.Name, false, true, rc)
+}
+
+// entry valida o caminho e grava uma entrada do pacote.
+func (x *extractor) entry(name string, isDir, isRegular bool, r io.Reader) error {
+	x.entries++
+	if x.limits.MaxEntries > 0 && x.entries > x.limits.MaxEntries {
+		return fmt.Errorf("more than %d entries: %w", x.limits.MaxEntries, ErrArchiveLimit)
+	}
+	// A raiz do próprio pacote (ex.: "./" de tar czf x.tgz -C dir .)
+	if isDir && path.Clean(strings.ReplaceAll(name, "\\", "/")) == "." {
+		return nil
+	}
+	clean, err := safeMemberName(name)
+	if err != nil {
+		return err
+	}
+	dst := filepath.Join(x.dir, filepath.FromSlash(clean))
+	if isDir {
+		return os.MkdirAll(dst, 0755)
+	}
+	if !isRegular {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	var budget int64 = -1
+	if x.limits.MaxSize > 0 {
+		budget = x.limits.MaxSize - x.size
+		r = io.LimitReader(r, budget+1)
+	}
+	n, err := io.Copy(out, r)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	x.size += n
+	if budget >= 0 && n > budget {
+		return fmt.Errorf("more than %d bytes uncompressed: %w", x.limits.MaxSize, ErrArchiveLimit)
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	// Entradas repetidas (possíveis no tar) ficam com o último conteúdo
+	if !x.seen[clean] {
+		x.seen[clean] = true
+		x.names = append(x.names, clean)
+	}
+	return nil
+}
+
+// safeMemberName normaliza o nome da entrada e recusa caminhos absolutos ou
+// que escapam do diretório de extração.
+func safeMemberName(name string) (string, error) {
+	clean := path.Clean(strings.ReplaceAll(name, "\\", "/"))
+	if clean == "." || clean == ".." || strings.HasPrefix(clean, "../") || path.IsAbs(clean) ||
+		filepath.IsAbs(filepath.FromSlash(clean)) || filepath.VolumeName(filepath.FromSlash(clean)) != "" {
+		return "", fmt.Errorf("%q: %w", name, ErrUnsafeArchive)
+	}
+	return clean, nil
+}
@@ -0,0 +1,209 @@
+package sink
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestWriteArchive(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{"a.csv": "1;2;3\n", "sub/b.txt": "conteudo b"}
+	var entries []ArchiveEntry
+	for _, name := range []string{"a.csv", "sub/b.txt"} {
+		p := filepath.Join(dir, "staged", filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(p), 0755)
+		os.WriteFile(p, []byte(files[name]), 0644)
+		entries = append(entries, ArchiveEntry{Name: name, Path: p})
+	}
+	manifest := []byte(`{"files":2}`)
+
+	for _, format := range []string{ArchiveTarGz, ArchiveZip} {
+		dst := filepath.Join(dir, "lote"+ArchiveExt(format))
+		if err := WriteArchive(dst, format, manifest, entries); err != nil {
+			t.Fatalf("%s: erro ao gravar pacote: %v", format, err)
+		}
+		if names := archiveNames(t, dst, format); len(names) != 3 || names[0] != ManifestName {
+			t.Errorf("%s: entradas inesperadas: %v", format, names)
+		}
+		out := filepath.Join(dir, "out-"+format, "b.txt")
+		sum, err := ExtractMemberFile(dst, format, "sub/b.txt", out, "")
+		if err != nil {
+			t.Fatalf("%s: erro ao extrair: %v", format, err)
+		}
+		want, _ := FileChecksum(entries[1].Path, "")
+		if b, _ := os.ReadFile(out); string(b) != files["sub/b.txt"] || sum != want {
+			t.Errorf("%s: conteúdo extraído incorreto: %q %s", format, b, sum)
+		}
+		if _, err := ExtractMemberFile(dst, format, "nope.txt", out, ""); !errors.Is(err, ErrMemberNotFound) {
+			t.Errorf("%s: esperado ErrMemberNotFound: %v", format, err)
+		}
+	}
+	if err := WriteArchive(filepath.Join(dir, "x.rar"), "rar", manifest, entries); err == nil {
+		t.Errorf("esperado erro para formato desconhecido")
+	}
+	reserved := []ArchiveEntry{{Name: ManifestName, Path: entries[0].Path}}
+	if err := WriteArchive(filepath.Join(dir, "dup.zip"), ArchiveZip, manifest, reserved); err == nil {
+		t.Errorf("esperado erro para entrada com o nome do manifesto")
+	}
+	if left, _ := filepath.Glob(filepath.Join(dir, TempFilePrefix+"*")); len(left) != 0 {
+		t.Errorf("temporários não removidos: %v", left)
+	}
+}
+
+func archiveNames(t *testing.T, archive, format string) []string {
+	t.Helper()
+	var names []string
+	if format == ArchiveZip {
+		zr, err := zip.OpenReader(archive)
+		if err != nil {
+			t.Fatalf("erro ao abrir zip: %v", err)
+		}
+		defer zr.Close()
+		for _, f := range zr.File {
+			names = append(names, f.Name)
+		}
+		return names
+	}
+	f, err := os.Open(archive)
+	if err != nil {
+		t.Fatalf("erro ao abrir tar.gz: %v", err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("erro ao abrir gzip: %v", err)
+	}
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		names = append(names, hdr.Name)
+	}
+	return names
+}
+
+func TestExtractArchive(t *testing.T) {
+	dir := t.TempDir()
+	zipPath := filepath.Join(dir, "pacote.zip")
+	writeTestZip(t, zipPath, []string{"notas/a.csv", "notas/", "b.txt"}, []string{"1;2\n", "", "conteudo b"})
+	out := filepath.Join(dir, "out")
+	names, err := ExtractArchive(zipPath, ArchiveZip, out, ExtractLimits{MaxEntries: 10, MaxSize: 1024})
+	if err != nil {
+		t.Fatalf("erro ao extrair: %v", err)
+	}
+	if len(names) != 2 || names[0] != "notas/a.csv" || names[1] != "b.txt" {
+		t.Errorf("membros inesperados: %v", names)
+	}
+	if b, _ := os.ReadFile(filepath.Join(out, "notas", "a.csv")); string(b) != "1;2\n" {
+		t.Errorf("conteúdo extraído incorreto: %q", b)
+	}
+
+	// zip-slip: nenhuma entrada pode sair do diretório de extração
+	for _, name := range []string{"../fora.txt", "/etc/fora.txt", "a/../../fora.txt", `..\fora.txt`} {
+		evil := filepath.Join(dir, "evil.zip")
+		writeTestZip(t, evil, []string{"ok.txt", name}, []string{"ok", "fora"})
+		if _, err := ExtractArchive(evil, ArchiveZip, filepath.Join(dir, "evil"), ExtractLimits{}); !errors.Is(err, ErrUnsafeArchive) {
+			t.Errorf("%q: esperado ErrUnsafeArchive: %v", name, err)
+		}
+	}
+	if fileExistsTest(filepath.Join(dir, "fora.txt")) {
+		t.Errorf("entrada gravada fora do diretório de extração")
+	}
+
+	// Limites contra zip bombs, contados pelos bytes descompactados
+	if _, err := ExtractArchive(zipPath, ArchiveZip, filepath.Join(dir, "n"), ExtractLimits{MaxEntries: 2}); !errors.Is(err, ErrArchiveLimit) {
+		t.Errorf("esperado ErrArchiveLimit por entradas: %v", err)
+	}
+	if _, err := ExtractArchive(zipPath, ArchiveZip, filepath.Join(dir, "s"), ExtractLimits{MaxSize: 8}); !errors.Is(err, ErrArchiveLimit) {
+		t.Errorf("esperado ErrArchiveLimit por tamanho: %v", err)
+	}
+
+	// tar.gz com a mesma proteção
+	tgz := filepath.Join(dir, "pacote.tgz")
+	writeTestTarGz(t, tgz, []string{"x/y.txt", "../../fora.txt"}, []string{"y", "fora"})
+	if DetectArchive(tgz) != ArchiveTarGz || TrimArchiveExt("pacote.TGZ") != "pacote" {
+		t.Errorf("formato não detectado: %q", DetectArchive(tgz))
+	}
+	if _, err := ExtractArchive(tgz, ArchiveTarGz, filepath.Join(dir, "t"), ExtractLimits{}); !errors.Is(err, ErrUnsafeArchive) {
+		t.Errorf("tar.gz: esperado ErrUnsafeArchive: %v", err)
+	}
+}
+
+func TestExtractArchiveDotPrefix(t *testing.T) {
+	dir := t.TempDir()
+	// Pacote gerado com tar czf pacote.tgz -C dir .
+	tgz := filepath.Join(dir, "pacote.tgz")
+	names := []string{"./", "./a.csv", "./notas/", "./notas/b.txt"}
+	contents := []string{"", "1;2\n", "", "conteudo b"}
+	if runtime.GOOS != "windows" {
+		names, contents = append(names, "./10:30.csv"), append(contents, "hora")
+	}
+	writeTestTarGz(t, tgz, names, contents)
+	out := filepath.Join(dir, "out")
+	got, err := ExtractArchive(tgz, ArchiveTarGz, out, ExtractLimits{})
+	if err != nil {
+		t.Fatalf("erro ao extrair: %v", err)
+	}
+	if len(got) != len(names)-2 || got[0] != "a.csv" || got[1] != "notas/b.txt" {
+		t.Errorf("membros inesperados: %v", got)
+	}
+	if b, _ := os.ReadFile(filepath.Join(out, "notas", "b.txt")); string(b) != "conteudo b" {
+		t.Errorf("conteúdo extraído incorreto: %q", b)
+	}
+}
+
+func writeTestZip(t *testing.T, dst string, names, contents []string) {
+	t.Helper()
+	f, err := os.Create(dst)
+	if err != nil {
+		t.Fatalf("erro ao criar zip: %v", err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for i, name := range names {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("erro ao criar entrada: %v", err)
+		}
+		w.Write([]byte(contents[i]))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("erro ao fechar zip: %v", err)
+	}
+}
+
+func writeTestTarGz(t *testing.T, dst string, names, contents []string) {
+	t.Helper()
+	f, err := os.Create(dst)
+	if err != nil {
+		t.Fatalf("erro ao criar tar.gz: %v", err)
+	}
+	defer f.Close()
+	zw := gzip.NewWriter(f)
+	tw := tar.NewWriter(zw)
+	for i, name := range names {
+		// Nomes terminados em / viram entradas de diretório
+		if strings.HasSuffix(name, "/") {
+			tw.WriteHeader(&tar.Header{Name: name, Mode: 0755, Typeflag: tar.TypeDir})
+			continue
+		}
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(contents[i])), Typeflag: tar.TypeReg})
+		tw.Write([]byte(contents[i]))
+	}
+	tw.Close()
+	zw.Close()
+}
+
+func fileExistsTest(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
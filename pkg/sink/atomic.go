@@ -0,0 +1,100 @@
+package sink
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Prefixo dos temporários gravados no destino antes do rename final.
+const TempFilePrefix = ".gfw-tmp-"
+
+// AtomicFile grava em um arquivo temporário oculto no mesmo diretório do
+// destino e só o renomeia para o nome final em Commit. Consumidores do
+// DestDir nunca enxergam arquivos pela metade.
+type AtomicFile struct {
+	*os.File
+	dst  string
+	done bool
+}
+
+func CreateAtomic(dst string) (*AtomicFile, error) {
+	dir := filepath.Dir(dst)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp(dir, TempFilePrefix+filepath.Base(dst)+"-*")
+	if err != nil {
+		return nil, err
+	}
+	// CreateTemp usa 0600; mantém a permissão que os.Create daria
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return &AtomicFile{File: f, dst: dst}, nil
+}
+
+// Commit faz fsync do conteúdo, renomeia para o destino e faz fsync do
+// diretório para o rename sobreviver a uma queda.
+func (f *AtomicFile) Commit() error {
+	if err := f.Sync(); err != nil {
+		f.Abort()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		f.Abort()
+		return err
+	}
+	if err := os.Rename(f.Name(), f.dst); err != nil {
+		f.Abort()
+		return err
+	}
+	f.done = true
+	return SyncDir(filepath.Dir(f.dst))
+}
+
+// Abort descarta o temporário. Não faz nada depois de um Commit bem-sucedido.
+func (f *AtomicFile) Abort() {
+	if f.done {
+		return
+	}
+	f.done = true
+	f.Close()
+	os.Remove(f.Name())
+}
+
+func SyncDir(dir string) error {
+	// Windows não permite fsync em diretórios
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+func IsTempFile(name string) bool {
+	return strings.HasPrefix(filepath.Base(name), TempFilePrefix)
+}
+
+// CleanupTempFiles remove temporários deixados por cópias interrompidas.
+func CleanupTempFiles(dir string) {
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !IsTempFile(path) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			log.Printf("[Sync] Failed to remove leftover temp file '%s': %v", path, err)
+		} else {
+			log.Printf("[Sync] Removed leftover temp file '%s'", path)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,39 @@
+package sink
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyFileAtomicFailureKeepsDestination(t *testing.T) {
+	destDir := t.TempDir()
+	dst := filepath.Join(destDir, "relatorio.csv")
+	os.WriteFile(dst, []byte("versao antiga"), 0644)
+
+	// Ler um diretório falha no meio do io.Copy
+	if _, err := CopyFileWithChecksum(t.TempDir(), dst, ""); err == nil {
+		t.Fatalf("esperado erro ao copiar diretório")
+	}
+	data, _ := os.ReadFile(dst)
+	if string(data) != "versao antiga" {
+		t.Errorf("destino alterado por cópia com falha: %q", string(data))
+	}
+	entries, _ := os.ReadDir(destDir)
+	if len(entries) != 1 {
+		t.Errorf("temporário não removido após falha: %d entradas", len(entries))
+	}
+}
+
+func TestCopyFileAtomicNoTempLeft(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "dados.txt")
+	os.WriteFile(src, []byte("conteudo"), 0644)
+	destDir := t.TempDir()
+	if _, err := CopyFileWithChecksum(src, filepath.Join(destDir, "sub", "dados.txt"), ""); err != nil {
+		t.Fatalf("erro ao copiar: %v", err)
+	}
+	entries, _ := os.ReadDir(filepath.Join(destDir, "sub"))
+	if len(entries) != 1 || entries[0].Name() != "dados.txt" {
+		t.Errorf("esperado apenas o arquivo final no destino, veio %v", entries)
+	}
+}
@@ -0,0 +1,129 @@
+package sink
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/cespare/xxhash/v2"
+	"lukechampine.com/blake3"
+)
+
+// Algoritmos de checksum suportados. O valor gravado no banco leva o
+// algoritmo como prefixo ("sha256:<hex>") para a verificação não depender
+// da configuração atual do tenant.
+const (
+	ChecksumSHA256 = "sha256"
+	ChecksumXXHash = "xxhash"
+	ChecksumBlake3 = "blake3"
+)
+
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+func NewHasher(algo string) (hash.Hash, error) {
+	switch algo {
+	case "", ChecksumSHA256:
+		return sha256.New(), nil
+	case ChecksumXXHash:
+		return xxhash.New(), nil
+	case ChecksumBlake3:
+		return blake3.New(32, nil), nil
+	}
+	return nil, fmt.Errorf("unknown checksum algorithm %q", algo)
+}
+
+func checksumAlgo(algo string) string {
+	if algo == "" {
+		return ChecksumSHA256
+	}
+	return algo
+}
+
+func formatChecksum(algo string, h hash.Hash) string {
+	return checksumAlgo(algo) + ":" + hex.EncodeToString(h.Sum(nil))
+}
+
+// SplitChecksum separa "algo:hex"; valores sem prefixo são tratados como sha256.
+func SplitChecksum(sum string) (string, string) {
+	if algo, digest, ok := strings.Cut(sum, ":"); ok {
+		return algo, digest
+	}
+	return ChecksumSHA256, sum
+}
+
+func FileChecksum(path, algo string) (string, error) {
+	h, err := NewHasher(algo)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return formatChecksum(algo, h), nil
+}
+
+// CopyFileWithChecksum copia src para dst calculando o checksum durante o
+// streaming e, em seguida, relê o destino para confirmar que a cópia confere.
+// Em caso de divergência o destino é removido e ErrChecksumMismatch retornado.
+func CopyFileWithChecksum(src, dst, algo string) (string, error) {
+	h, err := NewHasher(algo)
+	if err != nil {
+		return "", err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	out, err := CreateAtomic(dst)
+	if err != nil {
+		return "", err
+	}
+	defer out.Abort()
+	if _, err := io.Copy(io.MultiWriter(out, h), in); err != nil {
+		return "", err
+	}
+	if err := out.Commit(); err != nil {
+		return "", err
+	}
+	sum := formatChecksum(algo, h)
+	if err := VerifyChecksum(dst, sum); err != nil {
+		if errors.Is(err, ErrChecksumMismatch) {
+			os.Remove(dst)
+		}
+		return "", err
+	}
+	return sum, nil
+}
+
+// VerifyChecksum relê o arquivo e compara com o checksum esperado.
+func VerifyChecksum(path, want string) error {
+	algo, _ := SplitChecksum(want)
+	got, err := FileChecksum(path, algo)
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return fmt.Errorf("%s: expected %s, got %s: %w", path, want, got, ErrChecksumMismatch)
+	}
+	return nil
+}
+
+// ShortChecksum abrevia o checksum para exibição na listagem.
+func ShortChecksum(sum string) string {
+	algo, digest := SplitChecksum(sum)
+	if len(digest) > 12 {
+		digest = digest[:12]
+	}
+	return algo + ":" + digest
+}
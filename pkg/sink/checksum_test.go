@@ -0,0 +1,43 @@
+package sink
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyFileWithChecksumAlgorithms(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "fatura.pdf")
+	os.WriteFile(src, []byte("conteudo da fatura"), 0644)
+	for _, algo := range []string{ChecksumSHA256, ChecksumXXHash, ChecksumBlake3} {
+		dst := filepath.Join(t.TempDir(), "fatura.pdf")
+		sum, err := CopyFileWithChecksum(src, dst, algo)
+		if err != nil {
+			t.Fatalf("%s: erro ao copiar: %v", algo, err)
+		}
+		want, _ := FileChecksum(src, algo)
+		if sum != want {
+			t.Errorf("%s: checksum %s diferente do original %s", algo, sum, want)
+		}
+		if err := VerifyChecksum(dst, sum); err != nil {
+			t.Errorf("%s: verificação do destino falhou: %v", algo, err)
+		}
+	}
+}
+
+func TestVerifyChecksumMismatch(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "dados.txt")
+	os.WriteFile(name, []byte("abc"), 0644)
+	sum, _ := FileChecksum(name, "")
+	if sum != "sha256:ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" {
+		t.Errorf("sha256 incorreto: %s", sum)
+	}
+	os.WriteFile(name, []byte("abd"), 0644)
+	if err := VerifyChecksum(name, sum); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("esperado ErrChecksumMismatch, veio %v", err)
+	}
+	if _, err := NewHasher("md5"); err == nil {
+		t.Errorf("esperado erro para algoritmo desconhecido")
+	}
+}
@@ -0,0 +1,137 @@
+package sink
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Algoritmos de compressão aplicados na entrega.
+const (
+	CompressGzip = "gzip"
+	CompressZstd = "zstd"
+)
+
+// Compression descreve a compressão do arquivo entregue. Level 0 usa o
+// padrão do algoritmo.
+type Compression struct {
+	Algorithm string
+	Level     int
+}
+
+// Ext retorna a extensão acrescentada ao nome do arquivo comprimido.
+func (c Compression) Ext() string {
+	return CompressExt(c.Algorithm)
+}
+
+// CompressExt retorna a extensão do algoritmo (".gz", ".zst").
+func CompressExt(algorithm string) string {
+	switch algorithm {
+	case CompressGzip:
+		return ".gz"
+	case CompressZstd:
+		return ".zst"
+	}
+	return ""
+}
+
+// Validate confere o algoritmo e a faixa do nível.
+func (c Compression) Validate() error {
+	switch c.Algorithm {
+	case CompressGzip:
+		if c.Level < 0 || c.Level > gzip.BestCompression {
+			return fmt.Errorf("gzip level must be between 1 and %d, or 0 for the default", gzip.BestCompression)
+		}
+	case CompressZstd:
+		if c.Level < 0 || c.Level > 22 {
+			return fmt.Errorf("zstd level must be between 1 and 22, or 0 for the default")
+		}
+	default:
+		return fmt.Errorf("unknown compression algorithm %q", c.Algorithm)
+	}
+	return nil
+}
+
+// NewCompressor comprime o que for escrito no WriteCloser para w. Close
+// finaliza o stream, mas não fecha w.
+func NewCompressor(w io.Writer, c Compression) (io.WriteCloser, error) {
+	switch c.Algorithm {
+	case CompressGzip:
+		level := c.Level
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		return gzip.NewWriterLevel(w, level)
+	case CompressZstd:
+		opts := []zstd.EOption{zstd.WithEncoderConcurrency(1)}
+		if c.Level != 0 {
+			opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(c.Level)))
+		}
+		return zstd.NewWriter(w, opts...)
+	}
+	return nil, fmt.Errorf("unknown compression algorithm %q", c.Algorithm)
+}
+
+// NewDecompressor lê o conteúdo original de um stream comprimido.
+func NewDecompressor(r io.Reader, algorithm string) (io.ReadCloser, error) {
+	switch algorithm {
+	case CompressGzip:
+		return gzip.NewReader(r)
+	case CompressZstd:
+		d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	}
+	return nil, fmt.Errorf("unknown compression algorithm %q", algorithm)
+}
+
+// CompressedChecksum calcula o checksum do conteúdo original de um arquivo
+// comprimido.
+func CompressedChecksum(path, algo, algorithm string) (string, error) {
+	h, err := NewHasher(algo)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	zr, err := NewDecompressor(f, algorithm)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	defer zr.Close()
+	if _, err := io.Copy(h, zr); err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	return formatChecksum(algo, h), nil
+}
+
+// VerifyCompressed descomprime o arquivo e compara com o checksum esperado do
+// conteúdo original. Um stream corrompido também conta como divergência.
+func VerifyCompressed(path, want, algorithm string) error {
+	algo, _ := SplitChecksum(want)
+	got, err := CompressedChecksum(path, algo, algorithm)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return err
+		}
+		return fmt.Errorf("%v: %w", err, ErrChecksumMismatch)
+	}
+	if got != want {
+		return fmt.Errorf("%s: expected %s, got %s: %w", path, want, got, ErrChecksumMismatch)
+	}
+	return nil
+}
+
+// TrimCompressExt remove a extensão do algoritmo do nome, se houver.
+func TrimCompressExt(name, algorithm string) string {
+	return strings.TrimSuffix(name, CompressExt(algorithm))
+}
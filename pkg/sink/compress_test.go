@@ -0,0 +1,57 @@
+package sink
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncodeFileCompressed(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "vendas.csv")
+	data := bytes.Repeat([]byte("2024-01-01;loja 1;123,45\n"), 1000)
+	os.WriteFile(src, data, 0644)
+	want, _ := FileChecksum(src, "")
+
+	for _, c := range []Compression{{Algorithm: CompressGzip}, {Algorithm: CompressZstd, Level: 19}} {
+		dst := filepath.Join(dir, "out", "vendas.csv"+c.Ext())
+		sum, err := EncodeFileWithChecksum(src, dst, "", Encoding{Compression: &c})
+		if err != nil {
+			t.Fatalf("%s: erro ao comprimir: %v", c.Algorithm, err)
+		}
+		if sum != want {
+			t.Errorf("%s: checksum deveria ser o do original: %s", c.Algorithm, sum)
+		}
+		fi, _ := os.Stat(dst)
+		if fi.Size() >= int64(len(data)) {
+			t.Errorf("%s: arquivo não foi comprimido (%d bytes)", c.Algorithm, fi.Size())
+		}
+		restored := filepath.Join(dir, "restored-"+c.Algorithm)
+		if sum, err := DecodeFile(dst, restored, "", c.Algorithm, nil); err != nil || sum != want {
+			t.Fatalf("%s: erro ao restaurar: %v %s", c.Algorithm, err, sum)
+		}
+		if got, _ := os.ReadFile(restored); !bytes.Equal(got, data) {
+			t.Errorf("%s: conteúdo restaurado difere do original", c.Algorithm)
+		}
+	}
+}
+
+func TestVerifyCompressedCorrupted(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "a.txt")
+	os.WriteFile(src, []byte("conteudo original"), 0644)
+	dst := filepath.Join(dir, "a.txt.gz")
+	sum, err := EncodeFileWithChecksum(src, dst, "", Encoding{Compression: &Compression{Algorithm: CompressGzip}})
+	if err != nil {
+		t.Fatalf("erro ao comprimir: %v", err)
+	}
+	os.WriteFile(dst, []byte("não é gzip"), 0644)
+	if err := VerifyCompressed(dst, sum, CompressGzip); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("stream corrompido deveria ser divergência: %v", err)
+	}
+	if err := (Compression{Algorithm: "bzip2"}).Validate(); err == nil {
+		t.Errorf("esperado erro para algoritmo desconhecido")
+	}
+}
@@ -0,0 +1,28 @@
+package sink
+
+import (
+	"context"
+	"path/filepath"
+)
+
+// Dir grava o arquivo em Path, mantendo o caminho relativo ao watch_dir, com
+// cópia atômica e verificação de checksum. É a forma mínima da entrega
+// local; o watcher usa a própria entrega, que também aplica on_conflict,
+// dest_template, preserve e transfer_mode.
+type Dir struct {
+	Path     string
+	Checksum string // algoritmo; vazio usa sha256
+}
+
+func (d Dir) Deliver(ctx context.Context, f File) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	dst := filepath.Join(d.Path, f.RelPath)
+	sum, err := CopyFileWithChecksum(f.Path, dst, d.Checksum)
+	if err != nil {
+		return err
+	}
+	f.Record(Receipt{Location: dst, Method: "copy", Checksum: sum})
+	return nil
+}
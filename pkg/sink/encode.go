@@ -0,0 +1,152 @@
+package sink
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"filippo.io/age"
+)
+
+// Encoding reúne as transformações aplicadas ao conteúdo gravado no destino:
+// a compressão e, depois dela, a cifragem.
+type Encoding struct {
+	Compression *Compression
+	Encryption  *Encryption
+}
+
+// Ext retorna as extensões acrescentadas ao nome, na ordem (ex.: ".zst.age").
+func (e Encoding) Ext() string {
+	ext := ""
+	if e.Compression != nil {
+		ext += e.Compression.Ext()
+	}
+	if e.Encryption != nil {
+		ext += EncryptExt
+	}
+	return ext
+}
+
+// EncodeFileWithChecksum grava src em dst aplicando enc durante o streaming e
+// retorna o checksum do conteúdo original. O destino é relido para confirmar
+// a gravação: descomprimido quando só há compressão, ou comparado byte a byte
+// com o que foi escrito quando há cifragem, já que a chave privada não fica
+// com o watcher.
+func EncodeFileWithChecksum(src, dst, algo string, enc Encoding) (string, error) {
+	h, err := NewHasher(algo)
+	if err != nil {
+		return "", err
+	}
+	stored, err := NewHasher(algo)
+	if err != nil {
+		return "", err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	out, err := CreateAtomic(dst)
+	if err != nil {
+		return "", err
+	}
+	defer out.Abort()
+
+	// Fecha as camadas de dentro para fora: compressor, depois age
+	var w io.Writer = io.MultiWriter(out, stored)
+	var closers []io.Closer
+	if enc.Encryption != nil {
+		aw, err := age.Encrypt(w, enc.Encryption.Recipients...)
+		if err != nil {
+			return "", err
+		}
+		w, closers = aw, append(closers, aw)
+	}
+	if enc.Compression != nil {
+		zw, err := NewCompressor(w, *enc.Compression)
+		if err != nil {
+			return "", err
+		}
+		w, closers = zw, append(closers, zw)
+	}
+	if _, err := io.Copy(io.MultiWriter(w, h), in); err != nil {
+		return "", err
+	}
+	for i := len(closers) - 1; i >= 0; i-- {
+		if err := closers[i].Close(); err != nil {
+			return "", err
+		}
+	}
+	if err := out.Commit(); err != nil {
+		return "", err
+	}
+
+	sum := formatChecksum(algo, h)
+	switch {
+	case enc.Encryption != nil:
+		err = VerifyChecksum(dst, formatChecksum(algo, stored))
+	case enc.Compression != nil:
+		err = VerifyCompressed(dst, sum, enc.Compression.Algorithm)
+	default:
+		err = VerifyChecksum(dst, sum)
+	}
+	if err != nil {
+		if errors.Is(err, ErrChecksumMismatch) {
+			os.Remove(dst)
+		}
+		return "", err
+	}
+	return sum, nil
+}
+
+// Decode escreve em w o conteúdo original de src, decifrando com identities
+// (se houver) e descomprimindo com compression (se não vazio). Retorna o
+// checksum do conteúdo restaurado.
+func Decode(w io.Writer, src, algo, compression string, identities []age.Identity) (string, error) {
+	h, err := NewHasher(algo)
+	if err != nil {
+		return "", err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	var r io.Reader = in
+	if len(identities) > 0 {
+		if r, err = age.Decrypt(r, identities...); err != nil {
+			return "", fmt.Errorf("%s: %w", src, err)
+		}
+	}
+	if compression != "" {
+		zr, err := NewDecompressor(r, compression)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", src, err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+	if _, err := io.Copy(io.MultiWriter(w, h), r); err != nil {
+		return "", fmt.Errorf("%s: %w", src, err)
+	}
+	return formatChecksum(algo, h), nil
+}
+
+// DecodeFile restaura em dst, de forma atômica, o conteúdo original de src
+// (ver Decode).
+func DecodeFile(src, dst, algo, compression string, identities []age.Identity) (string, error) {
+	out, err := CreateAtomic(dst)
+	if err != nil {
+		return "", err
+	}
+	defer out.Abort()
+	sum, err := Decode(out, src, algo, compression, identities)
+	if err != nil {
+		return "", err
+	}
+	if err := out.Commit(); err != nil {
+		return "", err
+	}
+	return sum, nil
+}
@@ -0,0 +1,63 @@
+package sink
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"filippo.io/age"
+)
+
+// Extensão acrescentada ao nome do arquivo cifrado.
+const EncryptExt = ".age"
+
+// Encryption cifra o conteúdo entregue com age para os Recipients. Só quem
+// tem uma das identidades correspondentes consegue restaurar o arquivo.
+type Encryption struct {
+	Recipients []age.Recipient
+	KeyID      string // identifica as chaves usadas; gravado junto da entrega
+}
+
+// LoadRecipients lê um arquivo de recipients do age (uma chave pública por
+// linha, # para comentários) e retorna também o fingerprint do conjunto,
+// usado como key ID padrão.
+func LoadRecipients(path string) ([]age.Recipient, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	recipients, err := age.ParseRecipients(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", path, err)
+	}
+	var keys []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			keys = append(keys, line)
+		}
+	}
+	sort.Strings(keys)
+	sum := sha256.Sum256([]byte(strings.Join(keys, "\n")))
+	return recipients, "age:" + hex.EncodeToString(sum[:8]), nil
+}
+
+// LoadIdentities lê um arquivo de identidades (chaves privadas) do age.
+func LoadIdentities(path string) ([]age.Identity, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	ids, err := age.ParseIdentities(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return ids, nil
+}
@@ -0,0 +1,51 @@
+package sink
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestEncodeFileEncrypted(t *testing.T) {
+	dir := t.TempDir()
+	id, _ := age.GenerateX25519Identity()
+	other, _ := age.GenerateX25519Identity()
+	recipientsFile := filepath.Join(dir, "recipients.txt")
+	os.WriteFile(recipientsFile, []byte("# equipe fiscal\n"+id.Recipient().String()+"\n"), 0644)
+	recipients, keyID, err := LoadRecipients(recipientsFile)
+	if err != nil || len(recipients) != 1 || !strings.HasPrefix(keyID, "age:") {
+		t.Fatalf("erro ao ler recipients: %v %d %q", err, len(recipients), keyID)
+	}
+
+	src := filepath.Join(dir, "cpf.csv")
+	data := bytes.Repeat([]byte("123.456.789-00;Fulano\n"), 500)
+	os.WriteFile(src, data, 0644)
+	want, _ := FileChecksum(src, "")
+	enc := Encoding{Compression: &Compression{Algorithm: CompressGzip}, Encryption: &Encryption{Recipients: recipients, KeyID: keyID}}
+	dst := filepath.Join(dir, "out", "cpf.csv"+enc.Ext())
+	if !strings.HasSuffix(dst, ".csv.gz.age") {
+		t.Fatalf("extensão inesperada: %s", dst)
+	}
+	sum, err := EncodeFileWithChecksum(src, dst, "", enc)
+	if err != nil || sum != want {
+		t.Fatalf("erro ao cifrar: %v %s", err, sum)
+	}
+	if stored, _ := os.ReadFile(dst); bytes.Contains(stored, []byte("Fulano")) {
+		t.Fatalf("conteúdo gravado em claro")
+	}
+
+	out := filepath.Join(dir, "restored.csv")
+	if sum, err := DecodeFile(dst, out, "", CompressGzip, []age.Identity{id}); err != nil || sum != want {
+		t.Fatalf("erro ao decifrar: %v %s", err, sum)
+	}
+	if got, _ := os.ReadFile(out); !bytes.Equal(got, data) {
+		t.Errorf("conteúdo restaurado difere do original")
+	}
+	if _, err := Decode(&bytes.Buffer{}, dst, "", CompressGzip, []age.Identity{other}); err == nil {
+		t.Errorf("esperado erro com identidade de outra chave")
+	}
+}
@@ -0,0 +1,158 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// ResponseSnippetSize é quanto do corpo da resposta HTTP fica no Receipt.
+const ResponseSnippetSize = 1024
+
+// HTTP envia o arquivo no corpo de uma requisição (cru ou multipart). Com
+// HMACSecret, a requisição leva X-GFW-Timestamp e X-GFW-Signature, o
+// HMAC-SHA256 em hex de "<timestamp>.<conteúdo do arquivo>".
+type HTTP struct {
+	URL       func(f File) (string, error)
+	Method    string // POST (padrão) ou PUT
+	Header    http.Header
+	Multipart bool
+	FieldName string // campo do arquivo no multipart; padrão "file"
+	// HMACSecret assina a requisição; vazio não assina.
+	HMACSecret []byte
+	Timeout    time.Duration // padrão 60s
+	// Success decide se o status indica entrega concluída; nil aceita 2xx.
+	Success func(status int) bool
+	// Retry decide se um status sem sucesso pode ser tentado de novo; nil
+	// aceita 5xx, 408 e 429. Os demais viram ErrPermanent.
+	Retry    func(status int) bool
+	Checksum string // algoritmo; vazio usa sha256
+	Client   *http.Client
+}
+
+func (s *HTTP) Deliver(ctx context.Context, f File) error {
+	target, err := s.URL(f)
+	if err != nil {
+		return err
+	}
+	src, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	// Primeira leitura: checksum e assinatura, que vão nos cabeçalhos
+	sum, err := NewHasher(s.Checksum)
+	if err != nil {
+		return err
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, s.HMACSecret)
+	mac.Write([]byte(ts + "."))
+	if _, err := io.Copy(io.MultiWriter(sum, mac), src); err != nil {
+		return err
+	}
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	checksum := formatChecksum(s.Checksum, sum)
+
+	// LimitReader impede que o transporte feche o arquivo
+	var body io.Reader = io.LimitReader(src, fi.Size())
+	size, contentType := fi.Size(), "application/octet-stream"
+	if s.Multipart {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		field := s.FieldName
+		if field == "" {
+			field = "file"
+		}
+		if _, err := mw.CreateFormFile(field, filepath.Base(f.RelPath)); err != nil {
+			return err
+		}
+		head := bytes.Clone(buf.Bytes())
+		buf.Reset()
+		mw.Close()
+		tail := bytes.Clone(buf.Bytes())
+		body = io.MultiReader(bytes.NewReader(head), body, bytes.NewReader(tail))
+		size += int64(len(head) + len(tail))
+		contentType = mw.FormDataContentType()
+	}
+
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = 60 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	method := s.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	for k, v := range s.Header {
+		req.Header[k] = v
+	}
+	if req.Header.Get("Content-Type") == "" || s.Multipart {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("X-GFW-Tenant", f.Tenant)
+	req.Header.Set("X-GFW-Filename", filepath.ToSlash(f.RelPath))
+	req.Header.Set("X-GFW-Checksum", checksum)
+	if len(s.HMACSecret) > 0 {
+		req.Header.Set("X-GFW-Timestamp", ts)
+		req.Header.Set("X-GFW-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, ResponseSnippetSize))
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+
+	f.Record(Receipt{Location: target, Method: "http", Checksum: checksum, Status: resp.StatusCode, Response: string(snippet)})
+	if s.succeeded(resp.StatusCode) {
+		return nil
+	}
+	err = fmt.Errorf("http: %s %s: status %d: %s", method, target, resp.StatusCode, bytes.TrimSpace(snippet))
+	if !s.retryable(resp.StatusCode) {
+		err = fmt.Errorf("%w: %v", ErrPermanent, err)
+	}
+	return err
+}
+
+func (s *HTTP) succeeded(status int) bool {
+	if s.Success != nil {
+		return s.Success(status)
+	}
+	return status/100 == 2
+}
+
+func (s *HTTP) retryable(status int) bool {
+	if s.Retry != nil {
+		return s.Retry(status)
+	}
+	return status/100 == 5 || status == http.StatusRequestTimeout || status == http.StatusTooManyRequests
+}
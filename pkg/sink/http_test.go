@@ -0,0 +1,119 @@
+package sink
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func httpTestFile(t *testing.T, content string) (File, *Receipt) {
+	name := filepath.Join(t.TempDir(), "nota.xml")
+	os.WriteFile(name, []byte(content), 0644)
+	receipt := &Receipt{}
+	return File{Tenant: "t1", Source: name, Path: name, RelPath: "2024/nota.xml", Receipt: receipt}, receipt
+}
+
+func TestHTTPDeliver(t *testing.T) {
+	var got struct {
+		method, path, body, sig, ts, tenant, name, auth string
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		got.method, got.path, got.body = r.Method, r.URL.Path, string(data)
+		got.sig, got.ts = r.Header.Get("X-GFW-Signature"), r.Header.Get("X-GFW-Timestamp")
+		got.tenant, got.name, got.auth = r.Header.Get("X-GFW-Tenant"), r.Header.Get("X-GFW-Filename"), r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, `{"id":42}`)
+	}))
+	defer srv.Close()
+
+	s := &HTTP{
+		URL:        func(f File) (string, error) { return srv.URL + "/upload/" + f.Tenant, nil },
+		Method:     http.MethodPut,
+		Header:     http.Header{"Authorization": {"Bearer abc"}},
+		HMACSecret: []byte("segredo"),
+	}
+	f, receipt := httpTestFile(t, "<nfe/>")
+	if err := s.Deliver(context.Background(), f); err != nil {
+		t.Fatalf("erro na entrega: %v", err)
+	}
+	if got.method != http.MethodPut || got.path != "/upload/t1" || got.body != "<nfe/>" {
+		t.Errorf("requisição inesperada: %+v", got)
+	}
+	if got.tenant != "t1" || got.name != "2024/nota.xml" || got.auth != "Bearer abc" {
+		t.Errorf("cabeçalhos inesperados: %+v", got)
+	}
+	mac := hmac.New(sha256.New, []byte("segredo"))
+	io.WriteString(mac, got.ts+".<nfe/>")
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); got.sig != want {
+		t.Errorf("assinatura incorreta: %s, esperado %s", got.sig, want)
+	}
+	if receipt.Status != http.StatusCreated || receipt.Response != `{"id":42}` || receipt.Method != "http" {
+		t.Errorf("receipt incorreto: %+v", receipt)
+	}
+}
+
+func TestHTTPDeliverMultipart(t *testing.T) {
+	var field, filename, content string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength <= 0 {
+			t.Errorf("multipart deveria informar Content-Length")
+		}
+		file, hdr, err := r.FormFile("documento")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, _ := io.ReadAll(file)
+		field, filename, content = "documento", hdr.Filename, string(data)
+	}))
+	defer srv.Close()
+
+	s := &HTTP{URL: func(File) (string, error) { return srv.URL, nil }, Multipart: true, FieldName: "documento"}
+	f, _ := httpTestFile(t, "<nfe/>")
+	if err := s.Deliver(context.Background(), f); err != nil {
+		t.Fatalf("erro na entrega: %v", err)
+	}
+	if field != "documento" || filename != "nota.xml" || content != "<nfe/>" {
+		t.Errorf("formulário inesperado: %q %q %q", field, filename, content)
+	}
+}
+
+func TestHTTPStatusCriteria(t *testing.T) {
+	status := http.StatusConflict
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		io.WriteString(w, strings.Repeat("x", 2*ResponseSnippetSize))
+	}))
+	defer srv.Close()
+
+	s := &HTTP{URL: func(File) (string, error) { return srv.URL, nil }}
+	f, receipt := httpTestFile(t, "<nfe/>")
+	err := s.Deliver(context.Background(), f)
+	if !errors.Is(err, ErrPermanent) {
+		t.Fatalf("409 deveria ser falha permanente: %v", err)
+	}
+	if receipt.Status != http.StatusConflict || len(receipt.Response) != ResponseSnippetSize {
+		t.Errorf("receipt deveria guardar status e trecho da resposta: %d %d", receipt.Status, len(receipt.Response))
+	}
+
+	status = http.StatusServiceUnavailable
+	if err := s.Deliver(context.Background(), f); err == nil || errors.Is(err, ErrPermanent) {
+		t.Errorf("503 deveria permitir nova tentativa: %v", err)
+	}
+
+	status = http.StatusConflict
+	s.Success = func(code int) bool { return code/100 == 2 || code == http.StatusConflict }
+	if err := s.Deliver(context.Background(), f); err != nil {
+		t.Errorf("409 configurado como sucesso: %v", err)
+	}
+}
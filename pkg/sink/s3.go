@@ -0,0 +1,404 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultPartSize é o tamanho das partes do upload multipart. Arquivos
+// maiores que PartSize são enviados em partes.
+const DefaultPartSize = 16 << 20
+
+// emptySHA256 é o sha256 de um corpo vazio, exigido na assinatura.
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// S3 envia o arquivo para um bucket S3 ou compatível (MinIO, Ceph, R2...),
+// com assinatura SigV4. O servidor confere o conteúdo pelo Content-MD5 e pelo
+// x-amz-content-sha256 de cada requisição; o ETag devolvido é comparado com
+// o MD5 calculado localmente.
+type S3 struct {
+	Endpoint     string // ex.: https://s3.us-east-1.amazonaws.com ou http://localhost:9000
+	Region       string // padrão us-east-1
+	Bucket       string
+	Prefix       string // prefixo das chaves quando Key é nil
+	PathStyle    bool   // endpoint/bucket/chave em vez de bucket.endpoint/chave
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	PartSize     int64  // padrão DefaultPartSize
+	Checksum     string // algoritmo do Receipt.Checksum; vazio usa sha256
+	// Com SSE-KMS ou SSE-C o ETag não é o MD5 do conteúdo e não pode ser
+	// comparado; o Content-MD5 continua verificado pelo servidor.
+	SkipETagCheck bool
+	// Key monta a chave do objeto; nil usa Prefix + RelPath.
+	Key    func(f File) (string, error)
+	Client *http.Client
+}
+
+func (s *S3) Deliver(ctx context.Context, f File) error {
+	key, err := s.objectKey(f)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(f.Path)
+	if err != nil {
+		return err
+	}
+	src, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	sum, err := NewHasher(s.Checksum)
+	if err != nil {
+		return err
+	}
+	method, etag := "put", ""
+	if fi.Size() > s.partSize() {
+		method = "multipart"
+		etag, err = s.putMultipart(ctx, key, src, fi.Size(), sum)
+	} else {
+		etag, err = s.putObject(ctx, key, src, fi.Size(), sum)
+	}
+	if err != nil {
+		return err
+	}
+	f.Record(Receipt{Location: s.location(key), Method: method, Checksum: formatChecksum(s.Checksum, sum), ETag: etag})
+	return nil
+}
+
+// Remove apaga o objeto de uma entrega anterior.
+func (s *S3) Remove(ctx context.Context, location string) error {
+	key, ok := strings.CutPrefix(location, "s3://"+s.Bucket+"/")
+	if !ok {
+		return fmt.Errorf("s3: %s is not in bucket %s", location, s.Bucket)
+	}
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, nil, 0, emptySHA256, "")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3) objectKey(f File) (string, error) {
+	if s.Key != nil {
+		return s.Key(f)
+	}
+	return path.Join(s.Prefix, filepath.ToSlash(f.RelPath)), nil
+}
+
+func (s *S3) location(key string) string {
+	return "s3://" + s.Bucket + "/" + key
+}
+
+func (s *S3) partSize() int64 {
+	if s.PartSize > 0 {
+		return s.PartSize
+	}
+	return DefaultPartSize
+}
+
+// putObject envia o arquivo numa única requisição.
+func (s *S3) putObject(ctx context.Context, key string, src io.ReadSeeker, size int64, sum hash.Hash) (string, error) {
+	md5sum, sha, err := digestSection(src, size, sum)
+	if err != nil {
+		return "", err
+	}
+	// LimitReader impede que o transporte feche o arquivo
+	resp, err := s.do(ctx, http.MethodPut, key, nil, io.LimitReader(src, size), size, hex.EncodeToString(sha), base64.StdEncoding.EncodeToString(md5sum))
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	etag := strings.Trim(resp.Header.Get("ETag"), `"`)
+	if !s.SkipETagCheck && etag != hex.EncodeToString(md5sum) {
+		return "", fmt.Errorf("%w: s3 object %s has ETag %s", ErrChecksumMismatch, key, etag)
+	}
+	return etag, nil
+}
+
+type s3Part struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type s3CompleteUpload struct {
+	XMLName xml.Name `xml:"CompleteMultipartUpload"`
+	Parts   []s3Part `xml:"Part"`
+}
+
+// putMultipart envia o arquivo em partes de PartSize. Em caso de erro o
+// upload é abortado para não deixar partes cobradas no bucket.
+func (s *S3) putMultipart(ctx context.Context, key string, src io.ReadSeeker, size int64, sum hash.Hash) (etag string, err error) {
+	var created struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := s.doXML(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil, &created); err != nil {
+		return "", err
+	}
+	defer func() {
+		if err != nil {
+			abort := url.Values{"uploadId": {created.UploadID}}
+			if resp, aerr := s.do(context.Background(), http.MethodDelete, key, abort, nil, 0, emptySHA256, ""); aerr == nil {
+				resp.Body.Close()
+			}
+		}
+	}()
+
+	var complete s3CompleteUpload
+	var md5s []byte
+	for n, off := 1, int64(0); off < size; n, off = n+1, off+s.partSize() {
+		partLen := min(s.partSize(), size-off)
+		if _, err := src.Seek(off, io.SeekStart); err != nil {
+			return "", err
+		}
+		md5sum, sha, err := digestSection(src, partLen, sum)
+		if err != nil {
+			return "", err
+		}
+		query := url.Values{"partNumber": {strconv.Itoa(n)}, "uploadId": {created.UploadID}}
+		resp, err := s.do(ctx, http.MethodPut, key, query, io.LimitReader(src, partLen), partLen, hex.EncodeToString(sha), base64.StdEncoding.EncodeToString(md5sum))
+		if err != nil {
+			return "", err
+		}
+		resp.Body.Close()
+		partETag := strings.Trim(resp.Header.Get("ETag"), `"`)
+		if !s.SkipETagCheck && partETag != hex.EncodeToString(md5sum) {
+			return "", fmt.Errorf("%w: s3 part %d of %s has ETag %s", ErrChecksumMismatch, n, key, partETag)
+		}
+		complete.Parts = append(complete.Parts, s3Part{PartNumber: n, ETag: `"` + partETag + `"`})
+		md5s = append(md5s, md5sum...)
+	}
+
+	body, err := xml.Marshal(complete)
+	if err != nil {
+		return "", err
+	}
+	var done struct {
+		ETag string `xml:"ETag"`
+	}
+	if err := s.doXML(ctx, http.MethodPost, key, url.Values{"uploadId": {created.UploadID}}, body, &done); err != nil {
+		return "", err
+	}
+	// ETag de multipart: md5 da concatenação dos md5 das partes, -N
+	etag = strings.Trim(done.ETag, `"`)
+	whole := md5.Sum(md5s)
+	if want := fmt.Sprintf("%x-%d", whole, len(complete.Parts)); !s.SkipETagCheck && etag != want {
+		return "", fmt.Errorf("%w: s3 object %s has ETag %s, want %s", ErrChecksumMismatch, key, etag, want)
+	}
+	return etag, nil
+}
+
+// digestSection lê size bytes de r calculando md5 e sha256 da seção e
+// alimentando sum com o mesmo conteúdo; depois volta r ao início da seção.
+func digestSection(r io.ReadSeeker, size int64, sum hash.Hash) ([]byte, []byte, error) {
+	m, h := md5.New(), sha256.New()
+	n, err := io.Copy(io.MultiWriter(m, h, sum), io.LimitReader(r, size))
+	if err != nil {
+		return nil, nil, err
+	}
+	if n != size {
+		return nil, nil, fmt.Errorf("short read: %d of %d bytes", n, size)
+	}
+	if _, err := r.Seek(-size, io.SeekCurrent); err != nil {
+		return nil, nil, err
+	}
+	return m.Sum(nil), h.Sum(nil), nil
+}
+
+// doXML envia body (ou nada) e decodifica a resposta XML em out. O
+// CompleteMultipartUpload pode responder 200 com um <Error> no corpo.
+func (s *S3) doXML(ctx context.Context, method, key string, query url.Values, body []byte, out interface{}) error {
+	sha := sha256.Sum256(body)
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	resp, err := s.do(ctx, method, key, query, r, int64(len(body)), hex.EncodeToString(sha[:]), "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if bytes.Contains(data, []byte("<Error>")) {
+		return s3Error(method, key, resp.StatusCode, data)
+	}
+	return xml.Unmarshal(data, out)
+}
+
+// do monta, assina e envia a requisição. Respostas fora de 2xx viram erro.
+func (s *S3) do(ctx context.Context, method, key string, query url.Values, body io.Reader, size int64, payloadHash, contentMD5 string) (*http.Response, error) {
+	endpoint, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("s3: invalid endpoint: %w", err)
+	}
+	u := &url.URL{Scheme: endpoint.Scheme, Host: endpoint.Host}
+	escaped := "/" + awsEscape(key, true)
+	if s.PathStyle {
+		escaped = "/" + awsEscape(s.Bucket, false) + escaped
+	} else {
+		u.Host = s.Bucket + "." + endpoint.Host
+	}
+	u.Path, _ = url.PathUnescape(escaped)
+	u.RawPath = escaped
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = size
+	if size == 0 {
+		req.Body = http.NoBody
+	}
+	if contentMD5 != "" {
+		req.Header.Set("Content-MD5", contentMD5)
+	}
+	s.sign(req, payloadHash, time.Now())
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, s3Error(method, key, resp.StatusCode, data)
+	}
+	return resp, nil
+}
+
+// s3Error converte a resposta de erro do S3. BadDigest e
+// XAmzContentSHA256Mismatch indicam que o conteúdo chegou diferente.
+func s3Error(method, key string, status int, data []byte) error {
+	var e struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	xml.Unmarshal(data, &e)
+	err := fmt.Errorf("s3: %s %s: %d %s: %s", method, key, status, e.Code, e.Message)
+	if e.Code == "BadDigest" || e.Code == "XAmzContentSHA256Mismatch" {
+		err = fmt.Errorf("%w: %v", ErrChecksumMismatch, err)
+	}
+	return err
+}
+
+// sign adiciona a assinatura AWS SigV4. Assina host, content-md5,
+// content-type, range e os cabeçalhos x-amz-*.
+func (s *S3) sign(req *http.Request, payloadHash string, t time.Time) {
+	region := s.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	amzDate := t.UTC().Format("20060102T150405Z")
+	day := amzDate[:8]
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+	if s.SessionToken != "" {
+		req.Header.Set("x-amz-security-token", s.SessionToken)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		switch {
+		case lower == "content-md5", lower == "content-type", lower == "range", strings.HasPrefix(lower, "x-amz-"):
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonHeaders strings.Builder
+	for _, name := range names {
+		canonHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonHeaders.String(),
+		signed,
+		payloadHash,
+	}, "\n")
+	scope := day + "/" + region + "/s3/aws4_request"
+	digest := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(digest[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", s.AccessKey, scope, signed, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// canonicalQuery ordena e codifica a query como exige o SigV4.
+func canonicalQuery(query url.Values) string {
+	pairs := make([]string, 0, len(query))
+	for k, values := range query {
+		for _, v := range values {
+			pairs = append(pairs, awsEscape(k, false)+"="+awsEscape(v, false))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// awsEscape codifica tudo exceto os caracteres não reservados (e "/", se
+// keepSlash), como o SigV4 espera.
+func awsEscape(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && keepSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,300 @@
+package sink
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// DefaultSFTPConns é o número padrão de conexões mantidas por destino SFTP.
+const DefaultSFTPConns = 4
+
+// Extensão do OpenSSH que permite renomear por cima de um arquivo existente.
+const posixRenameExtension = "posix-rename@openssh.com"
+
+// SFTP envia o arquivo para um servidor SFTP. A chave do servidor precisa
+// conferir com HostKey; o conteúdo é gravado num temporário oculto, relido
+// para conferir o checksum e só então renomeado para o nome final. As
+// conexões são reaproveitadas entre entregas e refeitas quando caem.
+type SFTP struct {
+	Addr    string // host:porta
+	User    string
+	Auth    []ssh.AuthMethod
+	HostKey string // chave do servidor (formato authorized_keys) ou fingerprint SHA256:...
+	Dir     string // diretório remoto quando Path é nil
+	// Path monta o caminho remoto; nil usa Dir + RelPath.
+	Path     func(f File) (string, error)
+	Checksum string // algoritmo; vazio usa sha256
+	MaxConns int    // padrão DefaultSFTPConns
+	Timeout  time.Duration
+
+	once  sync.Once
+	slots chan struct{}
+	mu    sync.Mutex
+	idle  []*sftpConn
+}
+
+type sftpConn struct {
+	ssh    *ssh.Client
+	client *sftp.Client
+}
+
+func (c *sftpConn) close() {
+	c.client.Close()
+	c.ssh.Close()
+}
+
+func (s *SFTP) Deliver(ctx context.Context, f File) error {
+	dst, err := s.remotePath(f)
+	if err != nil {
+		return err
+	}
+	var sum string
+	err = s.withConn(ctx, func(c *sftp.Client) error {
+		sum, err = s.upload(c, f.Path, dst)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	f.Record(Receipt{Location: s.location(dst), Method: "sftp", Checksum: sum})
+	return nil
+}
+
+// Remove apaga o arquivo de uma entrega anterior.
+func (s *SFTP) Remove(ctx context.Context, location string) error {
+	prefix := s.location("")
+	p, ok := strings.CutPrefix(location, prefix)
+	if !ok {
+		return fmt.Errorf("sftp: %s is not on %s", location, prefix)
+	}
+	return s.withConn(ctx, func(c *sftp.Client) error {
+		return c.Remove(p)
+	})
+}
+
+// Close encerra as conexões ociosas.
+func (s *SFTP) Close() error {
+	s.mu.Lock()
+	idle := s.idle
+	s.idle = nil
+	s.mu.Unlock()
+	for _, c := range idle {
+		c.close()
+	}
+	return nil
+}
+
+func (s *SFTP) remotePath(f File) (string, error) {
+	if s.Path != nil {
+		return s.Path(f)
+	}
+	return path.Join(s.Dir, filepath.ToSlash(f.RelPath)), nil
+}
+
+func (s *SFTP) location(p string) string {
+	return "sftp://" + s.User + "@" + s.Addr + p
+}
+
+// upload grava src em dst de forma atômica e retorna o checksum conferido.
+func (s *SFTP) upload(c *sftp.Client, src, dst string) (string, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	dir := path.Dir(dst)
+	if err := c.MkdirAll(dir); err != nil {
+		return "", err
+	}
+	suffix := make([]byte, 6)
+	rand.Read(suffix)
+	tmp := path.Join(dir, TempFilePrefix+path.Base(dst)+"-"+hex.EncodeToString(suffix))
+
+	h, err := NewHasher(s.Checksum)
+	if err != nil {
+		return "", err
+	}
+	out, err := c.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(out, io.TeeReader(in, h))
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		c.Remove(tmp)
+		return "", err
+	}
+	want := formatChecksum(s.Checksum, h)
+	if err := s.verify(c, tmp, want); err != nil {
+		c.Remove(tmp)
+		return "", err
+	}
+	// posix-rename substitui o destino de forma atômica. Só sem a extensão o
+	// destino é apagado antes, porque o rename do SFTP v3 falha se ele
+	// existir; qualquer outra falha mantém a versão anterior no lugar
+	if _, ok := c.HasExtension(posixRenameExtension); ok {
+		if err := c.PosixRename(tmp, dst); err != nil {
+			c.Remove(tmp)
+			return "", err
+		}
+		return want, nil
+	}
+	c.Remove(dst)
+	if err := c.Rename(tmp, dst); err != nil {
+		c.Remove(tmp)
+		return "", err
+	}
+	return want, nil
+}
+
+// verify relê o arquivo remoto e compara com o checksum enviado.
+func (s *SFTP) verify(c *sftp.Client, p, want string) error {
+	f, err := c.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h, _ := NewHasher(s.Checksum)
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	if got := formatChecksum(s.Checksum, h); got != want {
+		return fmt.Errorf("%w: sftp %s has %s, sent %s", ErrChecksumMismatch, p, got, want)
+	}
+	return nil
+}
+
+// withConn executa fn com uma conexão do pool. Se a conexão cair no meio da
+// operação, ela é descartada e fn roda mais uma vez numa conexão nova.
+func (s *SFTP) withConn(ctx context.Context, fn func(*sftp.Client) error) error {
+	s.once.Do(func() {
+		n := s.MaxConns
+		if n <= 0 {
+			n = DefaultSFTPConns
+		}
+		s.slots = make(chan struct{}, n)
+	})
+	select {
+	case s.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-s.slots }()
+
+	for attempt := 0; ; attempt++ {
+		c, reused, err := s.conn(ctx)
+		if err != nil {
+			return err
+		}
+		err = fn(c.client)
+		if err == nil || !connLost(err) {
+			s.release(c)
+			return err
+		}
+		c.close()
+		// Só tenta de novo quando a conexão veio do pool e pode ter expirado
+		if !reused || attempt > 0 {
+			return err
+		}
+	}
+}
+
+func (s *SFTP) conn(ctx context.Context) (*sftpConn, bool, error) {
+	s.mu.Lock()
+	if n := len(s.idle); n > 0 {
+		c := s.idle[n-1]
+		s.idle = s.idle[:n-1]
+		s.mu.Unlock()
+		return c, true, nil
+	}
+	s.mu.Unlock()
+	c, err := s.dial(ctx)
+	return c, false, err
+}
+
+func (s *SFTP) release(c *sftpConn) {
+	s.mu.Lock()
+	s.idle = append(s.idle, c)
+	s.mu.Unlock()
+}
+
+func (s *SFTP) dial(ctx context.Context) (*sftpConn, error) {
+	check, err := pinnedHostKey(s.HostKey)
+	if err != nil {
+		return nil, err
+	}
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	d := net.Dialer{Timeout: timeout}
+	nc, err := d.DialContext(ctx, "tcp", s.Addr)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &ssh.ClientConfig{User: s.User, Auth: s.Auth, HostKeyCallback: check, Timeout: timeout}
+	nc.SetDeadline(time.Now().Add(timeout))
+	sc, chans, reqs, err := ssh.NewClientConn(nc, s.Addr, cfg)
+	if err != nil {
+		nc.Close()
+		return nil, fmt.Errorf("sftp: %s: %w", s.Addr, err)
+	}
+	nc.SetDeadline(time.Time{})
+	client := ssh.NewClient(sc, chans, reqs)
+	sc2, err := sftp.NewClient(client)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("sftp: %s: %w", s.Addr, err)
+	}
+	return &sftpConn{ssh: client, client: sc2}, nil
+}
+
+// pinnedHostKey aceita só a chave configurada, informada como chave pública
+// ou como fingerprint SHA256.
+func pinnedHostKey(pinned string) (ssh.HostKeyCallback, error) {
+	pinned = strings.TrimSpace(pinned)
+	if pinned == "" {
+		return nil, errors.New("sftp: host key is required")
+	}
+	want := pinned
+	if !strings.HasPrefix(pinned, "SHA256:") {
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(pinned))
+		if err != nil {
+			return nil, fmt.Errorf("sftp: invalid host key: %w", err)
+		}
+		want = ssh.FingerprintSHA256(key)
+	}
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if got := ssh.FingerprintSHA256(key); got != want {
+			return fmt.Errorf("sftp: host key mismatch for %s: got %s, want %s", hostname, got, want)
+		}
+		return nil
+	}, nil
+}
+
+// connLost informa se o erro indica que a conexão caiu, e não uma recusa do
+// servidor (permissão, caminho inexistente...).
+func connLost(err error) bool {
+	var status *sftp.StatusError
+	if errors.As(err, &status) || errors.Is(err, ErrChecksumMismatch) || errors.Is(err, os.ErrNotExist) || errors.Is(err, os.ErrPermission) {
+		return false
+	}
+	var netErr net.Error
+	return errors.Is(err, sftp.ErrSSHFxConnectionLost) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &netErr)
+}
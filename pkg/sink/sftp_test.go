@@ -0,0 +1,138 @@
+package sink
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/thiagozs/go-filewatcher/internal/sftpfake"
+	"golang.org/x/crypto/ssh"
+)
+
+func newTestSFTP(t *testing.T) (*sftpfake.Server, *SFTP) {
+	srv, err := sftpfake.New()
+	if err != nil {
+		t.Fatalf("erro ao iniciar servidor ssh: %v", err)
+	}
+	t.Cleanup(srv.Close)
+	s := &SFTP{
+		Addr:    srv.Addr,
+		User:    sftpfake.User,
+		Auth:    []ssh.AuthMethod{ssh.PublicKeys(srv.ClientKey)},
+		HostKey: string(ssh.MarshalAuthorizedKey(srv.HostKey)),
+		Dir:     t.TempDir(),
+	}
+	t.Cleanup(func() { s.Close() })
+	return srv, s
+}
+
+func TestSFTPDeliver(t *testing.T) {
+	srv, s := newTestSFTP(t)
+	src := filepath.Join(t.TempDir(), "nfe.xml")
+	os.WriteFile(src, []byte("<nfe/>"), 0644)
+	want := filepath.Join(s.Dir, "2024", "nfe.xml")
+	os.MkdirAll(filepath.Dir(want), 0755)
+	os.WriteFile(want, []byte("versão antiga"), 0644)
+
+	for i := 0; i < 2; i++ {
+		var r Receipt
+		f := File{Source: src, Path: src, RelPath: filepath.Join("2024", "nfe.xml"), Receipt: &r}
+		if err := s.Deliver(context.Background(), f); err != nil {
+			t.Fatalf("erro na entrega: %v", err)
+		}
+		if data, _ := os.ReadFile(want); string(data) != "<nfe/>" {
+			t.Errorf("conteúdo remoto incorreto: %q", data)
+		}
+		sum, _ := FileChecksum(src, "")
+		if r.Location != "sftp://"+sftpfake.User+"@"+srv.Addr+want || r.Method != "sftp" || r.Checksum != sum {
+			t.Errorf("receipt incorreto: %+v", r)
+		}
+	}
+	entries, _ := os.ReadDir(filepath.Dir(want))
+	for _, e := range entries {
+		if IsTempFile(e.Name()) {
+			t.Errorf("temporário deixado no servidor: %s", e.Name())
+		}
+	}
+	if n := srv.Accepted(); n != 1 {
+		t.Errorf("entregas seguidas deveriam reaproveitar a conexão, abriu %d", n)
+	}
+
+	if err := s.Remove(context.Background(), "sftp://"+sftpfake.User+"@"+srv.Addr+want); err != nil {
+		t.Errorf("erro ao remover: %v", err)
+	}
+	if _, err := os.Stat(want); !os.IsNotExist(err) {
+		t.Errorf("arquivo remoto não removido")
+	}
+}
+
+func TestSFTPRenameFailureKeepsDest(t *testing.T) {
+	_, s := newTestSFTP(t)
+	src := filepath.Join(t.TempDir(), "nfe.xml")
+	os.WriteFile(src, []byte("<nfe/>"), 0644)
+	// O servidor tem posix-rename; a falha do rename não pode apagar o destino
+	dst := filepath.Join(s.Dir, "nfe.xml")
+	os.MkdirAll(dst, 0755)
+	f := File{Source: src, Path: src, RelPath: "nfe.xml", Receipt: &Receipt{}}
+	if err := s.Deliver(context.Background(), f); err == nil {
+		t.Fatalf("esperado erro ao renomear por cima de um diretório")
+	}
+	if fi, err := os.Stat(dst); err != nil || !fi.IsDir() {
+		t.Errorf("destino removido após falha do rename: %v", err)
+	}
+	entries, _ := os.ReadDir(s.Dir)
+	for _, e := range entries {
+		if IsTempFile(e.Name()) {
+			t.Errorf("temporário deixado no servidor: %s", e.Name())
+		}
+	}
+}
+
+func TestSFTPReconnect(t *testing.T) {
+	srv, s := newTestSFTP(t)
+	src := filepath.Join(t.TempDir(), "a.txt")
+	os.WriteFile(src, []byte("abc"), 0644)
+	f := File{Path: src, RelPath: "a.txt"}
+	if err := s.Deliver(context.Background(), f); err != nil {
+		t.Fatalf("erro na entrega: %v", err)
+	}
+	// O servidor derruba a conexão ociosa; a próxima entrega reconecta
+	srv.DropConnections()
+	if err := s.Deliver(context.Background(), f); err != nil {
+		t.Fatalf("erro na entrega após queda da conexão: %v", err)
+	}
+	if n := srv.Accepted(); n != 2 {
+		t.Errorf("esperada uma reconexão, conexões: %d", n)
+	}
+}
+
+func TestSFTPHostKeyPinning(t *testing.T) {
+	srv, s := newTestSFTP(t)
+	src := filepath.Join(t.TempDir(), "a.txt")
+	os.WriteFile(src, []byte("abc"), 0644)
+	f := File{Path: src, RelPath: "a.txt"}
+
+	pub, _, _ := ed25519.GenerateKey(rand.Reader)
+	other, _ := ssh.NewPublicKey(pub)
+	s.HostKey = string(ssh.MarshalAuthorizedKey(other))
+	if err := s.Deliver(context.Background(), f); err == nil || !strings.Contains(err.Error(), "host key mismatch") {
+		t.Errorf("esperado erro de host key, veio %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(s.Dir, "a.txt")); !os.IsNotExist(err) {
+		t.Errorf("nada deveria ser gravado num servidor desconhecido")
+	}
+
+	s.HostKey = ssh.FingerprintSHA256(srv.HostKey)
+	if err := s.Deliver(context.Background(), f); err != nil {
+		t.Errorf("fingerprint correto recusado: %v", err)
+	}
+	s.HostKey = ""
+	s.Close()
+	if err := s.Deliver(context.Background(), f); err == nil {
+		t.Errorf("esperado erro sem host key")
+	}
+}
@@ -0,0 +1,98 @@
+// Package sink define o destino final de cada arquivo entregue pelo watcher
+// e os processadores que podem ser encadeados antes dele. Também reúne a
+// cópia atômica com verificação de checksum usada pela entrega local.
+package sink
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+)
+
+// File é o arquivo a ser entregue em um destino.
+type File struct {
+	Tenant      string
+	Destination string      // nome do destino no config
+	Source      string      // caminho original no watch_dir
+	Path        string      // conteúdo a entregar; um Processor pode trocá-lo por um temporário
+	RelPath     string      // caminho relativo ao watch_dir
+	Info        os.FileInfo // metadados da origem, obtidos antes da entrega
+	Arrival     time.Time
+	Receipt     *Receipt // preenchido pelo Sink, se não for nil
+}
+
+// Open abre o conteúdo a ser entregue.
+func (f File) Open() (*os.File, error) {
+	return os.Open(f.Path)
+}
+
+// Receipt descreve onde e como o Sink gravou o arquivo. O watcher registra
+// esses dados na tabela deliveries.
+type Receipt struct {
+	Location    string // caminho ou URL final
+	Method      string // como o conteúdo chegou ao destino (copy, move, ...)
+	Checksum    string // checksum do conteúdo entregue, no formato algoritmo:hex
+	ETag        string // versão do objeto informada pelo destino remoto, se houver
+	Status      int    // status da resposta, nos destinos HTTP
+	Response    string // começo do corpo da resposta, nos destinos HTTP
+	Size        int64  // bytes gravados no destino, se conhecido
+	Compression string // algoritmo aplicado ao conteúdo gravado, se houver
+	KeyID       string // chave usada para cifrar o conteúdo gravado, se houver
+}
+
+// Record preenche o Receipt do arquivo, se houver um.
+func (f File) Record(r Receipt) {
+	if f.Receipt != nil {
+		*f.Receipt = r
+	}
+}
+
+// Sink entrega o arquivo no destino. Um erro deixa a origem no watch_dir e,
+// se o destino for obrigatório, agenda uma nova tentativa.
+type Sink interface {
+	Deliver(ctx context.Context, f File) error
+}
+
+// ErrPermanent marca falhas de entrega que uma nova tentativa não resolve,
+// como uma requisição recusada pelo destino. O watcher não as reagenda.
+var ErrPermanent = errors.New("permanent delivery failure")
+
+// Remover é implementado pelos sinks que sabem apagar o que entregaram; o
+// --delete-processed o usa no lugar de os.Remove. location é o
+// Receipt.Location da entrega.
+type Remover interface {
+	Remove(ctx context.Context, location string) error
+}
+
+// SinkFunc adapta uma função comum a Sink.
+type SinkFunc func(ctx context.Context, f File) error
+
+func (fn SinkFunc) Deliver(ctx context.Context, f File) error {
+	return fn(ctx, f)
+}
+
+// Processor atua sobre o arquivo antes do Sink. Pode alterar o File, recusar
+// a entrega retornando um erro ou agir depois que next terminar.
+type Processor interface {
+	Process(ctx context.Context, f File, next Sink) error
+}
+
+// ProcessorFunc adapta uma função comum a Processor.
+type ProcessorFunc func(ctx context.Context, f File, next Sink) error
+
+func (fn ProcessorFunc) Process(ctx context.Context, f File, next Sink) error {
+	return fn(ctx, f, next)
+}
+
+// Chain monta a cadeia de processadores na frente de s. O primeiro processor
+// é o primeiro a receber o arquivo.
+func Chain(s Sink, processors ...Processor) Sink {
+	for i := len(processors) - 1; i >= 0; i-- {
+		p, next := processors[i], s
+		s = SinkFunc(func(ctx context.Context, f File) error {
+			return p.Process(ctx, f, next)
+		})
+	}
+	return s
+}
@@ -0,0 +1,71 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestChainOrder(t *testing.T) {
+	var calls []string
+	tag := func(name string) Processor {
+		return ProcessorFunc(func(ctx context.Context, f File, next Sink) error {
+			calls = append(calls, name+">")
+			err := next.Deliver(ctx, f)
+			calls = append(calls, "<"+name)
+			return err
+		})
+	}
+	final := SinkFunc(func(ctx context.Context, f File) error {
+		calls = append(calls, "sink:"+f.RelPath)
+		return nil
+	})
+	if err := Chain(final, tag("a"), tag("b")).Deliver(context.Background(), File{RelPath: "x.txt"}); err != nil {
+		t.Fatalf("erro na entrega: %v", err)
+	}
+	if got := strings.Join(calls, " "); got != "a> b> sink:x.txt <b <a" {
+		t.Errorf("ordem incorreta: %s", got)
+	}
+}
+
+func TestChainVeto(t *testing.T) {
+	errVazio := errors.New("arquivo vazio")
+	delivered := false
+	final := SinkFunc(func(ctx context.Context, f File) error {
+		delivered = true
+		return nil
+	})
+	reject := ProcessorFunc(func(ctx context.Context, f File, next Sink) error {
+		if f.Info == nil || f.Info.Size() == 0 {
+			return errVazio
+		}
+		return next.Deliver(ctx, f)
+	})
+	if err := Chain(final, reject).Deliver(context.Background(), File{}); !errors.Is(err, errVazio) {
+		t.Errorf("esperado erro do processor, veio %v", err)
+	}
+	if delivered {
+		t.Errorf("sink não deveria ser chamado após recusa")
+	}
+}
+
+func TestDirDeliver(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "nota.xml")
+	os.WriteFile(src, []byte("abc"), 0644)
+	dest := t.TempDir()
+	var r Receipt
+	f := File{Source: src, Path: src, RelPath: filepath.Join("2024", "nota.xml"), Receipt: &r}
+	if err := (Dir{Path: dest}).Deliver(context.Background(), f); err != nil {
+		t.Fatalf("erro na entrega: %v", err)
+	}
+	want := filepath.Join(dest, "2024", "nota.xml")
+	if data, _ := os.ReadFile(want); string(data) != "abc" {
+		t.Errorf("conteúdo incorreto em %s: %q", want, data)
+	}
+	if r.Location != want || r.Checksum != "sha256:ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" {
+		t.Errorf("receipt incorreto: %+v", r)
+	}
+}
@@ -0,0 +1,144 @@
+package store
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+)
+
+// HasProcessed informa se o arquivo do tenant já foi registrado.
+func HasProcessed(db *sql.DB, tenant, file string) (bool, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(1) FROM processed_files WHERE tenant=? AND file=?", tenant, file).Scan(&count)
+	return count > 0, err
+}
+
+// Processed reúne os dados gravados em processed_files.
+type Processed struct {
+	ID          int64
+	Tenant      string
+	File        string
+	FileSize    int64
+	DestDir     string
+	DestPath    string // caminho final gravado (pode diferir do nome original)
+	SourceMtime int64  // UnixNano da origem no momento da cópia
+	Checksum    string // "algo:hex", ver sink.FileChecksum
+	DuplicateOf int64  // id do registro com o mesmo conteúdo (dedupe)
+	Method      string // copy, move, hardlink ou reflink
+	ETag        string // ETag do objeto quando o destino principal é remoto
+	StoredSize  int64  // bytes gravados no destino principal (comprimido, se houver compressão)
+	Compression string // gzip ou zstd quando o destino principal comprime
+	KeyID       string // chave da cifragem do destino principal, se houver
+	// Com batch, o arquivo é gravado no pacote ArchiveID como ArchiveMember.
+	// ArchiveID zero com ArchiveMember indica que o lote ainda está aberto.
+	ArchiveID     int64
+	ArchiveMember string
+	// ParentID aponta para o registro do pacote de onde o arquivo foi extraído.
+	ParentID int64
+	Route    string // regra de routes que escolheu o destino, se houver
+}
+
+// MarkProcessed registra o arquivo com o tamanho e o diretório de destino.
+func MarkProcessed(db *sql.DB, tenant, file string, fileSize int64, destDir string) error {
+	return SaveProcessed(db, Processed{Tenant: tenant, File: file, FileSize: fileSize, DestDir: destDir}, false)
+}
+
+// SaveProcessed registra o arquivo processado. Com replace, o registro
+// existente é atualizado (nova versão do mesmo arquivo).
+func SaveProcessed(db *sql.DB, rec Processed, replace bool) error {
+	query := "INSERT OR IGNORE INTO processed_files(tenant, file, file_size, dest_dir, dest_path, source_mtime, checksum, transfer_method, etag, stored_size, compression, key_id, archive_id, archive_member, parent_id, route) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	if replace {
+		query = `INSERT INTO processed_files(tenant, file, file_size, dest_dir, dest_path, source_mtime, checksum, transfer_method, etag, stored_size, compression, key_id, archive_id, archive_member, parent_id, route) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+            ON CONFLICT(tenant, file) DO UPDATE SET
+                processed_at = CURRENT_TIMESTAMP,
+                file_size = excluded.file_size,
+                dest_dir = excluded.dest_dir,
+                dest_path = excluded.dest_path,
+                source_mtime = excluded.source_mtime,
+                checksum = excluded.checksum,
+                transfer_method = excluded.transfer_method,
+                etag = excluded.etag,
+                stored_size = excluded.stored_size,
+                compression = excluded.compression,
+                key_id = excluded.key_id,
+                archive_id = excluded.archive_id,
+                archive_member = excluded.archive_member,
+                parent_id = excluded.parent_id,
+                route = excluded.route,
+                duplicate_of = NULL`
+	}
+	if rec.DestPath != "" && rec.DestDir == "" {
+		rec.DestDir = filepath.Dir(rec.DestPath)
+		// URLs (ex.: s3://bucket/chave) mantêm as barras duplas do esquema
+		if i := strings.LastIndex(rec.DestPath, "/"); strings.Contains(rec.DestPath, "://") && i > 0 {
+			rec.DestDir = rec.DestPath[:i]
+		}
+	}
+	_, err := db.Exec(query, rec.Tenant, rec.File, rec.FileSize, rec.DestDir, NullString(rec.DestPath), rec.SourceMtime, NullString(rec.Checksum), NullString(rec.Method), NullString(rec.ETag), NullInt(int(rec.StoredSize)), NullString(rec.Compression), NullString(rec.KeyID), NullInt(int(rec.ArchiveID)), NullString(rec.ArchiveMember), NullInt(int(rec.ParentID)), NullString(rec.Route))
+	return err
+}
+
+// StoredDestPath retorna o caminho gravado no destino. Registros anteriores à
+// coluna dest_path só têm o diretório; o nome é o da origem.
+func StoredDestPath(destPath, destDir sql.NullString, file string) string {
+	if destPath.Valid && destPath.String != "" {
+		return destPath.String
+	}
+	return filepath.Join(destDir.String, filepath.Base(file))
+}
+
+// NullString grava strings vazias como NULL.
+func NullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// NullInt grava zero como NULL.
+func NullInt(n int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(n), Valid: n != 0}
+}
+
+// RecordFailure registra uma falha de processamento para auditoria.
+func RecordFailure(db *sql.DB, tenant, file, reason string, cause error) error {
+	_, err := db.Exec(
+		"INSERT INTO file_failures(tenant, file, reason, error) VALUES (?, ?, ?, ?)",
+		tenant, file, reason, cause.Error(),
+	)
+	return err
+}
+
+// GetProcessed retorna o registro do arquivo, ou nil se ainda não processado.
+func GetProcessed(db *sql.DB, tenant, file string) (*Processed, error) {
+	rec := Processed{Tenant: tenant, File: file}
+	var fileSize, mtime, duplicateOf, storedSize, archiveID, parentID sql.NullInt64
+	var destDir, destPath, checksum, method, compression, keyID, member, route sql.NullString
+	err := db.QueryRow("SELECT id, file_size, dest_dir, dest_path, source_mtime, checksum, duplicate_of, transfer_method, stored_size, compression, key_id, archive_id, archive_member, parent_id, route FROM processed_files WHERE tenant=? AND file=?", tenant, file).
+		Scan(&rec.ID, &fileSize, &destDir, &destPath, &mtime, &checksum, &duplicateOf, &method, &storedSize, &compression, &keyID, &archiveID, &member, &parentID, &route)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	rec.FileSize, rec.DestDir, rec.SourceMtime, rec.Checksum = fileSize.Int64, destDir.String, mtime.Int64, checksum.String
+	rec.DuplicateOf, rec.Method = duplicateOf.Int64, method.String
+	rec.StoredSize, rec.Compression, rec.KeyID = storedSize.Int64, compression.String, keyID.String
+	rec.ArchiveID, rec.ArchiveMember, rec.ParentID = archiveID.Int64, member.String, parentID.Int64
+	rec.Route = route.String
+	if destDir.Valid {
+		rec.DestPath = StoredDestPath(destPath, destDir, file)
+	}
+	return &rec, nil
+}
+
+// RecordSkipped conta os arquivos ignorados pelos filtros do tenant.
+func RecordSkipped(db *sql.DB, tenant, file, reason string) error {
+	_, err := db.Exec(`
+        INSERT INTO skipped_files(tenant, file, reason, skip_count) VALUES (?, ?, ?, 1)
+        ON CONFLICT(tenant, file) DO UPDATE SET
+            reason = excluded.reason,
+            skip_count = skip_count + 1,
+            last_skipped_at = CURRENT_TIMESTAMP`,
+		tenant, file, reason,
+	)
+	return err
+}
@@ -0,0 +1,307 @@
+// Package store guarda o estado do filewatcher em SQLite: o esquema de todas
+// as tabelas e o registro dos arquivos processados.
+package store
+
+import (
+	"database/sql"
+	"fmt"
+
+	_ "modernc.org/sqlite"
+)
+
+func columnExists(db *sql.DB, table, column string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var cid int
+		var name, ctype string
+		var notnull, pk int
+		var dflt interface{}
+		rows.Scan(&cid, &name, &ctype, &notnull, &dflt, &pk)
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// DefaultPath é o banco usado pelo CLI, no diretório de trabalho.
+const DefaultPath = "./filewatcher.db"
+
+// Open abre o banco SQLite em path e aplica as migrações pendentes.
+func Open(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	if err := Migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Migrate cria as tabelas e adiciona colunas novas em bancos antigos.
+func Migrate(db *sql.DB) error {
+	// Cria tabela se não existir
+	_, err := db.Exec(`
+        CREATE TABLE IF NOT EXISTS processed_files (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            tenant TEXT,
+            file TEXT,
+            processed_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            file_size INTEGER,
+            dest_dir TEXT,
+            UNIQUE(tenant, file)
+        );
+    `)
+	if err != nil {
+		return err
+	}
+
+	// Adiciona colunas só se não existem
+	if ok, _ := columnExists(db, "processed_files", "file_size"); !ok {
+		db.Exec(`ALTER TABLE processed_files ADD COLUMN file_size INTEGER`)
+	}
+
+	if ok, _ := columnExists(db, "processed_files", "dest_dir"); !ok {
+		db.Exec(`ALTER TABLE processed_files ADD COLUMN dest_dir TEXT`)
+	}
+
+	if ok, _ := columnExists(db, "processed_files", "source_mtime"); !ok {
+		db.Exec(`ALTER TABLE processed_files ADD COLUMN source_mtime INTEGER`)
+	}
+
+	if ok, _ := columnExists(db, "processed_files", "checksum"); !ok {
+		db.Exec(`ALTER TABLE processed_files ADD COLUMN checksum TEXT`)
+	}
+
+	if ok, _ := columnExists(db, "processed_files", "duplicate_of"); !ok {
+		db.Exec(`ALTER TABLE processed_files ADD COLUMN duplicate_of INTEGER`)
+	}
+
+	if ok, _ := columnExists(db, "processed_files", "dest_path"); !ok {
+		db.Exec(`ALTER TABLE processed_files ADD COLUMN dest_path TEXT`)
+	}
+
+	if ok, _ := columnExists(db, "processed_files", "transfer_method"); !ok {
+		db.Exec(`ALTER TABLE processed_files ADD COLUMN transfer_method TEXT`)
+	}
+
+	if ok, _ := columnExists(db, "processed_files", "etag"); !ok {
+		db.Exec(`ALTER TABLE processed_files ADD COLUMN etag TEXT`)
+	}
+
+	if ok, _ := columnExists(db, "processed_files", "stored_size"); !ok {
+		db.Exec(`ALTER TABLE processed_files ADD COLUMN stored_size INTEGER`)
+	}
+
+	if ok, _ := columnExists(db, "processed_files", "compression"); !ok {
+		db.Exec(`ALTER TABLE processed_files ADD COLUMN compression TEXT`)
+	}
+
+	if ok, _ := columnExists(db, "processed_files", "key_id"); !ok {
+		db.Exec(`ALTER TABLE processed_files ADD COLUMN key_id TEXT`)
+	}
+
+	if ok, _ := columnExists(db, "processed_files", "archive_id"); !ok {
+		db.Exec(`ALTER TABLE processed_files ADD COLUMN archive_id INTEGER`)
+	}
+
+	if ok, _ := columnExists(db, "processed_files", "archive_member"); !ok {
+		db.Exec(`ALTER TABLE processed_files ADD COLUMN archive_member TEXT`)
+	}
+
+	if ok, _ := columnExists(db, "processed_files", "parent_id"); !ok {
+		db.Exec(`ALTER TABLE processed_files ADD COLUMN parent_id INTEGER`)
+	}
+
+	if ok, _ := columnExists(db, "processed_files", "route"); !ok {
+		db.Exec(`ALTER TABLE processed_files ADD COLUMN route TEXT`)
+	}
+
+	// Deduplicação por conteúdo consulta o checksum dentro do tenant
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_processed_files_checksum ON processed_files(tenant, checksum)`)
+	if err != nil {
+		return err
+	}
+
+	// Situação da entrega em cada destino do arquivo processado
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS deliveries (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            processed_id INTEGER REFERENCES processed_files(id) ON DELETE CASCADE,
+            destination TEXT,
+            dest_path TEXT,
+            status TEXT,
+            transfer_method TEXT,
+            checksum TEXT,
+            error TEXT,
+            delivered_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            UNIQUE(processed_id, destination)
+        );
+    `)
+	if err != nil {
+		return err
+	}
+
+	if ok, _ := columnExists(db, "deliveries", "etag"); !ok {
+		db.Exec(`ALTER TABLE deliveries ADD COLUMN etag TEXT`)
+	}
+
+	if ok, _ := columnExists(db, "deliveries", "stored_size"); !ok {
+		db.Exec(`ALTER TABLE deliveries ADD COLUMN stored_size INTEGER`)
+	}
+
+	if ok, _ := columnExists(db, "deliveries", "compression"); !ok {
+		db.Exec(`ALTER TABLE deliveries ADD COLUMN compression TEXT`)
+	}
+
+	if ok, _ := columnExists(db, "deliveries", "key_id"); !ok {
+		db.Exec(`ALTER TABLE deliveries ADD COLUMN key_id TEXT`)
+	}
+
+	if ok, _ := columnExists(db, "deliveries", "response_status"); !ok {
+		db.Exec(`ALTER TABLE deliveries ADD COLUMN response_status INTEGER`)
+	}
+
+	if ok, _ := columnExists(db, "deliveries", "response_body"); !ok {
+		db.Exec(`ALTER TABLE deliveries ADD COLUMN response_body TEXT`)
+	}
+
+	// Entregas de um arquivo ainda não registrado ficam sem processed_id,
+	// identificadas pelo tenant, pelo arquivo e pela versão da origem
+	if ok, _ := columnExists(db, "deliveries", "tenant"); !ok {
+		db.Exec(`ALTER TABLE deliveries ADD COLUMN tenant TEXT`)
+	}
+
+	if ok, _ := columnExists(db, "deliveries", "file"); !ok {
+		db.Exec(`ALTER TABLE deliveries ADD COLUMN file TEXT`)
+	}
+
+	if ok, _ := columnExists(db, "deliveries", "source_size"); !ok {
+		db.Exec(`ALTER TABLE deliveries ADD COLUMN source_size INTEGER`)
+	}
+
+	if ok, _ := columnExists(db, "deliveries", "source_mtime"); !ok {
+		db.Exec(`ALTER TABLE deliveries ADD COLUMN source_mtime INTEGER`)
+	}
+
+	_, err = db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_deliveries_pending ON deliveries(tenant, file, destination) WHERE processed_id IS NULL`)
+	if err != nil {
+		return err
+	}
+
+	// Pacotes gerados pelo lote; os membros apontam para cá por archive_id
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS archives (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            tenant TEXT,
+            path TEXT,
+            format TEXT,
+            file_count INTEGER,
+            total_size INTEGER,
+            stored_size INTEGER,
+            checksum TEXT,
+            reason TEXT,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+        );
+    `)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS skipped_files (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            tenant TEXT,
+            file TEXT,
+            reason TEXT,
+            skip_count INTEGER DEFAULT 0,
+            last_skipped_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            UNIQUE(tenant, file)
+        );
+    `)
+	if err != nil {
+		return err
+	}
+
+	// Arquivos com entrega pendente de nova tentativa
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS jobs (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            tenant TEXT,
+            file TEXT,
+            status TEXT,
+            attempts INTEGER DEFAULT 0,
+            last_error TEXT,
+            next_attempt_at DATETIME,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            UNIQUE(tenant, file)
+        );
+    `)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS file_failures (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            tenant TEXT,
+            file TEXT,
+            reason TEXT,
+            error TEXT,
+            failed_at DATETIME DEFAULT CURRENT_TIMESTAMP
+        );
+    `)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS dead_letters (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            tenant TEXT,
+            file TEXT,
+            failed_path TEXT,
+            reason TEXT,
+            error TEXT,
+            attempts INTEGER,
+            first_failed_at DATETIME,
+            quarantined_at DATETIME,
+            requeued_at DATETIME
+        );
+    `)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS hook_runs (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            processed_id INTEGER REFERENCES processed_files(id) ON DELETE CASCADE,
+            tenant TEXT,
+            file TEXT,
+            destination TEXT,
+            hook TEXT,
+            exit_code INTEGER,
+            output TEXT,
+            error TEXT,
+            duration_ms INTEGER,
+            ran_at DATETIME DEFAULT CURRENT_TIMESTAMP
+        );
+    `)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_hook_runs_processed ON hook_runs(processed_id)`)
+	if err != nil {
+		return err
+	}
+	// Rename de coluna não incluso por ser mais complexo em SQLite
+	return nil
+}
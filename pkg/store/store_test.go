@@ -0,0 +1,86 @@
+package store
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+)
+
+func TestMarkAndHasProcessed(t *testing.T) {
+	dbFile, err := os.CreateTemp("", "filewatcher-*.db")
+	if err != nil {
+		t.Fatalf("erro ao criar db: %v", err)
+	}
+	dbFileName := dbFile.Name()
+	dbFile.Close()
+	os.Remove(dbFileName) // garante que não existe
+	defer os.Remove(dbFileName)
+
+	db, err := sql.Open("sqlite", dbFileName)
+	if err != nil {
+		t.Fatalf("erro ao iniciar db: %v", err)
+	}
+	defer db.Close()
+
+	// Cria a tabela manualmente para garantir isolamento
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS processed_files (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		tenant TEXT,
+		file TEXT,
+		processed_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		file_size INTEGER,
+		dest_dir TEXT,
+		UNIQUE(tenant, file)
+	);`)
+	if err != nil {
+		t.Fatalf("erro ao criar tabela: %v", err)
+	}
+	// Aplica as migrações sobre o schema antigo
+	if err := Migrate(db); err != nil {
+		t.Fatalf("erro ao migrar tabela: %v", err)
+	}
+
+	tenant := "tenantTest"
+	file := "/tmp/testfile.txt"
+	processed, err := HasProcessed(db, tenant, file)
+	if err != nil {
+		t.Fatalf("erro ao checar HasProcessed: %v", err)
+	}
+	if processed {
+		t.Errorf("esperado não processado")
+	}
+	if err := MarkProcessed(db, tenant, file, 123, "/tmp/dest"); err != nil {
+		t.Fatalf("erro ao marcar processado: %v", err)
+	}
+	processed, err = HasProcessed(db, tenant, file)
+	if err != nil {
+		t.Fatalf("erro ao checar HasProcessed: %v", err)
+	}
+	if !processed {
+		t.Errorf("esperado processado")
+	}
+}
+
+func TestSaveProcessedReplace(t *testing.T) {
+	db, err := Open(t.TempDir() + "/filewatcher.db")
+	if err != nil {
+		t.Fatalf("erro ao iniciar db: %v", err)
+	}
+	defer db.Close()
+
+	rec := Processed{Tenant: "t", File: "/in/a.csv", FileSize: 10, DestPath: "/out/a.csv.age", Checksum: "sha256:aa", KeyID: "k1"}
+	if err := SaveProcessed(db, rec, false); err != nil {
+		t.Fatalf("erro ao registrar: %v", err)
+	}
+	rec.FileSize, rec.Checksum, rec.KeyID = 20, "sha256:bb", "k2"
+	if err := SaveProcessed(db, rec, true); err != nil {
+		t.Fatalf("erro ao substituir: %v", err)
+	}
+	got, err := GetProcessed(db, "t", "/in/a.csv")
+	if err != nil || got == nil {
+		t.Fatalf("registro não encontrado: %v", err)
+	}
+	if got.FileSize != 20 || got.Checksum != "sha256:bb" || got.KeyID != "k2" {
+		t.Errorf("nova versão não gravada: %+v", got)
+	}
+}
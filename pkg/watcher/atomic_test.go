@@ -0,0 +1,35 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/thiagozs/go-filewatcher/pkg/sink"
+)
+
+func TestSyncCleansLeftoverTempFiles(t *testing.T) {
+	db, err := initDB(t)
+	if err != nil {
+		t.Fatalf("erro ao iniciar db: %v", err)
+	}
+	defer db.Close()
+
+	watchDir := t.TempDir()
+	destDir := t.TempDir()
+	leftover := filepath.Join(destDir, sink.TempFilePrefix+"nota.xml-123456")
+	os.WriteFile(leftover, []byte("<nota"), 0644)
+
+	tenant := TenantConfig{Name: "tenantTempCleanup", WatchDir: watchDir, DestDir: destDir}
+	if err := syncTenantDirs(db, tenant); err != nil {
+		t.Fatalf("erro no syncTenantDirs: %v", err)
+	}
+	if fileExists(leftover) {
+		t.Errorf("temporário de cópia interrompida não removido")
+	}
+	var count int
+	db.QueryRow("SELECT COUNT(1) FROM processed_files WHERE tenant = ?", tenant.Name).Scan(&count)
+	if count != 0 {
+		t.Errorf("temporário registrado como processado")
+	}
+}
@@ -0,0 +1,425 @@
+package watcher
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thiagozs/go-filewatcher/pkg/sink"
+	"github.com/thiagozs/go-filewatcher/pkg/store"
+)
+
+// Motivos de fechamento do lote, gravados em archives.reason.
+const (
+	batchMaxFiles = "max_files"
+	batchMaxSize  = "max_size"
+	batchWindow   = "window"
+)
+
+// Diretório padrão, dentro do dest_dir, onde os arquivos esperam o lote.
+const defaultStagingDir = ".gfw-batch"
+
+// BatchConfig agrupa os arquivos prontos do tenant em pacotes (tar.gz ou
+// zip) gravados no dest_dir, em vez de entregar um a um. Os arquivos esperam
+// na staging_dir até o lote atingir max_files, max_size ou window (tempo
+// desde o primeiro arquivo do lote).
+type BatchConfig struct {
+	Format     string   `yaml:"format"` // tar.gz (padrão) ou zip
+	MaxFiles   int      `yaml:"max_files"`
+	MaxSize    ByteSize `yaml:"max_size"`
+	Window     Duration `yaml:"window"`
+	Prefix     string   `yaml:"prefix"`      // padrão: nome do tenant
+	StagingDir string   `yaml:"staging_dir"` // padrão: <dest_dir>/.gfw-batch
+
+	// Serializa a entrada no lote e o fechamento entre workers e o timer
+	mu sync.Mutex
+}
+
+// ByteSize aceita valores como "512KB", "100MB" ou "2GB" (múltiplos de 1024)
+// no YAML. Números sem unidade são bytes.
+type ByteSize int64
+
+func (b *ByteSize) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	v, err := parseByteSize(s)
+	if err != nil {
+		return err
+	}
+	*b = v
+	return nil
+}
+
+func parseByteSize(s string) (ByteSize, error) {
+	v := strings.ToUpper(strings.TrimSpace(s))
+	mult := int64(1)
+	for _, u := range []struct {
+		suffix string
+		mult   int64
+	}{{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(v, u.suffix) {
+			v, mult = strings.TrimSpace(strings.TrimSuffix(v, u.suffix)), u.mult
+			break
+		}
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return ByteSize(n * mult), nil
+}
+
+func validateBatch(tc TenantConfig) error {
+	c := tc.Batch
+	if c == nil {
+		return nil
+	}
+	switch c.Format {
+	case "", sink.ArchiveTarGz, sink.ArchiveZip:
+	default:
+		return fmt.Errorf("unknown batch format %q", c.Format)
+	}
+	if c.MaxFiles < 0 || c.MaxSize < 0 || c.Window < 0 {
+		return fmt.Errorf("batch limits must not be negative")
+	}
+	if c.MaxFiles == 0 && c.MaxSize == 0 && c.Window == 0 {
+		return fmt.Errorf("batch requires max_files, max_size or window")
+	}
+	if tc.DestDir == "" {
+		return fmt.Errorf("batch requires dest_dir")
+	}
+	dests := tc.destinations()
+	if len(dests) > 1 || (dests[0].Type != "" && dests[0].Type != destinationLocal) {
+		return fmt.Errorf("batch requires a single local destination")
+	}
+	ptc := tc.forDestination(dests[0])
+	if ptc.DestTemplate != "" || ptc.Compress != nil || ptc.Encrypt != nil {
+		return fmt.Errorf("batch cannot be combined with dest_template, compress or encrypt")
+	}
+	if tc.Hooks.PreCopy != nil || tc.Hooks.PostCopy != nil {
+		return fmt.Errorf("batch does not run pre_copy or post_copy hooks")
+	}
+	rel, err := filepath.Rel(tc.WatchDir, batchStagingDir(tc))
+	if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("batch staging_dir must be outside watch_dir")
+	}
+	return nil
+}
+
+func (c *BatchConfig) format() string {
+	if c.Format == "" {
+		return sink.ArchiveTarGz
+	}
+	return c.Format
+}
+
+func batchStagingDir(tc TenantConfig) string {
+	if tc.Batch.StagingDir != "" {
+		return tc.Batch.StagingDir
+	}
+	return filepath.Join(tc.DestDir, defaultStagingDir)
+}
+
+// stageFile guarda o arquivo pronto na staging_dir e o registra como membro
+// do lote aberto (archive_member sem archive_id). Se o lote atingir um dos
+// limites, o pacote é gravado em seguida.
+func stageFile(db *sql.DB, tc TenantConfig, name string, fi os.FileInfo, prev *store.Processed, replace, keepSource bool) error {
+	tc.Batch.mu.Lock()
+	defer tc.Batch.mu.Unlock()
+	// Uma nova versão do arquivo ainda no lote aberto substitui a anterior
+	if prev != nil && prev.ArchiveMember != "" && prev.ArchiveID == 0 {
+		os.Remove(prev.DestPath)
+	}
+	dir := batchStagingDir(tc)
+	staged := filepath.Join(dir, relPath(tc, name))
+	// O nome do manifesto é reservado na raiz do pacote
+	if fileExists(staged) || relPath(tc, name) == sink.ManifestName {
+		staged = renamedDest(staged, "", time.Now())
+	}
+	method, sum, err := transferFile(tc, name, staged, keepSource, sink.Encoding{})
+	if err != nil {
+		log.Printf("[%s] Failed to stage %s for batch: %v", tc.Name, name, err)
+		return fmt.Errorf("%w: batch: %v", errDeliveryFailed, err)
+	}
+	member, _ := filepath.Rel(dir, staged)
+	rec := store.Processed{
+		Tenant:        tc.Name,
+		File:          name,
+		FileSize:      fi.Size(),
+		DestPath:      staged,
+		SourceMtime:   fi.ModTime().UnixNano(),
+		Checksum:      sum,
+		Method:        method,
+		ArchiveMember: filepath.ToSlash(member),
+	}
+	if err := store.SaveProcessed(db, rec, replace); err != nil {
+		log.Printf("[%s] Failed to mark file as processed: %v", tc.Name, err)
+	}
+	log.Printf("[%s] Staged %s for the next batch (%s)", tc.Name, name, sink.ShortChecksum(sum))
+	removeSentinel(tc, name)
+	if method != transferMove {
+		releaseSource(tc, name, keepSource)
+	}
+	if _, err := flushBatch(db, tc, time.Now()); err != nil {
+		log.Printf("[%s] Failed to write batch: %v", tc.Name, err)
+	}
+	return nil
+}
+
+// batchMember é um arquivo do lote aberto.
+type batchMember struct {
+	ID       int64
+	File     string
+	Staged   string
+	Name     string
+	Size     int64
+	Checksum string
+	StagedAt time.Time
+}
+
+func pendingMembers(db *sql.DB, tenant string) ([]batchMember, error) {
+	rows, err := db.Query(`SELECT id, file, dest_path, archive_member, COALESCE(file_size, 0), COALESCE(checksum, ''),
+            CAST(strftime('%s', processed_at) AS INTEGER)
+        FROM processed_files WHERE tenant = ? AND archive_member IS NOT NULL AND archive_id IS NULL ORDER BY id`, tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var members []batchMember
+	for rows.Next() {
+		var m batchMember
+		var stagedAt int64
+		if err := rows.Scan(&m.ID, &m.File, &m.Staged, &m.Name, &m.Size, &m.Checksum, &stagedAt); err != nil {
+			return nil, err
+		}
+		m.StagedAt = time.Unix(stagedAt, 0)
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// batchDue retorna o limite atingido pelo lote aberto, ou "" se ele ainda
+// deve esperar.
+func batchDue(c *BatchConfig, members []batchMember, now time.Time) string {
+	if len(members) == 0 {
+		return ""
+	}
+	var size int64
+	oldest := now
+	for _, m := range members {
+		size += m.Size
+		if m.StagedAt.Before(oldest) {
+			oldest = m.StagedAt
+		}
+	}
+	switch {
+	case c.MaxFiles > 0 && len(members) >= c.MaxFiles:
+		return batchMaxFiles
+	case c.MaxSize > 0 && size >= int64(c.MaxSize):
+		return batchMaxSize
+	case c.Window > 0 && now.Sub(oldest) >= time.Duration(c.Window):
+		return batchWindow
+	}
+	return ""
+}
+
+// flushBatch grava o pacote do lote aberto se algum limite foi atingido e
+// retorna o caminho do pacote. Deve ser chamado com tc.Batch.mu travado.
+func flushBatch(db *sql.DB, tc TenantConfig, now time.Time) (string, error) {
+	members, err := pendingMembers(db, tc.Name)
+	if err != nil {
+		return "", err
+	}
+	reason := batchDue(tc.Batch, members, now)
+	if reason == "" {
+		return "", nil
+	}
+	return writeBatch(db, tc, members, reason, now)
+}
+
+// flushDueBatch fecha o lote aberto do tenant se a janela já passou. Usado
+// pelo timer e pela sincronização ao iniciar.
+func flushDueBatch(db *sql.DB, tc TenantConfig, now time.Time) {
+	tc.Batch.mu.Lock()
+	defer tc.Batch.mu.Unlock()
+	if _, err := flushBatch(db, tc, now); err != nil {
+		log.Printf("[%s] Failed to write batch: %v", tc.Name, err)
+	}
+}
+
+// runBatchTimer fecha o lote quando a janela expira, mesmo sem novas
+// chegadas, até ctx ser cancelado.
+func runBatchTimer(ctx context.Context, db *sql.DB, tc TenantConfig) {
+	tick := time.Duration(tc.Batch.Window) / 10
+	if tick < 100*time.Millisecond {
+		tick = 100 * time.Millisecond
+	}
+	if tick > time.Minute {
+		tick = time.Minute
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			flushDueBatch(db, tc, now)
+		}
+	}
+}
+
+// batchManifest é o MANIFEST.json gravado como primeira entrada do pacote.
+type batchManifest struct {
+	Tenant    string          `json:"tenant"`
+	Archive   string          `json:"archive"`
+	Reason    string          `json:"reason"`
+	CreatedAt time.Time       `json:"created_at"`
+	Files     []manifestEntry `json:"files"`
+}
+
+type manifestEntry struct {
+	ID       int64  `json:"id"` // id em processed_files
+	Name     string `json:"name"`
+	Source   string `json:"source"`
+	Size     int64  `json:"size"`
+	Checksum string `json:"checksum"`
+}
+
+// writeBatch grava o pacote com os membros do lote, registra em archives e
+// aponta cada membro para ele. Os arquivos da staging_dir só são apagados
+// depois do registro.
+func writeBatch(db *sql.DB, tc TenantConfig, members []batchMember, reason string, now time.Time) (string, error) {
+	var entries []sink.ArchiveEntry
+	var included []batchMember
+	var total int64
+	for _, m := range members {
+		if !fileExists(m.Staged) {
+			log.Printf("[%s] Staged copy %s of %s is missing. Leaving it out of the batch.", tc.Name, m.Staged, m.File)
+			if err := store.RecordFailure(db, tc.Name, m.File, "batch_missing", fmt.Errorf("staged copy %s not found", m.Staged)); err != nil {
+				log.Printf("[%s] Failed to record failure: %v", tc.Name, err)
+			}
+			db.Exec("UPDATE processed_files SET archive_member = NULL WHERE id = ?", m.ID)
+			continue
+		}
+		entries = append(entries, sink.ArchiveEntry{Name: m.Name, Path: m.Staged})
+		included = append(included, m)
+		total += m.Size
+	}
+	if len(included) == 0 {
+		return "", nil
+	}
+	format := tc.Batch.format()
+	dst := batchArchivePath(tc, format, now)
+	manifest := batchManifest{Tenant: tc.Name, Archive: filepath.Base(dst), Reason: reason, CreatedAt: now.UTC()}
+	for _, m := range included {
+		manifest.Files = append(manifest.Files, manifestEntry{ID: m.ID, Name: m.Name, Source: m.File, Size: m.Size, Checksum: m.Checksum})
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := sink.WriteArchive(dst, format, data, entries); err != nil {
+		return "", err
+	}
+	sum, err := sink.FileChecksum(dst, tc.Checksum)
+	if err != nil {
+		return "", err
+	}
+	var stored int64
+	if fi, err := os.Stat(dst); err == nil {
+		stored = fi.Size()
+	}
+	if err := recordBatch(db, tc, dst, format, reason, total, stored, sum, included); err != nil {
+		// Sem o registro os membros continuam no lote aberto
+		os.Remove(dst)
+		return "", err
+	}
+	for _, m := range included {
+		if err := os.Remove(m.Staged); err != nil {
+			log.Printf("[%s] Failed to remove staged copy %s: %v", tc.Name, m.Staged, err)
+		}
+	}
+	log.Printf("[%s] Wrote batch %s with %d files (%s, %s reached)", tc.Name, dst, len(included), humanSize(total), reason)
+	return dst, nil
+}
+
+// batchArchivePath monta o nome do pacote (<prefix>-<horário><ext>) no
+// dest_dir, com sufixo numérico se já existir.
+func batchArchivePath(tc TenantConfig, format string, now time.Time) string {
+	prefix := tc.Batch.Prefix
+	if prefix == "" {
+		prefix = tc.Name
+	}
+	stem := filepath.Join(tc.DestDir, prefix+"-"+now.Format(conflictTimeLayout))
+	ext := sink.ArchiveExt(format)
+	dst := stem + ext
+	for i := 1; fileExists(dst); i++ {
+		dst = stem + "-" + strconv.Itoa(i) + ext
+	}
+	return dst
+}
+
+func recordBatch(db *sql.DB, tc TenantConfig, dst, format, reason string, total, stored int64, sum string, members []batchMember) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(
+		"INSERT INTO archives(tenant, path, format, file_count, total_size, stored_size, checksum, reason) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		tc.Name, dst, format, len(members), total, stored, sum, reason,
+	)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	for _, m := range members {
+		if _, err := tx.Exec("UPDATE processed_files SET archive_id = ?, dest_path = ?, dest_dir = ? WHERE id = ?", id, dst, filepath.Dir(dst), m.ID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// recopyFromArchive extrai do pacote, para o diretório dele, a cópia de um
+// arquivo processado com batch e confere com o checksum registrado.
+// Arquivos do lote ainda aberto continuam na staging_dir.
+func recopyFromArchive(db *sql.DB, tc TenantConfig, id int, archiveID sql.NullInt64, member, want string) {
+	if !archiveID.Valid {
+		log.Printf("[Recopy] File id %d is waiting in the open batch. Nothing to recopy.", id)
+		return
+	}
+	var archive, format string
+	if err := db.QueryRow("SELECT path, format FROM archives WHERE id = ?", archiveID.Int64).Scan(&archive, &format); err != nil {
+		log.Printf("[Recopy] Failed to find archive of file id %d: %v", id, err)
+		return
+	}
+	algo := tc.Checksum
+	if want != "" {
+		algo, _ = sink.SplitChecksum(want)
+	}
+	dst := filepath.Join(filepath.Dir(archive), filepath.FromSlash(member))
+	sum, err := sink.ExtractMemberFile(archive, format, member, dst, algo)
+	if err != nil {
+		log.Printf("[Recopy] Failed to extract file id %d from %s: %v", id, archive, err)
+		return
+	}
+	log.Printf("[Recopy] Extracted file id %d from %s: %s (%s)", id, archive, dst, sink.ShortChecksum(sum))
+	if want != "" && sum != want {
+		log.Printf("[Recopy] Warning: extracted content of file id %d differs from the recorded checksum (%s)", id, sink.ShortChecksum(want))
+	}
+}
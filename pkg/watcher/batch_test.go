@@ -0,0 +1,226 @@
+package watcher
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/thiagozs/go-filewatcher/pkg/sink"
+	"github.com/thiagozs/go-filewatcher/pkg/store"
+	"gopkg.in/yaml.v2"
+)
+
+func TestBatchValidation(t *testing.T) {
+	cases := map[string]TenantConfig{
+		"sem limite":       {Batch: &BatchConfig{}},
+		"formato inválido": {Batch: &BatchConfig{Format: "rar", MaxFiles: 10}},
+		"limite negativo":  {Batch: &BatchConfig{MaxFiles: -1}},
+		"com compress":     {Batch: &BatchConfig{MaxFiles: 10}, Compress: &CompressConfig{Algorithm: "gzip"}},
+		"vários destinos":  {Batch: &BatchConfig{MaxFiles: 10}, DestDir: "", Destinations: []DestinationConfig{{Name: "a", Path: "/tmp/a"}, {Name: "b", Path: "/tmp/b"}}},
+		"staging no watch": {Batch: &BatchConfig{MaxFiles: 10, StagingDir: "/tmp/in/.batch"}},
+		"hook por arquivo": {Batch: &BatchConfig{MaxFiles: 10}, Hooks: HooksConfig{PostCopy: &HookConfig{Command: []string{"true"}}}},
+		"destino sem dest": {Batch: &BatchConfig{MaxFiles: 10}, DestDir: "-"},
+	}
+	for name, tc := range cases {
+		tc.Name, tc.WatchDir = "x", "/tmp/in"
+		switch {
+		case tc.DestDir == "-":
+			tc.DestDir = ""
+		case tc.DestDir == "" && len(tc.Destinations) == 0:
+			tc.DestDir = "/tmp/out"
+		}
+		cfg := &Config{Tenants: []TenantConfig{tc}}
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%s: esperado erro", name)
+		}
+	}
+
+	var cfg struct {
+		Batch BatchConfig `yaml:"batch"`
+	}
+	if err := yaml.Unmarshal([]byte("batch:\n  max_size: 100MB\n  window: 1h\n"), &cfg); err != nil || cfg.Batch.MaxSize != 100<<20 {
+		t.Errorf("max_size não interpretado: %v %d", err, cfg.Batch.MaxSize)
+	}
+	for s, want := range map[string]ByteSize{"512": 512, "2kb": 2048, "1 GB": 1 << 30} {
+		if got, err := parseByteSize(s); err != nil || got != want {
+			t.Errorf("%q: esperado %d, obtido %d (%v)", s, want, got, err)
+		}
+	}
+	if _, err := parseByteSize("dez MB"); err == nil {
+		t.Errorf("esperado erro para tamanho inválido")
+	}
+}
+
+func TestBatchArchivesByCount(t *testing.T) {
+	db, err := initDB(t)
+	if err != nil {
+		t.Fatalf("erro ao iniciar db: %v", err)
+	}
+	defer db.Close()
+
+	for _, format := range []string{sink.ArchiveTarGz, sink.ArchiveZip} {
+		tc := TenantConfig{
+			Name:      "tenantBatch-" + format,
+			WatchDir:  t.TempDir(),
+			DestDir:   t.TempDir(),
+			Readiness: ReadinessConfig{Strategy: readinessCloseWrite},
+			Batch:     &BatchConfig{Format: format, MaxFiles: 3, Prefix: "mainframe"},
+		}
+		cfg := &Config{Tenants: []TenantConfig{tc}}
+		if err := cfg.Validate(); err != nil {
+			t.Fatalf("erro ao validar: %v", err)
+		}
+		tc = cfg.Tenants[0]
+		filter, _ := newFileFilter(tc)
+		content := map[string]string{"a.csv": "1;a\n", "b.csv": "2;b\n", "c.csv": "3;c\n"}
+		for i, n := range []string{"a.csv", "b.csv", "c.csv"} {
+			name := filepath.Join(tc.WatchDir, n)
+			os.WriteFile(name, []byte(content[n]), 0644)
+			if err := handleFile(context.Background(), db, tc, filter, name, false, evCreate); err != nil {
+				t.Fatalf("erro no handleFile: %v", err)
+			}
+			archives, _ := filepath.Glob(filepath.Join(tc.DestDir, "mainframe-*"+sink.ArchiveExt(format)))
+			if i < 2 && len(archives) != 0 {
+				t.Fatalf("%s: pacote gravado antes de max_files: %v", format, archives)
+			}
+			if i == 2 && len(archives) != 1 {
+				t.Fatalf("%s: esperado um pacote, obtido %v", format, archives)
+			}
+		}
+		rec, _ := store.GetProcessed(db, tc.Name, filepath.Join(tc.WatchDir, "b.csv"))
+		if rec == nil || rec.ArchiveID == 0 || rec.ArchiveMember != "b.csv" || filepath.Dir(rec.DestPath) != tc.DestDir {
+			t.Fatalf("%s: membro não registrado: %+v", format, rec)
+		}
+		var count int
+		var reason string
+		db.QueryRow("SELECT file_count, reason FROM archives WHERE id = ?", rec.ArchiveID).Scan(&count, &reason)
+		if count != 3 || reason != batchMaxFiles {
+			t.Errorf("%s: pacote registrado incorretamente: %d %s", format, count, reason)
+		}
+		if left, _ := os.ReadDir(batchStagingDir(tc)); len(left) != 0 {
+			t.Errorf("%s: staging não foi esvaziada: %d arquivos", format, len(left))
+		}
+
+		var buf bytes.Buffer
+		if _, err := sink.ExtractMember(&buf, rec.DestPath, format, sink.ManifestName, ""); err != nil {
+			t.Fatalf("%s: manifesto ausente: %v", format, err)
+		}
+		var manifest batchManifest
+		if err := json.Unmarshal(buf.Bytes(), &manifest); err != nil || len(manifest.Files) != 3 || manifest.Files[1].Checksum != rec.Checksum {
+			t.Errorf("%s: manifesto incorreto: %v %s", format, err, buf.String())
+		}
+
+		// --recopy extrai o membro do pacote e confere o checksum
+		if err := recopyFiles(db, cfg, tc.Name, "", []int{int(rec.ID)}, false); err != nil {
+			t.Fatalf("%s: erro no recopy: %v", format, err)
+		}
+		if b, _ := os.ReadFile(filepath.Join(tc.DestDir, "b.csv")); string(b) != content["b.csv"] {
+			t.Errorf("%s: recopy não extraiu o membro: %q", format, b)
+		}
+		// Apagar um membro não apaga o pacote
+		if err := deleteProcessedFiles(db, cfg, tc.Name, []int{int(rec.ID)}); err != nil || !fileExists(rec.DestPath) {
+			t.Errorf("%s: pacote removido junto com o membro: %v", format, err)
+		}
+	}
+}
+
+func TestBatchWindow(t *testing.T) {
+	db, err := initDB(t)
+	if err != nil {
+		t.Fatalf("erro ao iniciar db: %v", err)
+	}
+	defer db.Close()
+
+	tc := TenantConfig{
+		Name:      "tenantBatchWindow",
+		WatchDir:  t.TempDir(),
+		DestDir:   t.TempDir(),
+		Readiness: ReadinessConfig{Strategy: readinessCloseWrite},
+		Batch:     &BatchConfig{Window: Duration(time.Hour), MaxSize: 1 << 20},
+	}
+	cfg := &Config{Tenants: []TenantConfig{tc}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("erro ao validar: %v", err)
+	}
+	tc = cfg.Tenants[0]
+	filter, _ := newFileFilter(tc)
+	name := filepath.Join(tc.WatchDir, "relatorio.txt")
+	os.WriteFile(name, []byte("primeira versão"), 0644)
+	handleFile(context.Background(), db, tc, filter, name, false, evCreate)
+	// Nova versão no mesmo lote substitui a anterior na staging
+	os.WriteFile(name, []byte("segunda versão"), 0644)
+	tc.Events.RenameAsArrival = true
+	handleFile(context.Background(), db, tc, filter, name, false, evMovedTo)
+	members, _ := pendingMembers(db, tc.Name)
+	if len(members) != 1 {
+		t.Fatalf("esperado um membro pendente, obtido %d", len(members))
+	}
+	if staged, _ := os.ReadDir(batchStagingDir(tc)); len(staged) != 1 {
+		t.Errorf("versão anterior ficou na staging: %d arquivos", len(staged))
+	}
+	if reason := batchDue(tc.Batch, members, time.Now()); reason != "" {
+		t.Fatalf("lote não deveria fechar antes da janela: %s", reason)
+	}
+
+	flushDueBatch(db, tc, time.Now().Add(2*time.Hour))
+	rec, _ := store.GetProcessed(db, tc.Name, name)
+	if rec == nil || rec.ArchiveID == 0 {
+		t.Fatalf("janela não fechou o lote: %+v", rec)
+	}
+	if b, err := extractString(rec.DestPath, rec.ArchiveMember); err != nil || b != "segunda versão" {
+		t.Errorf("pacote sem a última versão: %q %v", b, err)
+	}
+}
+
+func TestBatchReservesManifestName(t *testing.T) {
+	db, err := initDB(t)
+	if err != nil {
+		t.Fatalf("erro ao iniciar db: %v", err)
+	}
+	defer db.Close()
+
+	tc := TenantConfig{
+		Name:      "tenantBatchManifest",
+		WatchDir:  t.TempDir(),
+		DestDir:   t.TempDir(),
+		Readiness: ReadinessConfig{Strategy: readinessCloseWrite},
+		Batch:     &BatchConfig{MaxFiles: 2},
+	}
+	cfg := &Config{Tenants: []TenantConfig{tc}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("erro ao validar: %v", err)
+	}
+	tc = cfg.Tenants[0]
+	filter, _ := newFileFilter(tc)
+	// Um arquivo chamado MANIFEST.json não pode se confundir com o manifesto
+	name := filepath.Join(tc.WatchDir, sink.ManifestName)
+	os.WriteFile(name, []byte(`{"do":"parceiro"}`), 0644)
+	handleFile(context.Background(), db, tc, filter, name, false, evCreate)
+	other := filepath.Join(tc.WatchDir, "a.csv")
+	os.WriteFile(other, []byte("1;a\n"), 0644)
+	handleFile(context.Background(), db, tc, filter, other, false, evCreate)
+
+	rec, _ := store.GetProcessed(db, tc.Name, name)
+	if rec == nil || rec.ArchiveID == 0 || rec.ArchiveMember == sink.ManifestName {
+		t.Fatalf("membro com o nome do manifesto não foi renomeado: %+v", rec)
+	}
+	if b, err := extractString(rec.DestPath, rec.ArchiveMember); err != nil || b != `{"do":"parceiro"}` {
+		t.Errorf("conteúdo do membro incorreto: %q %v", b, err)
+	}
+	var buf bytes.Buffer
+	sink.ExtractMember(&buf, rec.DestPath, sink.ArchiveTarGz, sink.ManifestName, "")
+	var manifest batchManifest
+	if err := json.Unmarshal(buf.Bytes(), &manifest); err != nil || len(manifest.Files) != 2 {
+		t.Errorf("manifesto incorreto: %v %s", err, buf.String())
+	}
+}
+
+func extractString(archive, member string) (string, error) {
+	var buf bytes.Buffer
+	_, err := sink.ExtractMember(&buf, archive, sink.ArchiveTarGz, member, "")
+	return buf.String(), err
+}
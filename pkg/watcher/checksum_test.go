@@ -0,0 +1,45 @@
+package watcher
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/thiagozs/go-filewatcher/pkg/sink"
+	"github.com/thiagozs/go-filewatcher/pkg/store"
+)
+
+func TestHandleFileStoresChecksum(t *testing.T) {
+	db, err := initDB(t)
+	if err != nil {
+		t.Fatalf("erro ao iniciar db: %v", err)
+	}
+	defer db.Close()
+
+	watchDir := t.TempDir()
+	tc := TenantConfig{
+		Name:      "tenantChecksum",
+		WatchDir:  watchDir,
+		DestDir:   t.TempDir(),
+		Checksum:  sink.ChecksumBlake3,
+		Readiness: ReadinessConfig{Strategy: readinessCloseWrite},
+	}
+	filter, _ := newFileFilter(tc)
+	name := filepath.Join(watchDir, "lote.csv")
+	os.WriteFile(name, []byte("1;2;3"), 0644)
+	want, _ := sink.FileChecksum(name, sink.ChecksumBlake3)
+
+	handleFile(context.Background(), db, tc, filter, name, false, evCreate)
+
+	rec, err := store.GetProcessed(db, tc.Name, name)
+	if err != nil || rec == nil {
+		t.Fatalf("arquivo não registrado: %v", err)
+	}
+	if rec.Checksum != want {
+		t.Errorf("checksum gravado %q, esperado %q", rec.Checksum, want)
+	}
+	if fileExists(name) {
+		t.Errorf("origem deveria ser removida após cópia verificada")
+	}
+}
@@ -1,9 +1,11 @@
-package main
+package watcher
 
 import (
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/thiagozs/go-filewatcher/pkg/store"
 )
 
 func TestMultiTenants(t *testing.T) {
@@ -14,7 +16,7 @@ func TestMultiTenants(t *testing.T) {
 	os.Remove(dbFile.Name())
 	defer os.Remove(dbFile.Name())
 
-	db, err := initDB()
+	db, err := initDB(t)
 	if err != nil {
 		t.Fatalf("erro ao iniciar db: %v", err)
 	}
@@ -23,14 +25,14 @@ func TestMultiTenants(t *testing.T) {
 	tenantA := "tenantA"
 	tenantB := "tenantB"
 	file := "/tmp/testfile.txt"
-	if err := markProcessed(db, tenantA, file, 100, "/tmp/destA"); err != nil {
+	if err := store.MarkProcessed(db, tenantA, file, 100, "/tmp/destA"); err != nil {
 		t.Fatalf("erro ao marcar processado tenantA: %v", err)
 	}
-	if err := markProcessed(db, tenantB, file, 200, "/tmp/destB"); err != nil {
+	if err := store.MarkProcessed(db, tenantB, file, 200, "/tmp/destB"); err != nil {
 		t.Fatalf("erro ao marcar processado tenantB: %v", err)
 	}
-	procA, _ := hasProcessed(db, tenantA, file)
-	procB, _ := hasProcessed(db, tenantB, file)
+	procA, _ := store.HasProcessed(db, tenantA, file)
+	procB, _ := store.HasProcessed(db, tenantB, file)
 	if !procA || !procB {
 		t.Errorf("esperado processado para ambos tenants")
 	}
@@ -44,7 +46,7 @@ func TestDeleteProcessedFiles(t *testing.T) {
 	os.Remove(dbFile.Name())
 	defer os.Remove(dbFile.Name())
 
-	db, err := initDB()
+	db, err := initDB(t)
 	if err != nil {
 		t.Fatalf("erro ao iniciar db: %v", err)
 	}
@@ -52,7 +54,7 @@ func TestDeleteProcessedFiles(t *testing.T) {
 
 	tenant := "tenantDel"
 	file := "/tmp/testfileDel.txt"
-	if err := markProcessed(db, tenant, file, 123, "/tmp/destDel"); err != nil {
+	if err := store.MarkProcessed(db, tenant, file, 123, "/tmp/destDel"); err != nil {
 		t.Fatalf("erro ao marcar processado: %v", err)
 	}
 	var id int
@@ -65,10 +67,10 @@ func TestDeleteProcessedFiles(t *testing.T) {
 	os.MkdirAll("/tmp/destDel", 0755)
 	os.WriteFile(destFile, []byte("abc"), 0644)
 	defer os.Remove(destFile)
-	if err := deleteProcessedFiles(db, tenant, []int{id}); err != nil {
+	if err := deleteProcessedFiles(db, nil, tenant, []int{id}); err != nil {
 		t.Fatalf("erro ao deletar processado: %v", err)
 	}
-	proc, _ := hasProcessed(db, tenant, file)
+	proc, _ := store.HasProcessed(db, tenant, file)
 	if proc {
 		t.Errorf("esperado não processado após delete")
 	}
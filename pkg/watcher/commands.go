@@ -0,0 +1,474 @@
+package watcher
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/thiagozs/go-filewatcher/pkg/sink"
+	"github.com/thiagozs/go-filewatcher/pkg/store"
+)
+
+// ListProcessed imprime os arquivos processados, do mais recente para o mais
+// antigo. tenant vazio lista todos; route filtra pela regra que encaminhou o
+// arquivo (ver RouteConfig), e vazio não filtra.
+func (w *Watcher) ListProcessed(tenant, route string, page, pageSize int) error {
+	return listProcessedFiles(w.db, tenant, route, page, pageSize)
+}
+
+// Recopy entrega de novo os arquivos processados do tenant, em todos os
+// destinos registrados ou só em destination.
+func (w *Watcher) Recopy(tenant, destination string, ids []int) error {
+	return recopyFiles(w.db, &w.cfg, tenant, destination, ids, false)
+}
+
+// Restore grava o original descomprimido ao lado de cada entrega comprimida
+// dos arquivos processados, a partir da origem ou, se ela não existir mais,
+// da própria cópia comprimida.
+func (w *Watcher) Restore(tenant, destination string, ids []int) error {
+	return recopyFiles(w.db, &w.cfg, tenant, destination, ids, true)
+}
+
+// Decrypt grava em out ("-" para stdout) o original de uma entrega cifrada
+// do arquivo processado id. Sem identityFile, usa o identity_file do destino.
+func (w *Watcher) Decrypt(tenant string, id int, destination, identityFile, out string) error {
+	return decryptProcessed(w.db, &w.cfg, tenant, id, destination, identityFile, out)
+}
+
+// DeleteProcessed remove os registros do tenant e as cópias entregues.
+func (w *Watcher) DeleteProcessed(tenant string, ids []int) error {
+	return deleteProcessedFiles(w.db, &w.cfg, tenant, ids)
+}
+
+// ListFailed imprime os arquivos em quarentena no failed_dir.
+func (w *Watcher) ListFailed(tenant string, page, pageSize int) error {
+	return listDeadLetters(w.db, tenant, page, pageSize)
+}
+
+// Requeue devolve ao watch_dir os arquivos em quarentena do tenant.
+func (w *Watcher) Requeue(tenant string, ids []int) error {
+	return requeueDeadLetters(w.db, tenant, ids)
+}
+
+func truncateFileName(name string, max int) string {
+	if len(name) <= max {
+		return name
+	}
+	return name[:max-3] + "..."
+}
+
+func normalizePath(path string, max int) string {
+	if len(path) <= max {
+		return path
+	}
+	return "..." + path[len(path)-max+3:]
+}
+
+func humanSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
+func recopyFiles(db *sql.DB, cfg *Config, tenant, destination string, ids []int, restore bool) error {
+	if tenant == "" {
+		return fmt.Errorf("tenant must be specified for recopy")
+	}
+	tc := findTenant(cfg, tenant)
+	if destination != "" {
+		if _, ok := tc.findDestination(destination); !ok {
+			return fmt.Errorf("unknown destination %q for tenant %s", destination, tenant)
+		}
+	}
+	filter, err := newFileFilter(tc)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		var filePath string
+		var fileSize sql.NullInt64
+		var checksum, destDir, destPath, archiveMember sql.NullString
+		var duplicateOf, archiveID, parentID sql.NullInt64
+		err := db.QueryRow("SELECT file, dest_dir, dest_path, file_size, checksum, duplicate_of, archive_id, archive_member, parent_id FROM processed_files WHERE id = ? AND tenant = ?", id, tenant).
+			Scan(&filePath, &destDir, &destPath, &fileSize, &checksum, &duplicateOf, &archiveID, &archiveMember, &parentID)
+		if err != nil {
+			log.Printf("[Recopy] Failed to find file with id %d: %v", id, err)
+			continue
+		}
+		if duplicateOf.Valid {
+			log.Printf("[Recopy] File id %d is a duplicate of id %d; recopy that id instead.", id, duplicateOf.Int64)
+			continue
+		}
+		if parentID.Valid {
+			log.Printf("[Recopy] File id %d was extracted from archive id %d; recopy that id instead.", id, parentID.Int64)
+			continue
+		}
+		// Um pacote extraído é extraído e entregue de novo por inteiro
+		if members, _ := extractedMembers(db, int64(id)); len(members) > 0 {
+			recopyExtracted(db, tc, id, filePath)
+			continue
+		}
+		if !filterFile(db, tc, filter, filePath) {
+			log.Printf("[Recopy] File id %d (%s) is filtered out for tenant %s. Skipping.", id, filePath, tenant)
+			continue
+		}
+		// Com batch a cópia está dentro do pacote, não no dest_path
+		if archiveMember.Valid {
+			recopyFromArchive(db, tc, id, archiveID, archiveMember.String, checksum.String)
+			continue
+		}
+		targets, err := recopyTargets(db, tc, int64(id), filePath, store.StoredDestPath(destPath, destDir, filePath), destination)
+		if err != nil {
+			log.Printf("[Recopy] Failed to find destinations of file id %d: %v", id, err)
+			continue
+		}
+		// Usa o mesmo algoritmo do registro para comparar com o original
+		algo := tc.Checksum
+		if checksum.Valid {
+			algo, _ = sink.SplitChecksum(checksum.String)
+		}
+		srcInfo, err := os.Stat(filePath)
+		if restore {
+			// Sem a origem, o original sai da própria cópia comprimida
+			restoreFile(tc, id, filePath, err == nil, checksum.String, algo, targets)
+			continue
+		}
+		if err != nil {
+			log.Printf("[Recopy] Source of file id %d not available: %v", id, err)
+			continue
+		}
+		for _, target := range targets {
+			if s, ok := tc.sinks[target.Destination]; ok {
+				target = recopyToSink(tc, s, target, filePath, srcInfo)
+			} else {
+				dtc := tc
+				if d, ok := tc.findDestination(target.Destination); ok {
+					dtc = tc.forDestination(d)
+				}
+				var sum string
+				enc, err := recopyEncoding(dtc, target)
+				if err == nil {
+					if enc.Compression != nil || enc.Encryption != nil {
+						sum, err = sink.EncodeFileWithChecksum(filePath, target.DestPath, algo, enc)
+					} else {
+						sum, err = sink.CopyFileWithChecksum(filePath, target.DestPath, algo)
+					}
+				}
+				if err != nil {
+					log.Printf("[Recopy] Failed to copy file id %d: %v", id, err)
+					target.Status, target.Err = deliveryFailed, err
+				} else {
+					log.Printf("[Recopy] Copied file id %d: %s -> %s (%s)", id, filePath, target.DestPath, sink.ShortChecksum(sum))
+					applyPreserve(db, dtc, filePath, srcInfo, target.DestPath)
+					if checksum.Valid && sum != checksum.String {
+						log.Printf("[Recopy] Warning: source of file id %d changed since it was processed (was %s)", id, sink.ShortChecksum(checksum.String))
+					}
+					target.Status, target.Method, target.Checksum = deliveryDone, transferCopy, sum
+					if enc.Encryption != nil {
+						target.KeyID = enc.Encryption.KeyID
+					}
+					if fi, err := os.Stat(target.DestPath); err == nil {
+						target.StoredSize = fi.Size()
+					}
+				}
+			}
+			if target.Destination != "" {
+				if err := saveDelivery(db, int64(id), target); err != nil {
+					log.Printf("[Recopy] Failed to record delivery of file id %d: %v", id, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// recopyTargets decide para onde o arquivo deve ser recopiado. Sem
+// destination, usa todas as entregas registradas (ou o caminho gravado em
+// processed_files, para registros antigos). Com destination, usa a entrega
+// registrada nesse destino ou, se ela não existir, o caminho configurado.
+func recopyTargets(db *sql.DB, tc TenantConfig, id int64, filePath, legacyPath, destination string) ([]delivery, error) {
+	recorded, err := recordedDeliveries(db, id)
+	if err != nil {
+		return nil, err
+	}
+	if destination == "" {
+		if len(recorded) == 0 {
+			return []delivery{{DestPath: legacyPath}}, nil
+		}
+		return recorded, nil
+	}
+	for _, r := range recorded {
+		if r.Destination == destination {
+			return []delivery{r}, nil
+		}
+	}
+	d, _ := tc.findDestination(destination)
+	if _, custom := tc.sinks[d.Name]; custom {
+		return []delivery{{Destination: d.Name}}, nil
+	}
+	fi, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+	dtc := tc.forDestination(d)
+	dest, err := renderDestPath(dtc, filePath, newPathVars(tc, filePath, fi, time.Now()))
+	if err != nil {
+		return nil, err
+	}
+	enc, err := dtc.encoding()
+	if err != nil {
+		return nil, err
+	}
+	target := delivery{Destination: d.Name, DestPath: dest + enc.Ext()}
+	if enc.Compression != nil {
+		target.Compression = enc.Compression.Algorithm
+	}
+	if enc.Encryption != nil {
+		target.KeyID = enc.Encryption.KeyID
+	}
+	return []delivery{target}, nil
+}
+
+// recopyEncoding monta a compressão e a cifragem da nova cópia a partir do
+// que foi registrado na entrega. Uma cópia cifrada é sempre cifrada de novo,
+// com os recipients configurados hoje no destino.
+func recopyEncoding(dtc TenantConfig, target delivery) (sink.Encoding, error) {
+	var enc sink.Encoding
+	if target.Compression != "" {
+		c := dtc.compressionFor(target.Compression)
+		enc.Compression = &c
+	}
+	if target.KeyID != "" {
+		if dtc.Encrypt == nil {
+			return enc, fmt.Errorf("delivery to %s is encrypted but destination has no encrypt config", target.DestPath)
+		}
+		e, err := dtc.Encrypt.encryption()
+		if err != nil {
+			return enc, err
+		}
+		enc.Encryption = e
+	}
+	return enc, nil
+}
+
+// restoreFile grava, sem a extensão da compressão, o original de cada entrega
+// comprimida do arquivo. Com a origem disponível ela é copiada; sem ela, a
+// cópia comprimida é descomprimida e conferida com o checksum registrado.
+// Entregas cifradas ficam para o comando decrypt, que tem a chave privada.
+func restoreFile(tc TenantConfig, id int, filePath string, srcExists bool, want, algo string, targets []delivery) {
+	for _, target := range targets {
+		if target.KeyID != "" {
+			log.Printf("[Recopy] Delivery of file id %d to %s is encrypted; use decrypt to restore it.", id, target.DestPath)
+			continue
+		}
+		if _, ok := tc.sinks[target.Destination]; ok || target.Compression == "" {
+			log.Printf("[Recopy] Delivery of file id %d to %s is not compressed; nothing to restore.", id, target.DestPath)
+			continue
+		}
+		out := sink.TrimCompressExt(target.DestPath, target.Compression)
+		var sum string
+		var err error
+		if srcExists {
+			sum, err = sink.CopyFileWithChecksum(filePath, out, algo)
+		} else {
+			sum, err = sink.DecodeFile(target.DestPath, out, algo, target.Compression, nil)
+		}
+		if err != nil {
+			log.Printf("[Recopy] Failed to restore file id %d from %s: %v", id, target.DestPath, err)
+			continue
+		}
+		log.Printf("[Recopy] Restored file id %d: %s (%s)", id, out, sink.ShortChecksum(sum))
+		if want != "" && sum != want {
+			log.Printf("[Recopy] Warning: restored content of file id %d differs from the recorded checksum (%s)", id, sink.ShortChecksum(want))
+		}
+	}
+}
+
+func deleteProcessedFiles(db *sql.DB, cfg *Config, tenant string, ids []int) error {
+	if tenant == "" {
+		return fmt.Errorf("tenant must be specified for delete-processed")
+	}
+	tc := findTenant(cfg, tenant)
+	// Apagar um pacote extraído apaga também os arquivos extraídos dele
+	ids = withExtractedMembers(db, ids)
+	for _, id := range ids {
+		var file string
+		var destDir, destPath, method sql.NullString
+		var duplicateOf, archiveID sql.NullInt64
+		err := db.QueryRow("SELECT file, dest_dir, dest_path, duplicate_of, archive_id, transfer_method FROM processed_files WHERE id = ? AND tenant = ?", id, tenant).Scan(&file, &destDir, &destPath, &duplicateOf, &archiveID, &method)
+		if err != nil {
+			log.Printf("[Delete] Failed to find file with id %d: %v", id, err)
+			continue
+		}
+		// Uma cópia por destino; registros antigos só têm o caminho principal
+		targets := []delivery{{DestPath: store.StoredDestPath(destPath, destDir, file)}}
+		if method.String == transferExtract {
+			// Só os arquivos extraídos foram entregues
+			targets = nil
+		}
+		if recorded, err := recordedDeliveries(db, int64(id)); err == nil && len(recorded) > 0 {
+			targets = recorded
+		}
+
+		_, err = db.Exec("DELETE FROM processed_files WHERE id = ? AND tenant = ?", id, tenant)
+		if err == nil {
+			_, err = db.Exec("DELETE FROM deliveries WHERE processed_id = ?", id)
+		}
+		if err == nil {
+			_, err = db.Exec("DELETE FROM hook_runs WHERE processed_id = ?", id)
+		}
+		if err != nil {
+			log.Printf("[Delete] Failed to delete DB entry id %d: %v", id, err)
+		} else if duplicateOf.Valid {
+			// O conteúdo pertence ao registro original; nada a remover do disco
+			log.Printf("[Delete] Deleted DB entry id %d (duplicate of id %d).", id, duplicateOf.Int64)
+		} else if archiveID.Valid {
+			// O pacote guarda outros arquivos do lote e fica no disco
+			log.Printf("[Delete] Deleted DB entry id %d. Its copy remains inside archive %s.", id, destPath.String)
+		} else if len(targets) == 0 {
+			log.Printf("[Delete] Deleted DB entry id %d (archive: %s).", id, file)
+		} else {
+			for _, target := range targets {
+				if err := removeDelivered(tc, target); err != nil {
+					log.Printf("[Delete] Deleted DB entry id %d (file: %s), but failed to remove file from disk: %v", id, target.DestPath, err)
+				} else {
+					log.Printf("[Delete] Deleted DB entry id %d (file: %s) and removed file from disk.", id, target.DestPath)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// removeDelivered apaga a cópia entregue. Destinos remotos (ex.: S3) são
+// apagados pelo próprio sink.
+func removeDelivered(tc TenantConfig, target delivery) error {
+	if s, ok := tc.sinks[target.Destination]; ok {
+		r, ok := s.(sink.Remover)
+		if !ok {
+			return fmt.Errorf("destination %s does not support removal", target.Destination)
+		}
+		return r.Remove(context.Background(), target.DestPath)
+	}
+	return os.Remove(target.DestPath)
+}
+
+func listProcessedFiles(db *sql.DB, tenant, route string, page int, pageSize int) error {
+	var rows *sql.Rows
+	var err error
+	offset := (page - 1) * pageSize
+	if offset < 0 {
+		offset = 0
+	}
+
+	query := "SELECT id, tenant, file, processed_at, file_size, COALESCE(dest_path, dest_dir), checksum, duplicate_of, transfer_method, stored_size, compression, key_id, archive_id, archive_member, route FROM processed_files WHERE 1=1 "
+	var args []interface{}
+	if tenant != "" {
+		query += "AND tenant = ? "
+		args = append(args, tenant)
+	}
+	if route != "" {
+		query += "AND route = ? "
+		args = append(args, route)
+	}
+	query += "ORDER BY processed_at DESC LIMIT ? OFFSET ?"
+	args = append(args, pageSize, offset)
+
+	rows, err = db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.Header([]string{"ID", "Tenant", "File", "Size", "Dest", "Route", "Checksum", "Dup Of", "Method", "Processed At"})
+
+	for rows.Next() {
+		var id int
+		var tenantName, file, processedAt string
+		var fileSize, storedSize sql.NullInt64
+		var destDir, checksum, method, compression, keyID, archiveMember, routeName sql.NullString
+		var duplicateOf, archiveID sql.NullInt64
+		if err := rows.Scan(&id, &tenantName, &file, &processedAt, &fileSize, &destDir, &checksum, &duplicateOf, &method, &storedSize, &compression, &keyID, &archiveID, &archiveMember, &routeName); err != nil {
+			return err
+		}
+		fileDisplay := truncateFileName(memberDisplay(file), 40)
+		destDisplay := ""
+		switch {
+		case archiveID.Valid:
+			destDisplay = normalizePath(filepath.Base(destDir.String)+":"+archiveMember.String, 28)
+		case archiveMember.Valid:
+			destDisplay = "(open batch)"
+		case destDir.Valid:
+			destDisplay = normalizePath(destDir.String, 28)
+		}
+		sizeDisplay := ""
+		if fileSize.Valid {
+			sizeDisplay = humanSize(fileSize.Int64)
+		}
+		if compression.Valid && storedSize.Valid {
+			sizeDisplay += fmt.Sprintf(" (%s %s)", compression.String, humanSize(storedSize.Int64))
+		}
+		if keyID.Valid {
+			sizeDisplay += " [" + keyID.String + "]"
+		}
+		checksumDisplay := ""
+		if checksum.Valid {
+			checksumDisplay = sink.ShortChecksum(checksum.String)
+		}
+		dupDisplay := ""
+		if duplicateOf.Valid {
+			dupDisplay = fmt.Sprintf("%d", duplicateOf.Int64)
+		}
+		table.Append([]string{
+			fmt.Sprintf("%d", id),
+			tenantName,
+			fileDisplay,
+			sizeDisplay,
+			destDisplay,
+			routeName.String,
+			checksumDisplay,
+			dupDisplay,
+			method.String,
+			processedAt,
+		})
+	}
+	table.Render()
+	fmt.Printf("Page %d (Page Size %d)\n", page, pageSize)
+	return nil
+}
+
+// recopyToSink reenvia o arquivo a um destino com sink próprio, passando
+// pelos processadores do tenant.
+func recopyToSink(tc TenantConfig, s sink.Sink, target delivery, filePath string, fi os.FileInfo) delivery {
+	var receipt sink.Receipt
+	f := sink.File{
+		Tenant:      tc.Name,
+		Destination: target.Destination,
+		Source:      filePath,
+		Path:        filePath,
+		RelPath:     relPath(tc, filePath),
+		Info:        fi,
+		Arrival:     time.Now(),
+		Receipt:     &receipt,
+	}
+	if err := sink.Chain(s, tc.processors...).Deliver(context.Background(), f); err != nil {
+		log.Printf("[Recopy] Failed to deliver %s to destination %s: %v", filePath, target.Destination, err)
+		target.Status, target.Err = deliveryFailed, err
+		return target
+	}
+	log.Printf("[Recopy] Delivered %s to destination %s (%s)", filePath, target.Destination, receipt.Location)
+	target.Status, target.DestPath, target.Method, target.Checksum, target.ETag = deliveryDone, receipt.Location, receipt.Method, receipt.Checksum, receipt.ETag
+	return target
+}
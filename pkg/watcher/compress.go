@@ -0,0 +1,53 @@
+package watcher
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/thiagozs/go-filewatcher/pkg/sink"
+)
+
+// CompressConfig comprime o arquivo durante a cópia para um destino local.
+// O nome ganha a extensão do algoritmo (.gz, .zst) e o checksum registrado
+// continua sendo o do conteúdo original.
+type CompressConfig struct {
+	Algorithm string `yaml:"algorithm"` // gzip ou zstd
+	Level     int    `yaml:"level"`     // 0 usa o padrão do algoritmo
+}
+
+func (c *CompressConfig) validate() error {
+	if c == nil {
+		return nil
+	}
+	if err := c.compression().Validate(); err != nil {
+		return fmt.Errorf("invalid compress: %w", err)
+	}
+	return nil
+}
+
+func (c *CompressConfig) compression() sink.Compression {
+	return sink.Compression{Algorithm: c.Algorithm, Level: c.Level}
+}
+
+// compressionFor retorna a compressão a usar numa nova cópia de um arquivo
+// gravado com algorithm: o nível configurado, se o algoritmo ainda for o
+// mesmo, ou o padrão.
+func (tc TenantConfig) compressionFor(algorithm string) sink.Compression {
+	if tc.Compress != nil && tc.Compress.Algorithm == algorithm {
+		return tc.Compress.compression()
+	}
+	return sink.Compression{Algorithm: algorithm}
+}
+
+// deliveredChecksum calcula o checksum do conteúdo original de um arquivo já
+// entregue, descomprimindo-o se o destino comprime.
+func deliveredChecksum(tc TenantConfig, dst string) string {
+	if tc.Compress == nil {
+		return destChecksum(tc, dst)
+	}
+	sum, err := sink.CompressedChecksum(dst, tc.Checksum, tc.Compress.Algorithm)
+	if err != nil {
+		log.Printf("[%s] Failed to hash %s: %v", tc.Name, dst, err)
+	}
+	return sum
+}
@@ -0,0 +1,91 @@
+package watcher
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/thiagozs/go-filewatcher/pkg/sink"
+	"github.com/thiagozs/go-filewatcher/pkg/store"
+)
+
+func TestCompressValidation(t *testing.T) {
+	cases := map[string]DestinationConfig{
+		"algoritmo desconhecido": {Name: "a", Path: "/tmp/a", Compress: &CompressConfig{Algorithm: "bzip2"}},
+		"nível fora da faixa":    {Name: "a", Path: "/tmp/a", Compress: &CompressConfig{Algorithm: "gzip", Level: 12}},
+		"destino remoto":         {Name: "a", Type: destinationSFTP, Compress: &CompressConfig{Algorithm: "gzip"}},
+	}
+	for name, d := range cases {
+		tc := TenantConfig{Name: "x", WatchDir: "/tmp/x", Destinations: []DestinationConfig{d}}
+		if err := validateDestinations(&tc); err == nil {
+			t.Errorf("%s: esperado erro", name)
+		}
+	}
+}
+
+func TestHandleFileCompressedDestination(t *testing.T) {
+	db, err := initDB(t)
+	if err != nil {
+		t.Fatalf("erro ao iniciar db: %v", err)
+	}
+	defer db.Close()
+
+	tc := TenantConfig{
+		Name:     "tenantCompress",
+		WatchDir: t.TempDir(),
+		Destinations: []DestinationConfig{
+			{Name: "archive", Path: t.TempDir(), Compress: &CompressConfig{Algorithm: sink.CompressZstd, Level: 3}},
+			{Name: "inbox", Path: t.TempDir()},
+		},
+		Readiness: ReadinessConfig{Strategy: readinessCloseWrite},
+	}
+	cfg := &Config{Tenants: []TenantConfig{tc}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("erro ao validar: %v", err)
+	}
+	tc = cfg.Tenants[0]
+	filter, _ := newFileFilter(tc)
+	name := filepath.Join(tc.WatchDir, "vendas.csv")
+	content := []byte("data;loja;valor\n2024-01-01;1;10,00\n2024-01-01;2;12,50\n")
+	os.WriteFile(name, content, 0644)
+	want, _ := sink.FileChecksum(name, "")
+
+	if err := handleFile(context.Background(), db, tc, filter, name, true, evCreate); err != nil {
+		t.Fatalf("erro no handleFile: %v", err)
+	}
+	archived := filepath.Join(tc.Destinations[0].Path, "vendas.csv.zst")
+	if err := sink.VerifyCompressed(archived, want, sink.CompressZstd); err != nil {
+		t.Fatalf("cópia comprimida inválida: %v", err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(tc.Destinations[1].Path, "vendas.csv")); string(b) != string(content) {
+		t.Errorf("destino sem compressão deveria receber o original")
+	}
+	rec, _ := store.GetProcessed(db, tc.Name, name)
+	fi, _ := os.Stat(archived)
+	if rec == nil || rec.DestPath != archived || rec.Checksum != want {
+		t.Fatalf("registro incorreto: %+v", rec)
+	}
+	if rec.FileSize != int64(len(content)) || rec.StoredSize != fi.Size() || rec.Compression != sink.CompressZstd {
+		t.Errorf("tamanhos não registrados: %+v", rec)
+	}
+
+	// --recopy devolve a cópia comprimida
+	os.Remove(archived)
+	if err := recopyFiles(db, cfg, tc.Name, "archive", []int{int(rec.ID)}, false); err != nil {
+		t.Fatalf("erro no recopy: %v", err)
+	}
+	if err := sink.VerifyCompressed(archived, want, sink.CompressZstd); err != nil {
+		t.Errorf("recopy não regravou a cópia comprimida: %v", err)
+	}
+
+	// Sem a origem, --restore descomprime a cópia do destino
+	os.Remove(name)
+	if err := recopyFiles(db, cfg, tc.Name, "", []int{int(rec.ID)}, true); err != nil {
+		t.Fatalf("erro no restore: %v", err)
+	}
+	restored := filepath.Join(tc.Destinations[0].Path, "vendas.csv")
+	if b, _ := os.ReadFile(restored); string(b) != string(content) {
+		t.Errorf("restore não gravou o original: %q", b)
+	}
+}
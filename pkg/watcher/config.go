@@ -0,0 +1,156 @@
+// Package watcher observa os diretórios de cada tenant e entrega os arquivos
+// que chegam nos destinos configurados, registrando tudo no banco (ver
+// pkg/store). Destinos podem usar um sink.Sink próprio e uma cadeia de
+// sink.Processor; sem eles, a entrega é a cópia local.
+package watcher
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/thiagozs/go-filewatcher/pkg/sink"
+	"gopkg.in/yaml.v2"
+)
+
+type TenantConfig struct {
+	Name           string              `yaml:"name"`
+	WatchDir       string              `yaml:"watch_dir"`
+	DestDir        string              `yaml:"dest_dir"`
+	Recursive      bool                `yaml:"recursive"`
+	Include        []string            `yaml:"include"`
+	Exclude        []string            `yaml:"exclude"`
+	CountSkipped   bool                `yaml:"count_skipped"`
+	Events         EventPolicy         `yaml:"events"`
+	Readiness      ReadinessConfig     `yaml:"readiness"`
+	Workers        int                 `yaml:"workers"`
+	Checksum       string              `yaml:"checksum"`
+	Dedupe         string              `yaml:"dedupe"`
+	OnConflict     string              `yaml:"on_conflict"`
+	ConflictSuffix string              `yaml:"conflict_suffix"`
+	VersionHistory int                 `yaml:"version_history"`
+	Preserve       []string            `yaml:"preserve"`
+	TransferMode   string              `yaml:"transfer_mode"`
+	Compress       *CompressConfig     `yaml:"compress"`
+	Encrypt        *EncryptConfig      `yaml:"encrypt"`
+	Destinations   []DestinationConfig `yaml:"destinations"`
+	DestTemplate   string              `yaml:"dest_template"`
+	NamePattern    string              `yaml:"name_pattern"`
+	Retry          RetryConfig         `yaml:"retry"`
+	FailedDir      string              `yaml:"failed_dir"`
+	Hooks          HooksConfig         `yaml:"hooks"`
+	Batch          *BatchConfig        `yaml:"batch"`
+	Extract        *ExtractConfig      `yaml:"extract"`
+	Routes         []RouteConfig       `yaml:"routes"`
+	Unrouted       string              `yaml:"unrouted"` // destino dos arquivos sem regra; padrão: destinos do tenant
+
+	// Definidos pelo programa que embute o watcher (ver WithSink)
+	sinks      map[string]sink.Sink
+	processors []sink.Processor
+}
+
+type Config struct {
+	Tenants []TenantConfig `yaml:"tenants"`
+}
+
+// LoadConfig lê e valida o arquivo de configuração.
+func LoadConfig(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var cfg Config
+	decoder := yaml.NewDecoder(f)
+	if err := decoder.Decode(&cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Validate valida a configuração de cada tenant e aplica os valores
+// derivados (ex.: dest_dir a partir de destinations). Configs montados em
+// código devem passar por Validate antes de New.
+func (cfg *Config) Validate() error {
+	for i := range cfg.Tenants {
+		if err := validateDestinations(&cfg.Tenants[i]); err != nil {
+			return fmt.Errorf("tenant %s: %w", cfg.Tenants[i].Name, err)
+		}
+		tc := cfg.Tenants[i]
+		if _, err := newFileFilter(tc); err != nil {
+			return fmt.Errorf("tenant %s: %w", tc.Name, err)
+		}
+		if err := tc.Readiness.validate(); err != nil {
+			return fmt.Errorf("tenant %s: %w", tc.Name, err)
+		}
+		if _, err := sink.NewHasher(tc.Checksum); err != nil {
+			return fmt.Errorf("tenant %s: %w", tc.Name, err)
+		}
+		if err := validateDedupe(tc.Dedupe); err != nil {
+			return fmt.Errorf("tenant %s: %w", tc.Name, err)
+		}
+		if err := validateConflict(tc); err != nil {
+			return fmt.Errorf("tenant %s: %w", tc.Name, err)
+		}
+		if err := validatePreserve(tc.Preserve); err != nil {
+			return fmt.Errorf("tenant %s: %w", tc.Name, err)
+		}
+		if err := validateTransferMode(tc.TransferMode); err != nil {
+			return fmt.Errorf("tenant %s: %w", tc.Name, err)
+		}
+		if err := validateTemplate(tc); err != nil {
+			return fmt.Errorf("tenant %s: %w", tc.Name, err)
+		}
+		if err := tc.Compress.validate(); err != nil {
+			return fmt.Errorf("tenant %s: %w", tc.Name, err)
+		}
+		if err := tc.Encrypt.validate(); err != nil {
+			return fmt.Errorf("tenant %s: %w", tc.Name, err)
+		}
+		if err := tc.Retry.validate(); err != nil {
+			return fmt.Errorf("tenant %s: %w", tc.Name, err)
+		}
+		if err := validateFailedDir(tc); err != nil {
+			return fmt.Errorf("tenant %s: %w", tc.Name, err)
+		}
+		if err := tc.Hooks.validate(); err != nil {
+			return fmt.Errorf("tenant %s: %w", tc.Name, err)
+		}
+		if err := validateBatch(tc); err != nil {
+			return fmt.Errorf("tenant %s: %w", tc.Name, err)
+		}
+		if err := validateExtract(tc); err != nil {
+			return fmt.Errorf("tenant %s: %w", tc.Name, err)
+		}
+		if err := validateRoutes(&cfg.Tenants[i]); err != nil {
+			return fmt.Errorf("tenant %s: %w", tc.Name, err)
+		}
+	}
+	return nil
+}
+
+// findTenant retorna a configuração do tenant pelo nome. Tenants ausentes do
+// config (ex.: removidos depois de processar arquivos) recebem uma configuração
+// mínima só com o nome.
+func findTenant(cfg *Config, name string) TenantConfig {
+	if cfg != nil {
+		for _, tc := range cfg.Tenants {
+			if tc.Name == name {
+				return tc
+			}
+		}
+	}
+	return TenantConfig{Name: name}
+}
+
+// Debug habilita os logs de debug (ex.: arquivos ignorados pelos filtros).
+var Debug bool
+
+func debugf(format string, args ...interface{}) {
+	if Debug {
+		log.Printf("[DEBUG] "+format, args...)
+	}
+}
@@ -1,4 +1,4 @@
-package main
+package watcher
 
 import (
 	"os"
@@ -22,7 +22,7 @@ func TestLoadConfig(t *testing.T) {
 	}
 	f.Close()
 
-	cfg, err := loadConfig(f.Name())
+	cfg, err := LoadConfig(f.Name())
 	if err != nil {
 		t.Fatalf("erro ao carregar config: %v", err)
 	}
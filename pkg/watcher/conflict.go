@@ -0,0 +1,237 @@
+package watcher
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thiagozs/go-filewatcher/pkg/sink"
+	"github.com/thiagozs/go-filewatcher/pkg/store"
+)
+
+// Políticas para quando o arquivo já existe no destino.
+const (
+	conflictOverwrite = "overwrite" // substitui o arquivo existente (padrão)
+	conflictSkip      = "skip"      // mantém o destino e deixa a origem intacta
+	conflictFail      = "fail"      // registra falha em file_failures
+	conflictRename    = "rename"    // grava com sufixo: nome-1.ext ou nome-<timestamp>.ext
+	conflictVersion   = "version"   // grava como nome.v2.ext, nome.v3.ext...
+)
+
+// Sufixos usados por on_conflict: rename.
+const (
+	suffixNumeric   = "numeric"
+	suffixTimestamp = "timestamp"
+)
+
+const conflictTimeLayout = "20060102T150405"
+
+var (
+	// errAlreadyDelivered indica que o destino já tem exatamente o mesmo conteúdo.
+	errAlreadyDelivered = errors.New("destination already has the same content")
+	// errConflictSkip indica que o arquivo não foi entregue por on_conflict: skip.
+	errConflictSkip = errors.New("destination exists, skipped by policy")
+	// errDestExists indica que o arquivo não foi entregue por on_conflict: fail.
+	errDestExists = errors.New("destination already exists")
+)
+
+func validateConflict(tc TenantConfig) error {
+	switch tc.OnConflict {
+	case "", conflictOverwrite, conflictSkip, conflictFail, conflictRename, conflictVersion:
+	default:
+		return fmt.Errorf("unknown on_conflict policy %q", tc.OnConflict)
+	}
+	switch tc.ConflictSuffix {
+	case "", suffixNumeric, suffixTimestamp:
+	default:
+		return fmt.Errorf("unknown conflict_suffix %q", tc.ConflictSuffix)
+	}
+	if tc.VersionHistory < 0 {
+		return fmt.Errorf("version_history must not be negative")
+	}
+	return nil
+}
+
+// resolveDest decide em qual caminho src deve ser gravado quando dst já
+// existe, conforme on_conflict. Destino com o mesmo conteúdo retorna
+// errAlreadyDelivered em qualquer política; com compress, o destino é
+// comparado descomprimido. Com encrypt não há como ler o destino, então ele
+// sempre conta como conteúdo diferente.
+func resolveDest(tc TenantConfig, src, dst string) (string, error) {
+	if !fileExists(dst) {
+		return dst, nil
+	}
+	var same bool
+	var err error
+	switch {
+	case tc.Encrypt != nil:
+	case tc.Compress != nil:
+		same, err = sameCompressedContent(src, dst, tc.Checksum, tc.Compress.Algorithm)
+	default:
+		same, err = sameContent(src, dst, tc.Checksum)
+	}
+	if err != nil {
+		return "", err
+	}
+	if same {
+		return dst, errAlreadyDelivered
+	}
+	switch tc.OnConflict {
+	case conflictSkip:
+		return "", fmt.Errorf("%s: %w", dst, errConflictSkip)
+	case conflictFail:
+		return "", fmt.Errorf("%s: %w", dst, errDestExists)
+	case conflictRename:
+		return renamedDest(dst, tc.ConflictSuffix, time.Now()), nil
+	case conflictVersion:
+		return nextVersion(dst), nil
+	}
+	return dst, nil
+}
+
+// sameContent compara tamanho e checksum dos dois arquivos.
+func sameContent(a, b, algo string) (bool, error) {
+	fa, err := os.Stat(a)
+	if err != nil {
+		return false, err
+	}
+	fb, err := os.Stat(b)
+	if err != nil {
+		return false, err
+	}
+	if fa.Size() != fb.Size() {
+		return false, nil
+	}
+	sa, err := sink.FileChecksum(a, algo)
+	if err != nil {
+		return false, err
+	}
+	sb, err := sink.FileChecksum(b, algo)
+	if err != nil {
+		return false, err
+	}
+	return sa == sb, nil
+}
+
+// sameCompressedContent compara o checksum de a com o do conteúdo
+// descomprimido de b. Um b que não descomprime conta como conteúdo diferente.
+func sameCompressedContent(a, b, algo, algorithm string) (bool, error) {
+	sa, err := sink.FileChecksum(a, algo)
+	if err != nil {
+		return false, err
+	}
+	sb, err := sink.CompressedChecksum(b, algo, algorithm)
+	if err != nil {
+		return false, nil
+	}
+	return sa == sb, nil
+}
+
+// splitExt separa "relatorio.tar.gz" em "relatorio.tar" e ".gz".
+func splitExt(path string) (string, string) {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext), ext
+}
+
+// renamedDest retorna o primeiro nome livre com sufixo numérico
+// (nome-1.ext, nome-2.ext...) ou com o horário da chegada.
+func renamedDest(dst, suffix string, now time.Time) string {
+	stem, ext := splitExt(dst)
+	if suffix == suffixTimestamp {
+		candidate := stem + "-" + now.Format(conflictTimeLayout) + ext
+		if !fileExists(candidate) {
+			return candidate
+		}
+		stem += "-" + now.Format(conflictTimeLayout)
+	}
+	for i := 1; ; i++ {
+		candidate := stem + "-" + strconv.Itoa(i) + ext
+		if !fileExists(candidate) {
+			return candidate
+		}
+	}
+}
+
+// versionedFiles lista as versões existentes de dst (nome.vN.ext) por número.
+func versionedFiles(dst string) (map[int]string, error) {
+	stem, ext := splitExt(dst)
+	re := regexp.MustCompile("^" + regexp.QuoteMeta(filepath.Base(stem)) + `\.v(\d+)` + regexp.QuoteMeta(ext) + "$")
+	entries, err := os.ReadDir(filepath.Dir(dst))
+	if err != nil {
+		return nil, err
+	}
+	versions := make(map[int]string)
+	for _, e := range entries {
+		if m := re.FindStringSubmatch(e.Name()); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			versions[n] = filepath.Join(filepath.Dir(dst), e.Name())
+		}
+	}
+	return versions, nil
+}
+
+// nextVersion retorna o caminho da próxima versão de dst. O arquivo sem
+// número conta como a versão 1.
+func nextVersion(dst string) string {
+	versions, _ := versionedFiles(dst)
+	next := 2
+	for n := range versions {
+		if n >= next {
+			next = n + 1
+		}
+	}
+	stem, ext := splitExt(dst)
+	return fmt.Sprintf("%s.v%d%s", stem, next, ext)
+}
+
+// pruneVersions remove as versões mais antigas de dst, mantendo as keep mais
+// recentes. O arquivo original (versão 1) nunca é removido.
+func pruneVersions(tc TenantConfig, dst string, keep int) {
+	if keep <= 0 {
+		return
+	}
+	versions, err := versionedFiles(dst)
+	if err != nil {
+		return
+	}
+	nums := make([]int, 0, len(versions))
+	for n := range versions {
+		nums = append(nums, n)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(nums)))
+	for _, n := range nums[min(keep, len(nums)):] {
+		if err := os.Remove(versions[n]); err != nil {
+			log.Printf("[%s] Failed to prune old version %s: %v", tc.Name, versions[n], err)
+		} else {
+			log.Printf("[%s] Pruned old version %s", tc.Name, versions[n])
+		}
+	}
+}
+
+// reportConflict registra o arquivo que não foi entregue por causa de
+// on_conflict: skip vai para skipped_files e fail para file_failures.
+func reportConflict(db *sql.DB, tc TenantConfig, name string, err error) {
+	if errors.Is(err, errConflictSkip) {
+		log.Printf("[%s] File %s not copied: %v", tc.Name, name, err)
+		if err := store.RecordSkipped(db, tc.Name, name, "destination exists"); err != nil {
+			log.Printf("[%s] Failed to record skipped file %s: %v", tc.Name, name, err)
+		}
+		return
+	}
+	log.Printf("[%s] Failed to resolve destination for %s: %v", tc.Name, name, err)
+	reason := "conflict"
+	if !errors.Is(err, errDestExists) {
+		reason = "destination_error"
+	}
+	if err := store.RecordFailure(db, tc.Name, name, reason, err); err != nil {
+		log.Printf("[%s] Failed to record failure: %v", tc.Name, err)
+	}
+}
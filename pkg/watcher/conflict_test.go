@@ -0,0 +1,147 @@
+package watcher
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/thiagozs/go-filewatcher/pkg/store"
+)
+
+func conflictTenant(t *testing.T, name, policy string) TenantConfig {
+	return TenantConfig{
+		Name:       name,
+		WatchDir:   t.TempDir(),
+		DestDir:    t.TempDir(),
+		OnConflict: policy,
+		Readiness:  ReadinessConfig{Strategy: readinessCloseWrite},
+	}
+}
+
+func TestResolveDestRename(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(t.TempDir(), "nota.xml")
+	dst := filepath.Join(dir, "nota.xml")
+	os.WriteFile(src, []byte("nova"), 0644)
+	os.WriteFile(dst, []byte("antiga"), 0644)
+	os.WriteFile(filepath.Join(dir, "nota-1.xml"), []byte("outra"), 0644)
+
+	tc := TenantConfig{OnConflict: conflictRename}
+	got, err := resolveDest(tc, src, dst)
+	if err != nil || got != filepath.Join(dir, "nota-2.xml") {
+		t.Errorf("rename numérico: veio %q, %v", got, err)
+	}
+
+	now := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+	if got := renamedDest(dst, suffixTimestamp, now); got != filepath.Join(dir, "nota-20240501T103000.xml") {
+		t.Errorf("rename por timestamp: veio %q", got)
+	}
+
+	// Mesmo conteúdo não é conflito em nenhuma política
+	os.WriteFile(dst, []byte("nova"), 0644)
+	if _, err := resolveDest(tc, src, dst); err != errAlreadyDelivered {
+		t.Errorf("esperado errAlreadyDelivered, veio %v", err)
+	}
+}
+
+func TestHandleFileConflictVersion(t *testing.T) {
+	db, err := initDB(t)
+	if err != nil {
+		t.Fatalf("erro ao iniciar db: %v", err)
+	}
+	defer db.Close()
+
+	tc := conflictTenant(t, "tenantConflictVersion", conflictVersion)
+	tc.VersionHistory = 2
+	tc.Events.RenameAsArrival = true
+	filter, _ := newFileFilter(tc)
+	name := filepath.Join(tc.WatchDir, "extrato.csv")
+	os.WriteFile(filepath.Join(tc.DestDir, "extrato.csv"), []byte("v1"), 0644)
+
+	for _, content := range []string{"v2", "v3", "v4"} {
+		os.WriteFile(name, []byte(content), 0644)
+		handleFile(context.Background(), db, tc, filter, name, false, evMovedTo)
+	}
+
+	if b, _ := os.ReadFile(filepath.Join(tc.DestDir, "extrato.csv")); string(b) != "v1" {
+		t.Errorf("original não deveria ser alterado, veio %q", b)
+	}
+	if fileExists(filepath.Join(tc.DestDir, "extrato.v2.csv")) {
+		t.Errorf("versão mais antiga deveria ser removida pelo version_history")
+	}
+	for v, want := range map[string]string{"extrato.v3.csv": "v3", "extrato.v4.csv": "v4"} {
+		if b, _ := os.ReadFile(filepath.Join(tc.DestDir, v)); string(b) != want {
+			t.Errorf("%s: conteúdo %q, esperado %q", v, b, want)
+		}
+	}
+	rec, _ := store.GetProcessed(db, tc.Name, name)
+	if rec == nil || rec.DestPath != filepath.Join(tc.DestDir, "extrato.v4.csv") {
+		t.Errorf("dest_path não registra a última versão gravada: %+v", rec)
+	}
+}
+
+func TestHandleFileConflictSkipAndFail(t *testing.T) {
+	db, err := initDB(t)
+	if err != nil {
+		t.Fatalf("erro ao iniciar db: %v", err)
+	}
+	defer db.Close()
+
+	for _, policy := range []string{conflictSkip, conflictFail} {
+		tc := conflictTenant(t, "tenantConflict-"+policy, policy)
+		filter, _ := newFileFilter(tc)
+		name := filepath.Join(tc.WatchDir, "pedido.json")
+		dest := filepath.Join(tc.DestDir, "pedido.json")
+		os.WriteFile(name, []byte(`{"id":2}`), 0644)
+		os.WriteFile(dest, []byte(`{"id":1}`), 0644)
+
+		handleFile(context.Background(), db, tc, filter, name, false, evCreate)
+
+		if b, _ := os.ReadFile(dest); string(b) != `{"id":1}` {
+			t.Errorf("%s: destino não deveria ser sobrescrito, veio %q", policy, b)
+		}
+		if !fileExists(name) {
+			t.Errorf("%s: origem deveria ser mantida", policy)
+		}
+		if rec, _ := store.GetProcessed(db, tc.Name, name); rec != nil {
+			t.Errorf("%s: arquivo não entregue não deveria ser registrado", policy)
+		}
+	}
+
+	var failures int
+	db.QueryRow("SELECT COUNT(1) FROM file_failures WHERE tenant = ? AND reason = 'conflict'", "tenantConflict-fail").Scan(&failures)
+	if failures == 0 {
+		t.Errorf("esperada falha registrada para on_conflict fail")
+	}
+}
+
+func TestSyncTenantDirsConflictComparesContent(t *testing.T) {
+	db, err := initDB(t)
+	if err != nil {
+		t.Fatalf("erro ao iniciar db: %v", err)
+	}
+	defer db.Close()
+
+	tc := conflictTenant(t, "tenantConflictSync", conflictRename)
+	os.WriteFile(filepath.Join(tc.WatchDir, "igual.txt"), []byte("mesmo"), 0644)
+	os.WriteFile(filepath.Join(tc.DestDir, "igual.txt"), []byte("mesmo"), 0644)
+	os.WriteFile(filepath.Join(tc.WatchDir, "diferente.txt"), []byte("novo"), 0644)
+	os.WriteFile(filepath.Join(tc.DestDir, "diferente.txt"), []byte("velho"), 0644)
+
+	if err := syncTenantDirs(db, tc); err != nil {
+		t.Fatalf("erro no sync: %v", err)
+	}
+
+	if fileExists(filepath.Join(tc.DestDir, "igual-1.txt")) {
+		t.Errorf("arquivo idêntico não deveria ser copiado de novo")
+	}
+	if b, _ := os.ReadFile(filepath.Join(tc.DestDir, "diferente-1.txt")); string(b) != "novo" {
+		t.Errorf("conteúdo divergente deveria ser gravado com sufixo, veio %q", b)
+	}
+	rec, _ := store.GetProcessed(db, tc.Name, filepath.Join(tc.WatchDir, "diferente.txt"))
+	if rec == nil || rec.DestPath != filepath.Join(tc.DestDir, "diferente-1.txt") {
+		t.Errorf("dest_path incorreto: %+v", rec)
+	}
+}
@@ -0,0 +1,82 @@
+package watcher
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/thiagozs/go-filewatcher/pkg/store"
+)
+
+// Modos de deduplicação por tenant.
+const (
+	dedupePath        = "path"         // mesmo caminho já processado (padrão)
+	dedupeContent     = "content"      // mesmo conteúdo já processado no tenant
+	dedupePathContent = "path+content" // mesmo caminho com o mesmo conteúdo
+)
+
+func validateDedupe(mode string) error {
+	switch mode {
+	case "", dedupePath, dedupeContent, dedupePathContent:
+		return nil
+	}
+	return fmt.Errorf("unknown dedupe mode %q", mode)
+}
+
+func dedupeMode(tc TenantConfig) string {
+	if tc.Dedupe == "" {
+		return dedupePath
+	}
+	return tc.Dedupe
+}
+
+// findDuplicate procura um registro já processado que torna o arquivo
+// redundante segundo o modo de deduplicação do tenant. prev é o registro do
+// mesmo caminho, se existir.
+func findDuplicate(db *sql.DB, tc TenantConfig, prev *store.Processed, sum string) (*store.Processed, error) {
+	switch dedupeMode(tc) {
+	case dedupePathContent:
+		if prev != nil && prev.Checksum == sum {
+			return prev, nil
+		}
+	case dedupeContent:
+		if prev != nil && prev.Checksum == sum {
+			return prev, nil
+		}
+		var id int64
+		var rec store.Processed
+		var destDir sql.NullString
+		err := db.QueryRow(
+			"SELECT id, file, dest_dir FROM processed_files WHERE tenant = ? AND checksum = ? AND duplicate_of IS NULL ORDER BY id LIMIT 1",
+			tc.Name, sum,
+		).Scan(&id, &rec.File, &destDir)
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		rec.ID, rec.Tenant, rec.DestDir, rec.Checksum = id, tc.Name, destDir.String, sum
+		return &rec, nil
+	}
+	return nil, nil
+}
+
+// markDuplicate registra o arquivo como duplicata de outro já entregue. A
+// linha não tem dest_dir: o conteúdo está no destino do registro original.
+func markDuplicate(db *sql.DB, tc TenantConfig, name string, size int64, sum string, original *store.Processed) error {
+	if original.File == name {
+		return nil
+	}
+	_, err := db.Exec(`
+        INSERT INTO processed_files(tenant, file, file_size, checksum, duplicate_of) VALUES (?, ?, ?, ?, ?)
+        ON CONFLICT(tenant, file) DO UPDATE SET
+            processed_at = CURRENT_TIMESTAMP,
+            file_size = excluded.file_size,
+            dest_dir = NULL,
+            dest_path = NULL,
+            checksum = excluded.checksum,
+            duplicate_of = excluded.duplicate_of`,
+		tc.Name, name, size, sum, original.ID,
+	)
+	return err
+}
@@ -0,0 +1,112 @@
+package watcher
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/thiagozs/go-filewatcher/pkg/sink"
+	"github.com/thiagozs/go-filewatcher/pkg/store"
+)
+
+func TestHandleFileDedupeContent(t *testing.T) {
+	db, err := initDB(t)
+	if err != nil {
+		t.Fatalf("erro ao iniciar db: %v", err)
+	}
+	defer db.Close()
+
+	watchDir := t.TempDir()
+	destDir := t.TempDir()
+	tc := TenantConfig{
+		Name:      "tenantDedupe",
+		WatchDir:  watchDir,
+		DestDir:   destDir,
+		Dedupe:    dedupeContent,
+		Readiness: ReadinessConfig{Strategy: readinessCloseWrite},
+	}
+	filter, _ := newFileFilter(tc)
+	// O banco é compartilhado entre execuções: o conteúdo precisa ser único
+	content := []byte("relatorio " + watchDir)
+	first := filepath.Join(watchDir, "relatorio.pdf")
+	second := filepath.Join(watchDir, "relatorio (1).pdf")
+	os.WriteFile(first, content, 0644)
+	handleFile(context.Background(), db, tc, filter, first, false, evCreate)
+	os.WriteFile(second, content, 0644)
+	handleFile(context.Background(), db, tc, filter, second, false, evCreate)
+
+	if fileExists(filepath.Join(destDir, "relatorio (1).pdf")) {
+		t.Errorf("duplicata não deveria ser copiada")
+	}
+	if fileExists(second) {
+		t.Errorf("origem da duplicata deveria ser removida")
+	}
+	orig, _ := store.GetProcessed(db, tc.Name, first)
+	dup, _ := store.GetProcessed(db, tc.Name, second)
+	if orig == nil || dup == nil {
+		t.Fatalf("registros ausentes: original=%v duplicata=%v", orig, dup)
+	}
+	if dup.DuplicateOf != orig.ID {
+		t.Errorf("duplicate_of = %d, esperado %d", dup.DuplicateOf, orig.ID)
+	}
+	if dup.DestDir != "" {
+		t.Errorf("duplicata não deveria ter dest_dir, veio %q", dup.DestDir)
+	}
+}
+
+func TestHandleFileDedupePathContent(t *testing.T) {
+	db, err := initDB(t)
+	if err != nil {
+		t.Fatalf("erro ao iniciar db: %v", err)
+	}
+	defer db.Close()
+
+	watchDir := t.TempDir()
+	destDir := t.TempDir()
+	tc := TenantConfig{
+		Name:      "tenantDedupePC",
+		WatchDir:  watchDir,
+		DestDir:   destDir,
+		Dedupe:    dedupePathContent,
+		Readiness: ReadinessConfig{Strategy: readinessCloseWrite},
+	}
+	filter, _ := newFileFilter(tc)
+	name := filepath.Join(watchDir, "saldo.csv")
+	dest := filepath.Join(destDir, "saldo.csv")
+
+	os.WriteFile(name, []byte("v1"), 0644)
+	handleFile(context.Background(), db, tc, filter, name, false, evCreate)
+	// Mesmo caminho e mesmo conteúdo: ignorado, mas a origem é consumida
+	os.WriteFile(name, []byte("v1"), 0644)
+	os.WriteFile(dest, []byte("alterado no destino"), 0644)
+	handleFile(context.Background(), db, tc, filter, name, false, evCreate)
+	if b, _ := os.ReadFile(dest); string(b) != "alterado no destino" {
+		t.Errorf("conteúdo repetido não deveria ser recopiado, destino = %q", b)
+	}
+	if fileExists(name) {
+		t.Errorf("origem repetida deveria ser removida")
+	}
+	// Mesmo caminho com conteúdo novo: entregue de novo
+	os.WriteFile(name, []byte("v2"), 0644)
+	handleFile(context.Background(), db, tc, filter, name, false, evCreate)
+	if b, _ := os.ReadFile(dest); string(b) != "v2" {
+		t.Errorf("nova versão não foi copiada, destino = %q", b)
+	}
+	rec, _ := store.GetProcessed(db, tc.Name, name)
+	want, _ := sink.FileChecksum(dest, "")
+	if rec == nil || rec.Checksum != want {
+		t.Errorf("checksum não atualizado: %+v", rec)
+	}
+}
+
+func TestValidateDedupe(t *testing.T) {
+	for _, mode := range []string{"", dedupePath, dedupeContent, dedupePathContent} {
+		if err := validateDedupe(mode); err != nil {
+			t.Errorf("modo %q deveria ser válido: %v", mode, err)
+		}
+	}
+	if err := validateDedupe("hash"); err == nil {
+		t.Errorf("esperado erro para modo desconhecido")
+	}
+}
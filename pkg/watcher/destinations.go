@@ -0,0 +1,453 @@
+package watcher
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/thiagozs/go-filewatcher/pkg/sink"
+	"github.com/thiagozs/go-filewatcher/pkg/store"
+)
+
+// DestinationConfig é um dos destinos de entrega do tenant. Opções vazias
+// herdam o valor configurado no tenant.
+type DestinationConfig struct {
+	Name           string          `yaml:"name"`
+	Type           string          `yaml:"type"`
+	Path           string          `yaml:"path"`
+	Optional       bool            `yaml:"optional"` // falha não impede a remoção da origem
+	OnConflict     string          `yaml:"on_conflict"`
+	ConflictSuffix string          `yaml:"conflict_suffix"`
+	VersionHistory int             `yaml:"version_history"`
+	Preserve       []string        `yaml:"preserve"`
+	TransferMode   string          `yaml:"transfer_mode"`
+	Compress       *CompressConfig `yaml:"compress"` // só destinos locais
+	Encrypt        *EncryptConfig  `yaml:"encrypt"`  // só destinos locais
+	DestTemplate   string          `yaml:"dest_template"`
+	S3             *S3Config       `yaml:"s3"`
+	SFTP           *SFTPConfig     `yaml:"sftp"`
+	HTTP           *HTTPConfig     `yaml:"http"`
+}
+
+// Nome do destino implícito quando o tenant só informa dest_dir.
+const defaultDestination = "default"
+
+// Tipos de destino.
+const (
+	destinationLocal  = "local"  // cópia para path (padrão)
+	destinationCustom = "custom" // sink definido pelo programa com WithSink
+	destinationS3     = "s3"     // bucket S3 ou compatível (ver S3Config)
+	destinationSFTP   = "sftp"   // servidor SFTP (ver SFTPConfig)
+	destinationHTTP   = "http"   // upload para um endpoint HTTP (ver HTTPConfig)
+)
+
+// Situação da entrega em um destino (tabela deliveries).
+const (
+	deliveryDone   = "done"
+	deliveryFailed = "failed"
+)
+
+// delivery é o resultado da entrega do arquivo em um destino.
+type delivery struct {
+	Destination string
+	DestPath    string
+	Status      string
+	Method      string
+	Checksum    string
+	ETag        string
+	StoredSize  int64  // bytes gravados no destino
+	Compression string // algoritmo da compressão aplicada, se houver
+	KeyID       string // chave da cifragem aplicada, se houver
+	HTTPStatus  int    // status da resposta, nos destinos HTTP
+	Response    string // começo do corpo da resposta, nos destinos HTTP
+	Route       string // regra de routes que escolheu o destino
+	Err         error
+	Required    bool
+}
+
+// validateDestinations valida a lista de destinos e define dest_dir como o
+// caminho do primeiro destino, usado como destino principal.
+func validateDestinations(tc *TenantConfig) error {
+	if len(tc.Destinations) == 0 {
+		return nil
+	}
+	// Validate pode rodar de novo sobre um config já validado
+	if tc.DestDir != "" && tc.DestDir != tc.Destinations[0].Path {
+		return fmt.Errorf("dest_dir and destinations are mutually exclusive")
+	}
+	seen := make(map[string]bool)
+	for _, d := range tc.Destinations {
+		if err := validateDestination(*tc, d); err != nil {
+			return err
+		}
+		if seen[d.Name] {
+			return fmt.Errorf("duplicate destination %q", d.Name)
+		}
+		seen[d.Name] = true
+	}
+	tc.DestDir = tc.Destinations[0].Path
+	return nil
+}
+
+// validateDestination valida um destino e as opções efetivas dele no tenant.
+func validateDestination(tc TenantConfig, d DestinationConfig) error {
+	switch d.Type {
+	case "", destinationLocal:
+		if d.Name == "" || d.Path == "" {
+			return fmt.Errorf("destinations require name and path")
+		}
+	case destinationCustom:
+		if d.Name == "" {
+			return fmt.Errorf("destinations require name")
+		}
+	case destinationS3:
+		if d.Name == "" {
+			return fmt.Errorf("destinations require name")
+		}
+		if err := d.S3.validate(); err != nil {
+			return fmt.Errorf("destination %s: %w", d.Name, err)
+		}
+	case destinationSFTP:
+		if d.Name == "" {
+			return fmt.Errorf("destinations require name")
+		}
+		if err := d.SFTP.validate(); err != nil {
+			return fmt.Errorf("destination %s: %w", d.Name, err)
+		}
+	case destinationHTTP:
+		if d.Name == "" {
+			return fmt.Errorf("destinations require name")
+		}
+		if err := d.HTTP.validate(); err != nil {
+			return fmt.Errorf("destination %s: %w", d.Name, err)
+		}
+	default:
+		return fmt.Errorf("destination %s: unknown type %q", d.Name, d.Type)
+	}
+	if (d.Compress != nil || d.Encrypt != nil) && d.Type != "" && d.Type != destinationLocal {
+		return fmt.Errorf("destination %s: compress and encrypt are only supported by local destinations", d.Name)
+	}
+	if err := d.Compress.validate(); err != nil {
+		return fmt.Errorf("destination %s: %w", d.Name, err)
+	}
+	if err := d.Encrypt.validate(); err != nil {
+		return fmt.Errorf("destination %s: %w", d.Name, err)
+	}
+	dtc := tc.forDestination(d)
+	if err := validateConflict(dtc); err != nil {
+		return fmt.Errorf("destination %s: %w", d.Name, err)
+	}
+	if err := validatePreserve(dtc.Preserve); err != nil {
+		return fmt.Errorf("destination %s: %w", d.Name, err)
+	}
+	if err := validateTransferMode(dtc.TransferMode); err != nil {
+		return fmt.Errorf("destination %s: %w", d.Name, err)
+	}
+	if err := validateTemplate(dtc); err != nil {
+		return fmt.Errorf("destination %s: %w", d.Name, err)
+	}
+	return nil
+}
+
+// configuredSink monta o sink dos destinos remotos declarados no config. Para
+// local e custom retorna nil.
+func configuredSink(tc TenantConfig, d DestinationConfig) (sink.Sink, error) {
+	switch d.Type {
+	case destinationS3:
+		return newS3Sink(tc, d)
+	case destinationSFTP:
+		return newSFTPSink(tc, d)
+	case destinationHTTP:
+		return newHTTPSink(tc, d)
+	}
+	return nil, nil
+}
+
+// destinations retorna os destinos do tenant; sem a lista, dest_dir é o
+// único destino.
+func (tc TenantConfig) destinations() []DestinationConfig {
+	if len(tc.Destinations) > 0 {
+		return tc.Destinations
+	}
+	return []DestinationConfig{{Name: defaultDestination, Path: tc.DestDir}}
+}
+
+func (tc TenantConfig) findDestination(name string) (DestinationConfig, bool) {
+	for _, d := range tc.allDestinations() {
+		if d.Name == name {
+			return d, true
+		}
+	}
+	return DestinationConfig{}, false
+}
+
+// forDestination retorna a configuração efetiva do tenant para um destino.
+func (tc TenantConfig) forDestination(d DestinationConfig) TenantConfig {
+	dtc := tc
+	dtc.DestDir = d.Path
+	dtc.Destinations = nil
+	if d.OnConflict != "" {
+		dtc.OnConflict = d.OnConflict
+	}
+	if d.ConflictSuffix != "" {
+		dtc.ConflictSuffix = d.ConflictSuffix
+	}
+	if d.VersionHistory != 0 {
+		dtc.VersionHistory = d.VersionHistory
+	}
+	if d.Preserve != nil {
+		dtc.Preserve = d.Preserve
+	}
+	if d.TransferMode != "" {
+		dtc.TransferMode = d.TransferMode
+	}
+	if d.DestTemplate != "" {
+		dtc.DestTemplate = d.DestTemplate
+	}
+	if d.Compress != nil {
+		dtc.Compress = d.Compress
+	}
+	if d.Encrypt != nil {
+		dtc.Encrypt = d.Encrypt
+	}
+	return dtc
+}
+
+// deliverAll entrega name em todos os destinos do tenant. fi deve ser obtido
+// antes da entrega (ver preserveMetadata). Com mais de um destino a origem só
+// pode ser removida no final, então move se comporta como cópia. file é o nome
+// registrado em processed_files (nos arquivos extraídos, difere de name). A
+// situação de cada destino é gravada assim que ele termina, e os destinos que
+// já receberam esta versão do arquivo numa tentativa anterior não recebem de
+// novo.
+func deliverAll(ctx context.Context, db *sql.DB, tc TenantConfig, name, file string, fi os.FileInfo, keepSource bool) []delivery {
+	// Com routes, a regra que casar com o arquivo escolhe o destino
+	tc, route := routeFile(tc, name, fi)
+	dests := tc.destinations()
+	if len(dests) > 1 {
+		keepSource = true
+	}
+	done, err := pendingDeliveries(db, tc.Name, file, fi)
+	if err != nil {
+		log.Printf("[%s] Failed to load previous deliveries of %s: %v", tc.Name, file, err)
+	}
+	// Mesma data de chegada para todos os destinos do arquivo
+	vars := newPathVars(tc, name, fi, time.Now())
+	results := make([]delivery, 0, len(dests))
+	for _, d := range dests {
+		if r, ok := done[d.Name]; ok {
+			log.Printf("[%s] File %s already delivered to destination %s in a previous attempt. Skipping.", tc.Name, name, d.Name)
+			r.Required, r.Route = !d.Optional, route
+			results = append(results, r)
+			continue
+		}
+		r := deliverTo(ctx, db, tc, d, name, fi, vars, keepSource)
+		r.Route = route
+		runDeliveryHook(db, tc, name, fi, r)
+		if err := savePendingDelivery(db, tc.Name, file, fi, r); err != nil {
+			log.Printf("[%s] Failed to record delivery of %s to destination %s: %v", tc.Name, file, d.Name, err)
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+// deliverTo entrega o arquivo em um destino, passando pelos processadores do
+// tenant. Sem um sink próprio (WithSink), usa a entrega local.
+func deliverTo(ctx context.Context, db *sql.DB, tc TenantConfig, d DestinationConfig, name string, fi os.FileInfo, vars *pathVars, keepSource bool) delivery {
+	res := delivery{Destination: d.Name, Required: !d.Optional, Status: deliveryFailed}
+	var receipt sink.Receipt
+	f := sink.File{
+		Tenant:      tc.Name,
+		Destination: d.Name,
+		Source:      name,
+		Path:        name,
+		RelPath:     relPath(tc, name),
+		Info:        fi,
+		Arrival:     vars.Arrival,
+		Receipt:     &receipt,
+	}
+	s, custom := tc.sinks[d.Name]
+	if custom {
+		s = hookedSink(db, tc, vars, s)
+	} else {
+		s = &localSink{db: db, tc: tc.forDestination(d), vars: vars, keepSource: keepSource}
+	}
+	err := sink.Chain(s, tc.processors...).Deliver(ctx, f)
+	res.HTTPStatus, res.Response = receipt.Status, receipt.Response
+	if err != nil {
+		if custom {
+			log.Printf("[%s] Failed to deliver %s to destination %s: %v", tc.Name, name, d.Name, err)
+			// Como na cópia local, a origem fica intacta para nova tentativa
+			reason := ""
+			switch {
+			case errors.Is(err, sink.ErrChecksumMismatch):
+				reason = "checksum_mismatch"
+			case receipt.Status != 0:
+				reason = "http_status"
+			}
+			if reason != "" {
+				if err := store.RecordFailure(db, tc.Name, name, reason, err); err != nil {
+					log.Printf("[%s] Failed to record failure: %v", tc.Name, err)
+				}
+			}
+		}
+		res.Err = err
+		return res
+	}
+	if custom {
+		log.Printf("[%s] Delivered %s to destination %s (%s)", tc.Name, name, d.Name, receipt.Location)
+	}
+	res.Status, res.DestPath, res.Method, res.Checksum, res.ETag = deliveryDone, receipt.Location, receipt.Method, receipt.Checksum, receipt.ETag
+	res.StoredSize, res.Compression, res.KeyID = receipt.Size, receipt.Compression, receipt.KeyID
+	return res
+}
+
+// requiredDelivered informa se todos os destinos obrigatórios receberam o
+// arquivo, retornando a primeira entrega concluída como principal.
+func requiredDelivered(results []delivery) (delivery, bool) {
+	var primary delivery
+	ok := true
+	for _, r := range results {
+		if r.Status != deliveryDone {
+			if r.Required {
+				ok = false
+			}
+			continue
+		}
+		if primary.Status == "" {
+			primary = r
+		}
+	}
+	return primary, ok && primary.Status == deliveryDone
+}
+
+// sourceMoved informa se alguma entrega consumiu a origem com rename.
+func sourceMoved(results []delivery) bool {
+	for _, r := range results {
+		if r.Method == transferMove {
+			return true
+		}
+	}
+	return false
+}
+
+// saveDeliveries registra a situação de cada destino do arquivo processado.
+func saveDeliveries(db *sql.DB, tenant, file string, results []delivery) error {
+	var id int64
+	if err := db.QueryRow("SELECT id FROM processed_files WHERE tenant = ? AND file = ?", tenant, file).Scan(&id); err != nil {
+		return err
+	}
+	for _, r := range results {
+		if err := saveDelivery(db, id, r); err != nil {
+			return err
+		}
+	}
+	// As entregas das tentativas passam a valer pelo registro do arquivo
+	if _, err := db.Exec("DELETE FROM deliveries WHERE tenant = ? AND file = ? AND processed_id IS NULL", tenant, file); err != nil {
+		return err
+	}
+	return linkHookRuns(db, id, tenant, file)
+}
+
+func saveDelivery(db *sql.DB, processedID int64, r delivery) error {
+	var errMsg string
+	if r.Err != nil {
+		errMsg = r.Err.Error()
+	}
+	_, err := db.Exec(`
+        INSERT INTO deliveries(processed_id, destination, dest_path, status, transfer_method, checksum, etag, stored_size, compression, key_id, response_status, response_body, error) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+        ON CONFLICT(processed_id, destination) DO UPDATE SET
+            dest_path = COALESCE(excluded.dest_path, dest_path),
+            status = excluded.status,
+            transfer_method = COALESCE(excluded.transfer_method, transfer_method),
+            checksum = COALESCE(excluded.checksum, checksum),
+            etag = COALESCE(excluded.etag, etag),
+            stored_size = COALESCE(excluded.stored_size, stored_size),
+            compression = COALESCE(excluded.compression, compression),
+            key_id = COALESCE(excluded.key_id, key_id),
+            response_status = excluded.response_status,
+            response_body = excluded.response_body,
+            error = excluded.error,
+            delivered_at = CURRENT_TIMESTAMP`,
+		processedID, r.Destination, store.NullString(r.DestPath), r.Status, store.NullString(r.Method), store.NullString(r.Checksum), store.NullString(r.ETag), store.NullInt(int(r.StoredSize)), store.NullString(r.Compression), store.NullString(r.KeyID), store.NullInt(r.HTTPStatus), store.NullString(r.Response), store.NullString(errMsg),
+	)
+	return err
+}
+
+// savePendingDelivery grava a situação de um destino do arquivo antes do
+// registro em processed_files, junto com a versão da origem entregue.
+func savePendingDelivery(db *sql.DB, tenant, file string, fi os.FileInfo, r delivery) error {
+	var errMsg string
+	if r.Err != nil {
+		errMsg = r.Err.Error()
+	}
+	_, err := db.Exec(`
+        INSERT INTO deliveries(tenant, file, source_size, source_mtime, destination, dest_path, status, transfer_method, checksum, etag, stored_size, compression, key_id, response_status, response_body, error) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+        ON CONFLICT(tenant, file, destination) WHERE processed_id IS NULL DO UPDATE SET
+            source_size = excluded.source_size,
+            source_mtime = excluded.source_mtime,
+            dest_path = excluded.dest_path,
+            status = excluded.status,
+            transfer_method = excluded.transfer_method,
+            checksum = excluded.checksum,
+            etag = excluded.etag,
+            stored_size = excluded.stored_size,
+            compression = excluded.compression,
+            key_id = excluded.key_id,
+            response_status = excluded.response_status,
+            response_body = excluded.response_body,
+            error = excluded.error,
+            delivered_at = CURRENT_TIMESTAMP`,
+		tenant, file, fi.Size(), fi.ModTime().UnixNano(), r.Destination, store.NullString(r.DestPath), r.Status, store.NullString(r.Method), store.NullString(r.Checksum), store.NullString(r.ETag), store.NullInt(int(r.StoredSize)), store.NullString(r.Compression), store.NullString(r.KeyID), store.NullInt(r.HTTPStatus), store.NullString(r.Response), store.NullString(errMsg),
+	)
+	return err
+}
+
+// pendingDeliveries retorna, por destino, as entregas concluídas do arquivo
+// ainda não registrado. Só contam as que entregaram a mesma versão da origem
+// (tamanho e mtime).
+func pendingDeliveries(db *sql.DB, tenant, file string, fi os.FileInfo) (map[string]delivery, error) {
+	rows, err := db.Query(`
+        SELECT destination, COALESCE(dest_path, ''), COALESCE(transfer_method, ''), COALESCE(checksum, ''), COALESCE(etag, ''), COALESCE(stored_size, 0),
+               COALESCE(compression, ''), COALESCE(key_id, ''), COALESCE(response_status, 0), COALESCE(response_body, '')
+        FROM deliveries
+        WHERE tenant = ? AND file = ? AND processed_id IS NULL AND status = ? AND source_size = ? AND source_mtime = ?`,
+		tenant, file, deliveryDone, fi.Size(), fi.ModTime().UnixNano())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	done := make(map[string]delivery)
+	for rows.Next() {
+		d := delivery{Status: deliveryDone}
+		if err := rows.Scan(&d.Destination, &d.DestPath, &d.Method, &d.Checksum, &d.ETag, &d.StoredSize, &d.Compression, &d.KeyID, &d.HTTPStatus, &d.Response); err != nil {
+			return nil, err
+		}
+		done[d.Destination] = d
+	}
+	return done, rows.Err()
+}
+
+// recordedDeliveries retorna o destino, o caminho, a compressão e a chave de cada entrega concluída
+// do arquivo processado.
+func recordedDeliveries(db *sql.DB, processedID int64) ([]delivery, error) {
+	rows, err := db.Query("SELECT destination, dest_path, COALESCE(compression, ''), COALESCE(key_id, '') FROM deliveries WHERE processed_id = ? AND status = ? AND dest_path IS NOT NULL ORDER BY id", processedID, deliveryDone)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []delivery
+	for rows.Next() {
+		var d delivery
+		if err := rows.Scan(&d.Destination, &d.DestPath, &d.Compression, &d.KeyID); err != nil {
+			return nil, err
+		}
+		list = append(list, d)
+	}
+	return list, rows.Err()
+}
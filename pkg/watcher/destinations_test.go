@@ -0,0 +1,238 @@
+package watcher
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/thiagozs/go-filewatcher/pkg/sink"
+	"github.com/thiagozs/go-filewatcher/pkg/store"
+)
+
+func TestLoadConfigDestinations(t *testing.T) {
+	f, err := os.CreateTemp("", "config-*.yaml")
+	if err != nil {
+		t.Fatalf("erro ao criar temp: %v", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`tenants:
+  - name: notas
+    watch_dir: /tmp/notas/in
+    on_conflict: rename
+    destinations:
+      - name: archive
+        path: /tmp/notas/archive
+        on_conflict: version
+        version_history: 5
+      - name: inbox
+        path: /tmp/notas/inbox
+      - name: backup
+        path: /mnt/backup/notas
+        optional: true
+`)
+	f.Close()
+
+	cfg, err := LoadConfig(f.Name())
+	if err != nil {
+		t.Fatalf("erro ao carregar config: %v", err)
+	}
+	tc := cfg.Tenants[0]
+	if tc.DestDir != "/tmp/notas/archive" {
+		t.Errorf("dest_dir deveria ser o primeiro destino, veio %q", tc.DestDir)
+	}
+	archive := tc.forDestination(tc.Destinations[0])
+	inbox := tc.forDestination(tc.Destinations[1])
+	if archive.OnConflict != conflictVersion || archive.VersionHistory != 5 {
+		t.Errorf("opções do destino não aplicadas: %+v", archive)
+	}
+	if inbox.OnConflict != conflictRename || inbox.DestDir != "/tmp/notas/inbox" {
+		t.Errorf("destino deveria herdar opções do tenant: %+v", inbox)
+	}
+
+	bad := TenantConfig{Name: "x", DestDir: "/a", Destinations: []DestinationConfig{{Name: "b", Path: "/b"}}}
+	if err := validateDestinations(&bad); err == nil {
+		t.Errorf("esperado erro com dest_dir e destinations juntos")
+	}
+}
+
+func multiDestTenant(t *testing.T, name string) TenantConfig {
+	tc := TenantConfig{
+		Name:     name,
+		WatchDir: t.TempDir(),
+		Destinations: []DestinationConfig{
+			{Name: "archive", Path: t.TempDir()},
+			{Name: "inbox", Path: t.TempDir()},
+			// Caminho sob um arquivo regular: a entrega sempre falha
+			{Name: "backup", Path: filepath.Join(os.DevNull, "backup"), Optional: true},
+		},
+		Readiness: ReadinessConfig{Strategy: readinessCloseWrite},
+	}
+	if err := validateDestinations(&tc); err != nil {
+		t.Fatalf("erro ao validar destinos: %v", err)
+	}
+	return tc
+}
+
+func TestHandleFileMultipleDestinations(t *testing.T) {
+	db, err := initDB(t)
+	if err != nil {
+		t.Fatalf("erro ao iniciar db: %v", err)
+	}
+	defer db.Close()
+
+	tc := multiDestTenant(t, "tenantFanout")
+	filter, _ := newFileFilter(tc)
+	name := filepath.Join(tc.WatchDir, "nfe.xml")
+	os.WriteFile(name, []byte("<nfe/>"), 0644)
+
+	handleFile(context.Background(), db, tc, filter, name, false, evCreate)
+
+	for _, d := range tc.Destinations[:2] {
+		if b, _ := os.ReadFile(filepath.Join(d.Path, "nfe.xml")); string(b) != "<nfe/>" {
+			t.Errorf("destino %s sem o arquivo", d.Name)
+		}
+	}
+	if fileExists(name) {
+		t.Errorf("origem deveria ser removida: só o destino opcional falhou")
+	}
+	rec, _ := store.GetProcessed(db, tc.Name, name)
+	if rec == nil {
+		t.Fatalf("arquivo não registrado")
+	}
+	status := make(map[string]string)
+	rows, err := db.Query("SELECT destination, status FROM deliveries WHERE processed_id = ?", rec.ID)
+	if err != nil {
+		t.Fatalf("erro ao consultar deliveries: %v", err)
+	}
+	for rows.Next() {
+		var dest, st string
+		rows.Scan(&dest, &st)
+		status[dest] = st
+	}
+	rows.Close()
+	if status["archive"] != deliveryDone || status["inbox"] != deliveryDone || status["backup"] != deliveryFailed {
+		t.Errorf("situação das entregas incorreta: %v", status)
+	}
+
+	// --recopy --destination inbox restaura só esse destino
+	inboxFile := filepath.Join(tc.Destinations[1].Path, "nfe.xml")
+	archiveFile := filepath.Join(tc.Destinations[0].Path, "nfe.xml")
+	os.Remove(inboxFile)
+	os.Remove(archiveFile)
+	os.WriteFile(name, []byte("<nfe/>"), 0644)
+	cfg := &Config{Tenants: []TenantConfig{tc}}
+	if err := recopyFiles(db, cfg, tc.Name, "inbox", []int{int(rec.ID)}, false); err != nil {
+		t.Fatalf("erro no recopy: %v", err)
+	}
+	if !fileExists(inboxFile) {
+		t.Errorf("recopy não restaurou o destino inbox")
+	}
+	if fileExists(archiveFile) {
+		t.Errorf("recopy com --destination não deveria tocar outros destinos")
+	}
+	if err := recopyFiles(db, cfg, tc.Name, "nope", []int{int(rec.ID)}, false); err == nil {
+		t.Errorf("esperado erro para destino desconhecido")
+	}
+}
+
+func TestHandleFileRequiredDestinationFails(t *testing.T) {
+	db, err := initDB(t)
+	if err != nil {
+		t.Fatalf("erro ao iniciar db: %v", err)
+	}
+	defer db.Close()
+
+	tc := multiDestTenant(t, "tenantFanoutFail")
+	tc.Destinations[2].Optional = false
+	filter, _ := newFileFilter(tc)
+	name := filepath.Join(tc.WatchDir, "boleto.pdf")
+	os.WriteFile(name, []byte("%PDF"), 0644)
+
+	handleFile(context.Background(), db, tc, filter, name, false, evCreate)
+
+	if !fileExists(name) {
+		t.Errorf("origem deveria ser mantida quando um destino obrigatório falha")
+	}
+	if rec, _ := store.GetProcessed(db, tc.Name, name); rec != nil {
+		t.Errorf("arquivo não deveria ser registrado como processado")
+	}
+}
+
+func TestHandleFileRetriesOnlyMissingDestinations(t *testing.T) {
+	db, err := initDB(t)
+	if err != nil {
+		t.Fatalf("erro ao iniciar db: %v", err)
+	}
+	defer db.Close()
+
+	// Destino "desmontado": um arquivo regular no lugar do diretório
+	mount := filepath.Join(t.TempDir(), "mnt")
+	os.WriteFile(mount, nil, 0644)
+	tc := TenantConfig{
+		Name:     "tenantFanoutRetry",
+		WatchDir: t.TempDir(),
+		Destinations: []DestinationConfig{
+			{Name: "remote", Type: destinationCustom},
+			{Name: "inbox", Path: mount},
+		},
+		Readiness: ReadinessConfig{Strategy: readinessCloseWrite},
+	}
+	if err := validateDestinations(&tc); err != nil {
+		t.Fatalf("erro ao validar destinos: %v", err)
+	}
+	sent := 0
+	tc.sinks = map[string]sink.Sink{"remote": sink.SinkFunc(func(ctx context.Context, f sink.File) error {
+		sent++
+		f.Record(sink.Receipt{Location: "mem://" + f.RelPath, Method: "memory"})
+		return nil
+	})}
+	filter, _ := newFileFilter(tc)
+	name := filepath.Join(tc.WatchDir, "nfe.xml")
+	os.WriteFile(name, []byte("<nfe/>"), 0644)
+
+	if err := handleFile(context.Background(), db, tc, filter, name, false, evCreate); err == nil {
+		t.Fatalf("esperado erro com o destino inbox indisponível")
+	}
+	// A situação de cada destino fica gravada antes do registro do arquivo
+	status := make(map[string]string)
+	rows, err := db.Query("SELECT destination, status FROM deliveries WHERE tenant = ? AND file = ? AND processed_id IS NULL", tc.Name, name)
+	if err != nil {
+		t.Fatalf("erro ao consultar deliveries: %v", err)
+	}
+	for rows.Next() {
+		var dest, st string
+		rows.Scan(&dest, &st)
+		status[dest] = st
+	}
+	rows.Close()
+	if status["remote"] != deliveryDone || status["inbox"] != deliveryFailed {
+		t.Errorf("situação das entregas pendentes incorreta: %v", status)
+	}
+
+	os.Remove(mount)
+	os.MkdirAll(mount, 0755)
+	if err := handleFile(context.Background(), db, tc, filter, name, false, evCreate); err != nil {
+		t.Fatalf("erro na nova tentativa: %v", err)
+	}
+	if sent != 1 {
+		t.Errorf("destino remote recebeu o arquivo %d vezes, esperado 1", sent)
+	}
+	if b, _ := os.ReadFile(filepath.Join(mount, "nfe.xml")); string(b) != "<nfe/>" {
+		t.Errorf("destino inbox sem o arquivo")
+	}
+	rec, _ := store.GetProcessed(db, tc.Name, name)
+	if rec == nil {
+		t.Fatalf("arquivo não registrado")
+	}
+	var location string
+	db.QueryRow("SELECT dest_path FROM deliveries WHERE processed_id = ? AND destination = 'remote' AND status = ?", rec.ID, deliveryDone).Scan(&location)
+	if location != "mem://nfe.xml" {
+		t.Errorf("entrega anterior do remote não registrada: %q", location)
+	}
+	var pending int
+	db.QueryRow("SELECT COUNT(*) FROM deliveries WHERE tenant = ? AND file = ? AND processed_id IS NULL", tc.Name, name).Scan(&pending)
+	if pending != 0 {
+		t.Errorf("entregas pendentes deveriam ser removidas após o registro: %d", pending)
+	}
+}
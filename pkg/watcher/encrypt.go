@@ -0,0 +1,128 @@
+package watcher
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/thiagozs/go-filewatcher/pkg/sink"
+)
+
+// EncryptConfig cifra com age o arquivo gravado num destino local. O watcher
+// só precisa das chaves públicas; a privada (identity_file) é usada apenas
+// pelo comando decrypt e pode ficar fora do servidor.
+type EncryptConfig struct {
+	RecipientsFile string `yaml:"recipients_file"` // chaves públicas age, uma por linha
+	IdentityFile   string `yaml:"identity_file"`   // chave privada, usada só pelo decrypt
+	KeyID          string `yaml:"key_id"`          // padrão: fingerprint dos recipients
+}
+
+func (c *EncryptConfig) validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.RecipientsFile == "" {
+		return fmt.Errorf("encrypt requires recipients_file")
+	}
+	if _, err := c.encryption(); err != nil {
+		return fmt.Errorf("invalid encrypt: %w", err)
+	}
+	return nil
+}
+
+// encryption lê os recipients a cada uso, para que a troca do arquivo valha
+// sem reiniciar o serviço.
+func (c *EncryptConfig) encryption() (*sink.Encryption, error) {
+	recipients, keyID, err := sink.LoadRecipients(c.RecipientsFile)
+	if err != nil {
+		return nil, err
+	}
+	if c.KeyID != "" {
+		keyID = c.KeyID
+	}
+	return &sink.Encryption{Recipients: recipients, KeyID: keyID}, nil
+}
+
+// encoding retorna a compressão e a cifragem configuradas para o destino.
+func (tc TenantConfig) encoding() (sink.Encoding, error) {
+	var enc sink.Encoding
+	if tc.Compress != nil {
+		c := tc.Compress.compression()
+		enc.Compression = &c
+	}
+	if tc.Encrypt != nil {
+		e, err := tc.Encrypt.encryption()
+		if err != nil {
+			return enc, err
+		}
+		enc.Encryption = e
+	}
+	return enc, nil
+}
+
+// decryptProcessed restaura em out ("-" para stdout) o original de uma
+// entrega cifrada do arquivo processado, conferindo o checksum registrado.
+func decryptProcessed(db *sql.DB, cfg *Config, tenant string, id int, destination, identityFile, out string) error {
+	if tenant == "" {
+		return fmt.Errorf("tenant must be specified for decrypt")
+	}
+	if out == "" {
+		return fmt.Errorf("decrypt requires an output path (use - for stdout)")
+	}
+	tc := findTenant(cfg, tenant)
+	var checksum sql.NullString
+	if err := db.QueryRow("SELECT checksum FROM processed_files WHERE id = ? AND tenant = ?", id, tenant).Scan(&checksum); err != nil {
+		return fmt.Errorf("file id %d not found: %w", id, err)
+	}
+	recorded, err := recordedDeliveries(db, int64(id))
+	if err != nil {
+		return err
+	}
+	var target delivery
+	for _, r := range recorded {
+		if r.KeyID != "" && (destination == "" || r.Destination == destination) {
+			target = r
+			break
+		}
+	}
+	if target.DestPath == "" {
+		return fmt.Errorf("file id %d has no encrypted delivery", id)
+	}
+	if identityFile == "" {
+		if d, ok := tc.findDestination(target.Destination); ok {
+			if dtc := tc.forDestination(d); dtc.Encrypt != nil {
+				identityFile = dtc.Encrypt.IdentityFile
+			}
+		}
+	}
+	if identityFile == "" {
+		return fmt.Errorf("no identity file for destination %s (use --identity)", target.Destination)
+	}
+	identities, err := sink.LoadIdentities(identityFile)
+	if err != nil {
+		return err
+	}
+	algo := tc.Checksum
+	if checksum.Valid {
+		algo, _ = sink.SplitChecksum(checksum.String)
+	}
+
+	var sum string
+	if out == "-" {
+		sum, err = sink.Decode(os.Stdout, target.DestPath, algo, target.Compression, identities)
+	} else {
+		sum, err = sink.DecodeFile(target.DestPath, out, algo, target.Compression, identities)
+	}
+	if err != nil {
+		return err
+	}
+	if checksum.Valid && sum != checksum.String {
+		if out != "-" {
+			os.Remove(out)
+		}
+		return fmt.Errorf("%s: expected %s, got %s: %w", target.DestPath, checksum.String, sum, sink.ErrChecksumMismatch)
+	}
+	log.Printf("[Decrypt] Restored file id %d from %s (key %s) to %s (%s)", id, target.DestPath, target.KeyID, out, sink.ShortChecksum(sum))
+	return nil
+}
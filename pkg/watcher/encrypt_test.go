@@ -0,0 +1,115 @@
+package watcher
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/thiagozs/go-filewatcher/pkg/sink"
+	"github.com/thiagozs/go-filewatcher/pkg/store"
+)
+
+func TestEncryptValidation(t *testing.T) {
+	dir := t.TempDir()
+	broken := filepath.Join(dir, "broken.txt")
+	os.WriteFile(broken, []byte("não é uma chave age\n"), 0644)
+	cases := map[string]DestinationConfig{
+		"sem recipients":      {Name: "a", Path: "/tmp/a", Encrypt: &EncryptConfig{}},
+		"arquivo inexistente": {Name: "a", Path: "/tmp/a", Encrypt: &EncryptConfig{RecipientsFile: filepath.Join(dir, "nope.txt")}},
+		"recipient inválido":  {Name: "a", Path: "/tmp/a", Encrypt: &EncryptConfig{RecipientsFile: broken}},
+		"destino remoto":      {Name: "a", Type: destinationHTTP, Encrypt: &EncryptConfig{RecipientsFile: broken}},
+	}
+	for name, d := range cases {
+		tc := TenantConfig{Name: "x", WatchDir: "/tmp/x", Destinations: []DestinationConfig{d}}
+		if err := validateDestinations(&tc); err == nil {
+			t.Errorf("%s: esperado erro", name)
+		}
+	}
+}
+
+func TestHandleFileEncryptedDestination(t *testing.T) {
+	db, err := initDB(t)
+	if err != nil {
+		t.Fatalf("erro ao iniciar db: %v", err)
+	}
+	defer db.Close()
+
+	keys := t.TempDir()
+	id, _ := age.GenerateX25519Identity()
+	recipients := filepath.Join(keys, "recipients.txt")
+	identity := filepath.Join(keys, "identity.txt")
+	os.WriteFile(recipients, []byte(id.Recipient().String()+"\n"), 0644)
+	os.WriteFile(identity, []byte(id.String()+"\n"), 0600)
+
+	tc := TenantConfig{
+		Name:     "tenantEncrypt",
+		WatchDir: t.TempDir(),
+		Destinations: []DestinationConfig{
+			{
+				Name:     "vault",
+				Path:     t.TempDir(),
+				Compress: &CompressConfig{Algorithm: sink.CompressGzip},
+				Encrypt:  &EncryptConfig{RecipientsFile: recipients, IdentityFile: identity, KeyID: "fiscal-2024"},
+			},
+			{Name: "inbox", Path: t.TempDir()},
+		},
+		Readiness: ReadinessConfig{Strategy: readinessCloseWrite},
+	}
+	cfg := &Config{Tenants: []TenantConfig{tc}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("erro ao validar: %v", err)
+	}
+	tc = cfg.Tenants[0]
+	filter, _ := newFileFilter(tc)
+	name := filepath.Join(tc.WatchDir, "folha.csv")
+	content := []byte("cpf;nome;salario\n123.456.789-00;Fulano;5000,00\n")
+	os.WriteFile(name, content, 0644)
+	want, _ := sink.FileChecksum(name, "")
+
+	if err := handleFile(context.Background(), db, tc, filter, name, true, evCreate); err != nil {
+		t.Fatalf("erro no handleFile: %v", err)
+	}
+	sealed := filepath.Join(tc.Destinations[0].Path, "folha.csv.gz.age")
+	if b, err := os.ReadFile(sealed); err != nil || strings.Contains(string(b), "Fulano") {
+		t.Fatalf("destino deveria receber a cópia cifrada: %v", err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(tc.Destinations[1].Path, "folha.csv")); string(b) != string(content) {
+		t.Errorf("destino sem cifragem deveria receber o original")
+	}
+	rec, _ := store.GetProcessed(db, tc.Name, name)
+	if rec == nil || rec.DestPath != sealed || rec.Checksum != want || rec.KeyID != "fiscal-2024" || rec.Compression != sink.CompressGzip {
+		t.Fatalf("registro incorreto: %+v", rec)
+	}
+	recorded, _ := recordedDeliveries(db, rec.ID)
+	if len(recorded) != 2 || recorded[0].KeyID != "fiscal-2024" || recorded[1].KeyID != "" {
+		t.Errorf("key_id não registrado nas entregas: %+v", recorded)
+	}
+
+	// --restore não decifra; o decrypt usa o identity_file do destino
+	os.Remove(name)
+	recopyFiles(db, cfg, tc.Name, "vault", []int{int(rec.ID)}, true)
+	if fileExists(filepath.Join(tc.Destinations[0].Path, "folha.csv.gz")) {
+		t.Errorf("restore não deveria gravar conteúdo de uma entrega cifrada")
+	}
+	out := filepath.Join(t.TempDir(), "folha.csv")
+	if err := decryptProcessed(db, cfg, tc.Name, int(rec.ID), "", "", out); err != nil {
+		t.Fatalf("erro no decrypt: %v", err)
+	}
+	if b, _ := os.ReadFile(out); string(b) != string(content) {
+		t.Errorf("decrypt não restaurou o original: %q", b)
+	}
+
+	// Uma chave que não é recipient da cópia não decifra
+	wrong, _ := age.GenerateX25519Identity()
+	wrongFile := filepath.Join(keys, "wrong.txt")
+	os.WriteFile(wrongFile, []byte(wrong.String()+"\n"), 0600)
+	if err := decryptProcessed(db, cfg, tc.Name, int(rec.ID), "vault", wrongFile, out+".2"); err == nil {
+		t.Errorf("esperado erro com identity errada")
+	}
+	if err := decryptProcessed(db, cfg, tc.Name, int(rec.ID), "inbox", "", out+".3"); err == nil {
+		t.Errorf("esperado erro para destino sem cifragem")
+	}
+}
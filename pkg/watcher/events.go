@@ -0,0 +1,139 @@
+package watcher
+
+import (
+	"errors"
+	"log"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// EventPolicy define como os eventos do sistema de arquivos são tratados.
+type EventPolicy struct {
+	// Trata arquivos que chegam por rename (mv para dentro do diretório ou
+	// writers atômicos que criam x.tmp e renomeiam para x) como nova chegada,
+	// mesmo que o nome já tenha sido processado antes. Sem close_write (ou fora
+	// do Linux), o fsnotify só liga o Rename ao Create no mesmo diretório: um mv
+	// de fora do watch_dir chega como criação comum e o nome já processado é
+	// ignorado.
+	RenameAsArrival bool `yaml:"rename_as_arrival"`
+	// Reprocessa um arquivo já processado quando ele é modificado no lugar.
+	ReprocessOnWrite bool `yaml:"reprocess_on_write"`
+	// Somente Linux: processa o arquivo assim que o writer o fecha
+	// (IN_CLOSE_WRITE), sem aguardar a estabilização por tamanho.
+	CloseWrite bool `yaml:"close_write"`
+}
+
+type eventOp int
+
+const (
+	evCreate     eventOp = iota // arquivo ou diretório criado
+	evWrite                     // conteúdo modificado
+	evRemove                    // removido
+	evRename                    // renomeado/movido para fora (nome antigo)
+	evMovedTo                   // renomeado/movido para dentro (nome novo)
+	evCloseWrite                // writer fechou o arquivo após escrita
+	evSentinel                  // sentinela do arquivo chegou (readiness sentinel)
+)
+
+type fileEvent struct {
+	Name string
+	Op   eventOp
+}
+
+// eventSource abstrai o backend de notificação usado por watchTenant.
+type eventSource interface {
+	Add(path string) error
+	Remove(path string) error
+	WatchList() []string
+	Events() <-chan fileEvent
+	Errors() <-chan error
+	Close() error
+	// reportsCloseWrite indica se a fonte emite evCloseWrite.
+	reportsCloseWrite() bool
+}
+
+var errCloseWriteUnsupported = errors.New("close_write events are only supported on Linux")
+
+// newEventSource escolhe o backend conforme a política do tenant: inotify
+// direto quando close_write é pedido (Linux), fsnotify nos demais casos.
+func newEventSource(tc TenantConfig) (eventSource, error) {
+	if tc.Events.CloseWrite {
+		src, err := newCloseWriteSource()
+		if err == nil {
+			return src, nil
+		}
+		if !errors.Is(err, errCloseWriteUnsupported) {
+			return nil, err
+		}
+		debugf("[%s] %v, falling back to size polling", tc.Name, err)
+	}
+	if tc.Events.RenameAsArrival {
+		log.Printf("[%s] rename_as_arrival without close_write only detects renames within the same directory; files moved in from outside watch_dir arrive as plain creates", tc.Name)
+	}
+	return newFsnotifySource()
+}
+
+// Janela para associar um Rename ao Create seguinte no mesmo diretório
+// (fsnotify não expõe o cookie do inotify que liga os dois eventos).
+const renamePairWindow = 100 * time.Millisecond
+
+type fsnotifySource struct {
+	watcher *fsnotify.Watcher
+	events  chan fileEvent
+	done    chan struct{}
+}
+
+func newFsnotifySource() (*fsnotifySource, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	s := &fsnotifySource{watcher: watcher, events: make(chan fileEvent), done: make(chan struct{})}
+	go s.translate()
+	return s, nil
+}
+
+func (s *fsnotifySource) translate() {
+	defer close(s.events)
+	var lastRenameDir string
+	var lastRenameAt time.Time
+	for event := range s.watcher.Events {
+		var ev fileEvent
+		ev.Name = event.Name
+		switch {
+		case event.Has(fsnotify.Create):
+			ev.Op = evCreate
+			if filepath.Dir(event.Name) == lastRenameDir && time.Since(lastRenameAt) < renamePairWindow {
+				ev.Op = evMovedTo
+			}
+		case event.Has(fsnotify.Write):
+			ev.Op = evWrite
+		case event.Has(fsnotify.Remove):
+			ev.Op = evRemove
+		case event.Has(fsnotify.Rename):
+			ev.Op = evRename
+			lastRenameDir, lastRenameAt = filepath.Dir(event.Name), time.Now()
+		default:
+			continue
+		}
+		select {
+		case s.events <- ev:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *fsnotifySource) Add(path string) error    { return s.watcher.Add(path) }
+func (s *fsnotifySource) Remove(path string) error { return s.watcher.Remove(path) }
+func (s *fsnotifySource) WatchList() []string      { return s.watcher.WatchList() }
+func (s *fsnotifySource) Events() <-chan fileEvent { return s.events }
+func (s *fsnotifySource) Errors() <-chan error     { return s.watcher.Errors }
+func (s *fsnotifySource) reportsCloseWrite() bool  { return false }
+
+func (s *fsnotifySource) Close() error {
+	close(s.done)
+	return s.watcher.Close()
+}
@@ -0,0 +1,183 @@
+package watcher
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const closeWriteMask = unix.IN_CREATE | unix.IN_CLOSE_WRITE | unix.IN_MOVED_TO |
+	unix.IN_MOVED_FROM | unix.IN_DELETE | unix.IN_DELETE_SELF
+
+// closeWriteSource usa o inotify diretamente para ter acesso a
+// IN_CLOSE_WRITE e IN_MOVED_TO, que o fsnotify não expõe.
+type closeWriteSource struct {
+	fd     int // Fd() colocaria o arquivo em modo bloqueante
+	file   *os.File
+	events chan fileEvent
+	errors chan error
+	done   chan struct{}
+
+	mu    sync.Mutex
+	paths map[int]string // wd -> diretório
+	wds   map[string]int // diretório -> wd
+}
+
+func newCloseWriteSource() (eventSource, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify init: %w", err)
+	}
+	s := &closeWriteSource{
+		fd: fd,
+		// Com o fd não bloqueante, Close interrompe o Read pendente
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		events: make(chan fileEvent),
+		errors: make(chan error),
+		done:   make(chan struct{}),
+		paths:  make(map[int]string),
+		wds:    make(map[string]int),
+	}
+	go s.readEvents()
+	return s, nil
+}
+
+func (s *closeWriteSource) Add(path string) error {
+	path = filepath.Clean(path)
+	wd, err := unix.InotifyAddWatch(s.fd, path, closeWriteMask)
+	if err != nil {
+		return fmt.Errorf("inotify add watch %s: %w", path, err)
+	}
+	s.mu.Lock()
+	s.paths[wd] = path
+	s.wds[path] = wd
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *closeWriteSource) Remove(path string) error {
+	path = filepath.Clean(path)
+	s.mu.Lock()
+	wd, ok := s.wds[path]
+	delete(s.wds, path)
+	delete(s.paths, wd)
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%s is not watched", path)
+	}
+	_, err := unix.InotifyRmWatch(s.fd, uint32(wd))
+	return err
+}
+
+func (s *closeWriteSource) WatchList() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]string, 0, len(s.wds))
+	for path := range s.wds {
+		list = append(list, path)
+	}
+	return list
+}
+
+func (s *closeWriteSource) Events() <-chan fileEvent { return s.events }
+func (s *closeWriteSource) Errors() <-chan error     { return s.errors }
+func (s *closeWriteSource) reportsCloseWrite() bool  { return true }
+
+func (s *closeWriteSource) Close() error {
+	close(s.done)
+	return s.file.Close()
+}
+
+func (s *closeWriteSource) readEvents() {
+	defer close(s.events)
+	defer close(s.errors)
+	var buf [unix.SizeofInotifyEvent * 4096]byte
+	for {
+		n, err := s.file.Read(buf[:])
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				s.sendError(err)
+			}
+			return
+		}
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			raw := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameLen := int(raw.Len)
+			name := ""
+			if nameLen > 0 {
+				b := buf[offset+unix.SizeofInotifyEvent : offset+unix.SizeofInotifyEvent+nameLen]
+				name = string(b[:clen(b)])
+			}
+			offset += unix.SizeofInotifyEvent + nameLen
+			if !s.dispatch(int(raw.Wd), raw.Mask, name) {
+				return
+			}
+		}
+	}
+}
+
+// dispatch traduz um evento do inotify; retorna false se a fonte foi fechada.
+func (s *closeWriteSource) dispatch(wd int, mask uint32, name string) bool {
+	if mask&unix.IN_Q_OVERFLOW != 0 {
+		return s.sendError(errors.New("inotify event queue overflow"))
+	}
+	s.mu.Lock()
+	dir, ok := s.paths[wd]
+	if mask&unix.IN_IGNORED != 0 && ok {
+		delete(s.paths, wd)
+		delete(s.wds, dir)
+	}
+	s.mu.Unlock()
+	if !ok {
+		return true
+	}
+	path := dir
+	if name != "" {
+		path = filepath.Join(dir, name)
+	}
+	var op eventOp
+	switch {
+	case mask&unix.IN_CLOSE_WRITE != 0:
+		op = evCloseWrite
+	case mask&unix.IN_MOVED_TO != 0:
+		op = evMovedTo
+	case mask&unix.IN_CREATE != 0:
+		op = evCreate
+	case mask&unix.IN_MOVED_FROM != 0:
+		op = evRename
+	case mask&(unix.IN_DELETE|unix.IN_DELETE_SELF) != 0:
+		op = evRemove
+	default:
+		return true
+	}
+	select {
+	case s.events <- fileEvent{Name: path, Op: op}:
+		return true
+	case <-s.done:
+		return false
+	}
+}
+
+func (s *closeWriteSource) sendError(err error) bool {
+	select {
+	case s.errors <- err:
+		return true
+	case <-s.done:
+		return false
+	}
+}
+
+// clen retorna o tamanho do nome terminado em NUL.
+func clen(b []byte) int {
+	for i := range b {
+		if b[i] == 0 {
+			return i
+		}
+	}
+	return len(b)
+}
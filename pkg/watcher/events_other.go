@@ -0,0 +1,7 @@
+//go:build !linux
+
+package watcher
+
+func newCloseWriteSource() (eventSource, error) {
+	return nil, errCloseWriteUnsupported
+}
@@ -0,0 +1,110 @@
+package watcher
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thiagozs/go-filewatcher/pkg/store"
+)
+
+// initDB abre um banco novo, com o schema migrado, no diretório temporário
+// do teste.
+func initDB(t *testing.T) (*sql.DB, error) {
+	t.Helper()
+	return store.Open(filepath.Join(t.TempDir(), "filewatcher.db"))
+}
+
+// waitForContent aguarda até o arquivo ter o conteúdo esperado.
+func waitForContent(path, want string, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if data, err := os.ReadFile(path); err == nil && string(data) == want {
+			return true
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return false
+}
+
+// startWatcher observa o tenant em background, com um banco próprio, e
+// retorna o banco e a função que encerra o watcher.
+func startWatcher(t *testing.T, tc TenantConfig, keepSource bool) (*sql.DB, func()) {
+	db, err := initDB(t)
+	if err != nil {
+		t.Fatalf("erro ao iniciar db: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go watchTenant(ctx, tc, db, &wg, keepSource)
+	time.Sleep(500 * time.Millisecond)
+	return db, func() {
+		cancel()
+		wg.Wait()
+		db.Close()
+	}
+}
+
+func TestWatcher_ReprocessOnWrite(t *testing.T) {
+	dirWatch := t.TempDir()
+	dirDest := t.TempDir()
+	_, stop := startWatcher(t, TenantConfig{
+		Name:     "testReprocessWrite",
+		WatchDir: dirWatch,
+		DestDir:  dirDest,
+		Events:   EventPolicy{ReprocessOnWrite: true},
+	}, true)
+	defer stop()
+
+	src := filepath.Join(dirWatch, "planilha.csv")
+	dst := filepath.Join(dirDest, "planilha.csv")
+	os.WriteFile(src, []byte("v1"), 0644)
+	if !waitForContent(dst, "v1", 10*time.Second) {
+		t.Fatalf("primeira versão não copiada")
+	}
+	os.WriteFile(src, []byte("versao 2"), 0644)
+	if !waitForContent(dst, "versao 2", 10*time.Second) {
+		t.Fatalf("nova versão não reprocessada após escrita")
+	}
+}
+
+func TestWatcher_CloseWriteAndRenameOver(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("close_write disponível apenas no Linux")
+	}
+	dirWatch := t.TempDir()
+	dirDest := t.TempDir()
+	_, stop := startWatcher(t, TenantConfig{
+		Name:     "testCloseWrite",
+		WatchDir: dirWatch,
+		DestDir:  dirDest,
+		Exclude:  []string{"*.tmp"},
+		Events:   EventPolicy{CloseWrite: true, RenameAsArrival: true},
+	}, true)
+	defer stop()
+
+	src := filepath.Join(dirWatch, "dados.txt")
+	dst := filepath.Join(dirDest, "dados.txt")
+	start := time.Now()
+	os.WriteFile(src, []byte("original"), 0644)
+	// Sem close_write a estabilização levaria ao menos 3s
+	if !waitForContent(dst, "original", 2*time.Second) {
+		t.Fatalf("arquivo não processado no close-write (%v)", time.Since(start))
+	}
+
+	// Writer atômico: grava x.tmp e renomeia por cima de x
+	tmp := filepath.Join(dirWatch, "dados.txt.tmp")
+	os.WriteFile(tmp, []byte("atualizado"), 0644)
+	if err := os.Rename(tmp, src); err != nil {
+		t.Fatalf("erro ao renomear: %v", err)
+	}
+	if !waitForContent(dst, "atualizado", 10*time.Second) {
+		t.Fatalf("rename por cima do arquivo não tratado como nova chegada")
+	}
+}
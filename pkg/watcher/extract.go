@@ -0,0 +1,313 @@
+package watcher
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/thiagozs/go-filewatcher/pkg/sink"
+	"github.com/thiagozs/go-filewatcher/pkg/store"
+)
+
+// transferExtract é o método gravado no registro do pacote extraído quando
+// o próprio pacote não é entregue (keep_archive desligado).
+const transferExtract = "extract"
+
+// Separador entre o pacote e o membro no nome registrado dos arquivos
+// extraídos (ex.: /in/lote.zip!/notas/a.csv).
+const memberSeparator = "!/"
+
+// Limites padrão contra zip bombs.
+const (
+	defaultExtractMaxEntries = 10000
+	defaultExtractMaxSize    = 1 << 30
+)
+
+// ExtractConfig descompacta os pacotes (.zip, .tar.gz, .tgz) que chegam no
+// watch_dir e entrega cada arquivo extraído como se tivesse chegado
+// sozinho, nos destinos do tenant. Cada membro é registrado em
+// processed_files com parent_id apontando para o registro do pacote.
+type ExtractConfig struct {
+	MaxEntries  int      `yaml:"max_entries"`  // padrão 10000
+	MaxSize     ByteSize `yaml:"max_size"`     // total descompactado, padrão 1GB
+	Subdir      bool     `yaml:"subdir"`       // extrai em <nome do pacote>/ no destino
+	KeepArchive bool     `yaml:"keep_archive"` // entrega também o próprio pacote
+	WorkDir     string   `yaml:"work_dir"`     // padrão: diretório temporário do sistema
+}
+
+func validateExtract(tc TenantConfig) error {
+	c := tc.Extract
+	if c == nil {
+		return nil
+	}
+	if c.MaxEntries < 0 || c.MaxSize < 0 {
+		return fmt.Errorf("extract limits must not be negative")
+	}
+	if tc.Batch != nil {
+		return fmt.Errorf("extract cannot be combined with batch")
+	}
+	if c.WorkDir != "" {
+		rel, err := filepath.Rel(tc.WatchDir, c.WorkDir)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("extract work_dir must be outside watch_dir")
+		}
+	}
+	return nil
+}
+
+func (c *ExtractConfig) limits() sink.ExtractLimits {
+	l := sink.ExtractLimits{MaxEntries: c.MaxEntries, MaxSize: int64(c.MaxSize)}
+	if l.MaxEntries == 0 {
+		l.MaxEntries = defaultExtractMaxEntries
+	}
+	if l.MaxSize == 0 {
+		l.MaxSize = defaultExtractMaxSize
+	}
+	return l
+}
+
+// extractFormat retorna o formato do arquivo se o tenant extrai pacotes e o
+// nome tem extensão de pacote.
+func extractFormat(tc TenantConfig, name string) string {
+	if tc.Extract == nil {
+		return ""
+	}
+	return sink.DetectArchive(name)
+}
+
+// extractedMember guarda a entrega de um arquivo extraído até o registro.
+type extractedMember struct {
+	file    string // nome registrado: <pacote>!/<membro>
+	path    string // cópia extraída no diretório de trabalho
+	fi      os.FileInfo
+	primary delivery
+	results []delivery
+}
+
+// extractFile descompacta o pacote num diretório de trabalho e entrega cada
+// arquivo extraído nos destinos do tenant. Pacotes inseguros ou acima dos
+// limites são recusados sem nova tentativa (e vão para o failed_dir, se
+// configurado). Se algum membro falhar, nada é registrado e o pacote inteiro
+// é tentado de novo; os membros já entregues caem em on_conflict.
+func extractFile(ctx context.Context, db *sql.DB, tc TenantConfig, name string, fi os.FileInfo, replace, keepSource bool) error {
+	work, err := os.MkdirTemp(tc.Extract.WorkDir, ".gfw-extract-")
+	if err != nil {
+		return fmt.Errorf("%w: extract: %v", errDeliveryFailed, err)
+	}
+	defer os.RemoveAll(work)
+	// Com subdir, os membros ficam sob o nome do pacote no caminho relativo
+	root := work
+	if tc.Extract.Subdir {
+		root = filepath.Join(work, sink.TrimArchiveExt(filepath.Base(name)))
+	}
+	names, err := sink.ExtractArchive(name, sink.DetectArchive(name), root, tc.Extract.limits())
+	if errors.Is(err, sink.ErrUnsafeArchive) || errors.Is(err, sink.ErrArchiveLimit) {
+		rejectArchive(db, tc, name, err)
+		return nil
+	}
+	if err != nil {
+		log.Printf("[%s] Failed to extract %s: %v", tc.Name, name, err)
+		return fmt.Errorf("%w: extract: %v", errDeliveryFailed, err)
+	}
+
+	// Os membros são entregues como arquivos do diretório de trabalho, com o
+	// caminho relativo dentro do pacote
+	mtc := tc
+	mtc.WatchDir, mtc.Recursive = work, true
+	members := make([]extractedMember, 0, len(names))
+	for _, n := range names {
+		p := filepath.Join(root, filepath.FromSlash(n))
+		mfi, err := os.Stat(p)
+		if err != nil {
+			return fmt.Errorf("%w: extract: %v", errDeliveryFailed, err)
+		}
+		results := deliverAll(ctx, db, mtc, p, name+memberSeparator+n, mfi, false)
+		primary, ok := requiredDelivered(results)
+		if !ok {
+			log.Printf("[%s] Member %s of %s was not delivered to every required destination. Archive kept.", tc.Name, n, name)
+			return deliveryError(results)
+		}
+		members = append(members, extractedMember{file: name + memberSeparator + n, path: p, fi: mfi, primary: primary, results: results})
+	}
+
+	rec := store.Processed{
+		Tenant:      tc.Name,
+		File:        name,
+		FileSize:    fi.Size(),
+		SourceMtime: fi.ModTime().UnixNano(),
+		Method:      transferExtract,
+	}
+	var archiveResults []delivery
+	if tc.Extract.KeepArchive {
+		archiveResults = deliverAll(ctx, db, tc, name, name, fi, true)
+		primary, ok := requiredDelivered(archiveResults)
+		if !ok {
+			log.Printf("[%s] Archive %s was not delivered to every required destination. Source kept.", tc.Name, name)
+			return deliveryError(archiveResults)
+		}
+		rec.DestPath, rec.Checksum, rec.Method, rec.ETag = primary.DestPath, primary.Checksum, primary.Method, primary.ETag
+		rec.StoredSize, rec.Compression, rec.KeyID, rec.Route = primary.StoredSize, primary.Compression, primary.KeyID, primary.Route
+	} else if rec.Checksum, err = sink.FileChecksum(name, tc.Checksum); err != nil {
+		log.Printf("[%s] Failed to hash %s: %v", tc.Name, name, err)
+	}
+	if err := recordExtracted(db, tc, rec, archiveResults, members, replace); err != nil {
+		log.Printf("[%s] Failed to record extracted archive %s: %v", tc.Name, name, err)
+	}
+	log.Printf("[%s] Extracted %d files from %s", tc.Name, len(members), name)
+	removeSentinel(tc, name)
+	releaseSource(tc, name, keepSource)
+	return nil
+}
+
+// recordExtracted registra o pacote e, ligados a ele por parent_id, os
+// arquivos extraídos. Membros de uma versão anterior do pacote que não vieram
+// nesta são removidos do banco.
+func recordExtracted(db *sql.DB, tc TenantConfig, rec store.Processed, archiveResults []delivery, members []extractedMember, replace bool) error {
+	if err := store.SaveProcessed(db, rec, replace); err != nil {
+		return err
+	}
+	if len(archiveResults) > 0 {
+		if err := saveDeliveries(db, tc.Name, rec.File, archiveResults); err != nil {
+			return err
+		}
+	}
+	parent, err := store.GetProcessed(db, tc.Name, rec.File)
+	if err != nil || parent == nil {
+		return fmt.Errorf("archive record not found: %v", err)
+	}
+	current := make(map[string]bool, len(members))
+	for _, m := range members {
+		current[m.file] = true
+		mrec := store.Processed{
+			Tenant:      tc.Name,
+			File:        m.file,
+			FileSize:    m.fi.Size(),
+			DestPath:    m.primary.DestPath,
+			SourceMtime: rec.SourceMtime,
+			Checksum:    m.primary.Checksum,
+			Method:      m.primary.Method,
+			ETag:        m.primary.ETag,
+			StoredSize:  m.primary.StoredSize,
+			Compression: m.primary.Compression,
+			KeyID:       m.primary.KeyID,
+			Route:       m.primary.Route,
+			ParentID:    parent.ID,
+		}
+		if err := store.SaveProcessed(db, mrec, true); err != nil {
+			return err
+		}
+		// Os hooks rodaram sobre a cópia no diretório de trabalho
+		db.Exec("UPDATE hook_runs SET file = ? WHERE tenant = ? AND file = ? AND processed_id IS NULL", m.file, tc.Name, m.path)
+		if err := saveDeliveries(db, tc.Name, m.file, m.results); err != nil {
+			return err
+		}
+	}
+	previous, err := extractedMembers(db, parent.ID)
+	if err != nil {
+		return err
+	}
+	for _, p := range previous {
+		if !current[p.file] {
+			db.Exec("DELETE FROM deliveries WHERE processed_id = ?", p.id)
+			db.Exec("DELETE FROM processed_files WHERE id = ?", p.id)
+		}
+	}
+	return nil
+}
+
+// rejectArchive registra a recusa do pacote e o move para o failed_dir, se
+// configurado. Sem failed_dir o pacote fica no watch_dir.
+func rejectArchive(db *sql.DB, tc TenantConfig, name string, cause error) {
+	log.Printf("[%s] Archive %s rejected: %v", tc.Name, name, cause)
+	if err := store.RecordFailure(db, tc.Name, name, quarantineExtractRejected, cause); err != nil {
+		log.Printf("[%s] Failed to record failure: %v", tc.Name, err)
+	}
+	if tc.FailedDir == "" {
+		return
+	}
+	if _, err := quarantine(db, tc, name, quarantineExtractRejected, cause, 1, time.Time{}); err != nil {
+		log.Printf("[%s] Failed to quarantine %s: %v", tc.Name, name, err)
+	}
+}
+
+// memberRef é um arquivo extraído registrado.
+type memberRef struct {
+	id   int64
+	file string
+}
+
+// extractedMembers retorna os arquivos extraídos do pacote registrado com id.
+func extractedMembers(db *sql.DB, id int64) ([]memberRef, error) {
+	rows, err := db.Query("SELECT id, file FROM processed_files WHERE parent_id = ? ORDER BY id", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var refs []memberRef
+	for rows.Next() {
+		var r memberRef
+		if err := rows.Scan(&r.id, &r.file); err != nil {
+			return nil, err
+		}
+		refs = append(refs, r)
+	}
+	return refs, rows.Err()
+}
+
+// withExtractedMembers acrescenta aos ids os arquivos extraídos de cada
+// pacote da lista, sem repetir ids.
+func withExtractedMembers(db *sql.DB, ids []int) []int {
+	seen := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		seen[id] = true
+	}
+	out := ids
+	for _, id := range ids {
+		refs, err := extractedMembers(db, int64(id))
+		if err != nil {
+			log.Printf("[Delete] Failed to find files extracted from id %d: %v", id, err)
+			continue
+		}
+		for _, r := range refs {
+			if !seen[int(r.id)] {
+				seen[int(r.id)] = true
+				out = append(out, int(r.id))
+			}
+		}
+	}
+	return out
+}
+
+// recopyExtracted extrai e entrega de novo o pacote registrado com id, a
+// partir da origem ainda no watch_dir.
+func recopyExtracted(db *sql.DB, tc TenantConfig, id int, filePath string) {
+	if extractFormat(tc, filePath) == "" {
+		log.Printf("[Recopy] File id %d was extracted, but tenant %s no longer has extract configured.", id, tc.Name)
+		return
+	}
+	fi, err := os.Stat(filePath)
+	if err != nil {
+		log.Printf("[Recopy] Source of file id %d not available: %v", id, err)
+		return
+	}
+	if err := extractFile(context.Background(), db, tc, filePath, fi, true, true); err != nil {
+		log.Printf("[Recopy] Failed to extract file id %d: %v", id, err)
+		return
+	}
+	log.Printf("[Recopy] Extracted file id %d again: %s", id, filePath)
+}
+
+// memberDisplay encurta o nome registrado de um arquivo extraído para
+// <pacote>!/<membro>.
+func memberDisplay(file string) string {
+	if i := strings.Index(file, memberSeparator); i >= 0 {
+		return filepath.Base(file[:i]) + file[i:]
+	}
+	return filepath.Base(file)
+}
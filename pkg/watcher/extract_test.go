@@ -0,0 +1,109 @@
+package watcher
+
+import (
+	"archive/zip"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/thiagozs/go-filewatcher/pkg/store"
+)
+
+func TestExtractArchiveMembers(t *testing.T) {
+	db, err := initDB(t)
+	if err != nil {
+		t.Fatalf("erro ao iniciar db: %v", err)
+	}
+	defer db.Close()
+
+	tc := TenantConfig{
+		Name:      "tenantExtract",
+		WatchDir:  t.TempDir(),
+		DestDir:   t.TempDir(),
+		FailedDir: t.TempDir(),
+		Readiness: ReadinessConfig{Strategy: readinessCloseWrite},
+		Extract:   &ExtractConfig{Subdir: true, MaxSize: 1024},
+	}
+	cfg := &Config{Tenants: []TenantConfig{tc}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("erro ao validar: %v", err)
+	}
+	tc = cfg.Tenants[0]
+	filter, _ := newFileFilter(tc)
+
+	name := filepath.Join(tc.WatchDir, "parceiro.zip")
+	writeZip(t, name, map[string]string{"notas/a.csv": "1;a\n", "b.txt": "conteudo b"})
+	if err := handleFile(context.Background(), db, tc, filter, name, false, evCreate); err != nil {
+		t.Fatalf("erro no handleFile: %v", err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(tc.DestDir, "parceiro", "notas", "a.csv")); string(b) != "1;a\n" {
+		t.Errorf("membro não extraído no destino: %q", b)
+	}
+	if fileExists(name) || fileExists(filepath.Join(tc.DestDir, "parceiro.zip")) {
+		t.Errorf("pacote deveria sair do watch_dir sem ser entregue")
+	}
+	parent, _ := store.GetProcessed(db, tc.Name, name)
+	if parent == nil || parent.Method != transferExtract {
+		t.Fatalf("pacote não registrado: %+v", parent)
+	}
+	member, _ := store.GetProcessed(db, tc.Name, name+memberSeparator+"notas/a.csv")
+	if member == nil || member.ParentID != parent.ID || member.DestPath != filepath.Join(tc.DestDir, "parceiro", "notas", "a.csv") {
+		t.Fatalf("membro não ligado ao pacote: %+v", member)
+	}
+	if members, _ := extractedMembers(db, parent.ID); len(members) != 2 {
+		t.Errorf("esperados 2 membros, obtidos %d", len(members))
+	}
+	if got := memberDisplay(member.File); got != "parceiro.zip!/notas/a.csv" {
+		t.Errorf("nome exibido incorreto: %s", got)
+	}
+
+	// Apagar o pacote apaga os membros e as cópias extraídas
+	if err := deleteProcessedFiles(db, cfg, tc.Name, []int{int(parent.ID)}); err != nil {
+		t.Fatalf("erro ao apagar: %v", err)
+	}
+	if rec, _ := store.GetProcessed(db, tc.Name, member.File); rec != nil || fileExists(member.DestPath) {
+		t.Errorf("membro não removido junto com o pacote")
+	}
+
+	// Pacote com zip-slip vai para o failed_dir sem entregar nada
+	evil := filepath.Join(tc.WatchDir, "evil.zip")
+	writeZip(t, evil, map[string]string{"../../fora.txt": "x"})
+	if err := handleFile(context.Background(), db, tc, filter, evil, false, evCreate); err != nil {
+		t.Fatalf("pacote inseguro não deveria ser tentado de novo: %v", err)
+	}
+	if !fileExists(filepath.Join(tc.FailedDir, "evil.zip")) {
+		t.Errorf("pacote inseguro não foi para o failed_dir")
+	}
+	// Acima de max_size, mesmo com cabeçalho pequeno
+	bomb := filepath.Join(tc.WatchDir, "bomba.zip")
+	writeZip(t, bomb, map[string]string{"zeros.bin": strings.Repeat("0", 4096)})
+	handleFile(context.Background(), db, tc, filter, bomb, false, evCreate)
+	var reason string
+	db.QueryRow("SELECT reason FROM dead_letters WHERE tenant = ? AND file = ?", tc.Name, bomb).Scan(&reason)
+	if reason != quarantineExtractRejected || fileExists(filepath.Join(tc.DestDir, "bomba", "zeros.bin")) {
+		t.Errorf("pacote acima do limite não foi recusado: %q", reason)
+	}
+
+	if err := (&Config{Tenants: []TenantConfig{{Name: "x", WatchDir: "/tmp/in", DestDir: "/tmp/out", Extract: &ExtractConfig{}, Batch: &BatchConfig{MaxFiles: 1}}}}).Validate(); err == nil {
+		t.Errorf("esperado erro com extract e batch")
+	}
+}
+
+func writeZip(t *testing.T, dst string, files map[string]string) {
+	t.Helper()
+	f, err := os.Create(dst)
+	if err != nil {
+		t.Fatalf("erro ao criar zip: %v", err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for name, content := range files {
+		w, _ := zw.Create(name)
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("erro ao fechar zip: %v", err)
+	}
+}
@@ -0,0 +1,148 @@
+package watcher
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/thiagozs/go-filewatcher/pkg/store"
+)
+
+// Padrões iniciados com "re:" são expressões regulares; os demais são globs
+// (com suporte a "**"). Globs sem "/" também casam com o nome do arquivo em
+// qualquer nível, como no .gitignore.
+const regexPatternPrefix = "re:"
+
+type filePattern struct {
+	raw      string
+	re       *regexp.Regexp
+	baseOnly bool
+}
+
+type fileFilter struct {
+	include []filePattern
+	exclude []filePattern
+}
+
+func compilePattern(raw string) (filePattern, error) {
+	if strings.HasPrefix(raw, regexPatternPrefix) {
+		re, err := regexp.Compile(strings.TrimPrefix(raw, regexPatternPrefix))
+		if err != nil {
+			return filePattern{}, fmt.Errorf("invalid regex pattern %q: %w", raw, err)
+		}
+		return filePattern{raw: raw, re: re}, nil
+	}
+	re, err := regexp.Compile(globToRegexp(raw))
+	if err != nil {
+		return filePattern{}, fmt.Errorf("invalid glob pattern %q: %w", raw, err)
+	}
+	return filePattern{raw: raw, re: re, baseOnly: !strings.Contains(raw, "/")}, nil
+}
+
+// globToRegexp converte um glob em regex ancorada. "**" casa com qualquer
+// sequência (inclusive "/"), "*" e "?" não atravessam diretórios.
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				i++
+				// "**/" também casa com zero diretórios
+				if i+1 < len(glob) && glob[i+1] == '/' {
+					i++
+					b.WriteString("(?:.*/)?")
+				} else {
+					b.WriteString(".*")
+				}
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+func (p filePattern) match(rel string) bool {
+	if p.re.MatchString(rel) {
+		return true
+	}
+	return p.baseOnly && p.re.MatchString(filepath.Base(rel))
+}
+
+func newFileFilter(tc TenantConfig) (*fileFilter, error) {
+	f := &fileFilter{}
+	for _, raw := range tc.Include {
+		p, err := compilePattern(raw)
+		if err != nil {
+			return nil, err
+		}
+		f.include = append(f.include, p)
+	}
+	for _, raw := range tc.Exclude {
+		p, err := compilePattern(raw)
+		if err != nil {
+			return nil, err
+		}
+		f.exclude = append(f.exclude, p)
+	}
+	return f, nil
+}
+
+// allow informa se o caminho relativo ao WatchDir deve ser processado. Quando
+// não deve, retorna também o motivo. Exclude tem precedência sobre include.
+func (f *fileFilter) allow(rel string) (bool, string) {
+	rel = filepath.ToSlash(rel)
+	for _, p := range f.exclude {
+		if p.match(rel) {
+			return false, "exclude " + p.raw
+		}
+	}
+	if len(f.include) == 0 {
+		return true, ""
+	}
+	for _, p := range f.include {
+		if p.match(rel) {
+			return true, ""
+		}
+	}
+	return false, "no include match"
+}
+
+// filterFile aplica o filtro do tenant ao arquivo, registrando o descarte em
+// debug e, se configurado, contabilizando no banco.
+func filterFile(db *sql.DB, tc TenantConfig, filter *fileFilter, path string) bool {
+	ok, reason := filter.allow(relPath(tc, path))
+	if ok {
+		return true
+	}
+	debugf("[%s] Skipping %s (%s)", tc.Name, path, reason)
+	if tc.CountSkipped {
+		if err := store.RecordSkipped(db, tc.Name, path, reason); err != nil {
+			log.Printf("[%s] Failed to record skipped file %s: %v", tc.Name, path, err)
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/thiagozs/go-filewatcher/pkg/store"
+)
+
+func TestFileFilterAllow(t *testing.T) {
+	filter, err := newFileFilter(TenantConfig{
+		Include: []string{"**/*.csv", "*.xml", `re:^relatorios/\d{4}/`},
+		Exclude: []string{".*", "*.tmp", "*.part", "*.swp"},
+	})
+	if err != nil {
+		t.Fatalf("erro ao compilar filtro: %v", err)
+	}
+	cases := []struct {
+		rel  string
+		want bool
+	}{
+		{"dados.csv", true},
+		{"2025/01/dados.csv", true},
+		{"nota.xml", true},
+		{"sub/nota.xml", true},
+		{"relatorios/2025/resumo.pdf", true},
+		{"relatorios/xx/resumo.pdf", false},
+		{"imagem.png", false},
+		{".oculto.csv", false},
+		{"sub/.dados.csv.swp", false},
+		{"dados.csv.part", false},
+		{"upload.tmp", false},
+	}
+	for _, c := range cases {
+		if got, reason := filter.allow(c.rel); got != c.want {
+			t.Errorf("allow(%q) = %v (%s), esperado %v", c.rel, got, reason, c.want)
+		}
+	}
+}
+
+func TestInvalidFilterPattern(t *testing.T) {
+	if _, err := newFileFilter(TenantConfig{Exclude: []string{"re:(["}}); err == nil {
+		t.Errorf("esperado erro para regex inválida")
+	}
+}
+
+func TestSyncTenantDirsHonorsFilters(t *testing.T) {
+	db, err := initDB(t)
+	if err != nil {
+		t.Fatalf("erro ao iniciar db: %v", err)
+	}
+	defer db.Close()
+
+	watchDir := t.TempDir()
+	destDir := t.TempDir()
+	os.WriteFile(filepath.Join(watchDir, "dados.csv"), []byte("a;b"), 0644)
+	os.WriteFile(filepath.Join(watchDir, "dados.csv.part"), []byte("a;"), 0644)
+	os.WriteFile(filepath.Join(watchDir, ".oculto"), []byte("x"), 0644)
+
+	tenant := TenantConfig{
+		Name:         "tenantFilter",
+		WatchDir:     watchDir,
+		DestDir:      destDir,
+		Exclude:      []string{".*", "*.part"},
+		CountSkipped: true,
+	}
+	if err := syncTenantDirs(db, tenant); err != nil {
+		t.Fatalf("erro no syncTenantDirs: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(destDir, "dados.csv")); err != nil {
+		t.Errorf("arquivo permitido não copiado: %v", err)
+	}
+	for _, name := range []string{"dados.csv.part", ".oculto"} {
+		if _, err := os.Stat(filepath.Join(destDir, name)); !os.IsNotExist(err) {
+			t.Errorf("arquivo excluído %s foi copiado", name)
+		}
+		processed, _ := store.HasProcessed(db, tenant.Name, filepath.Join(watchDir, name))
+		if processed {
+			t.Errorf("arquivo excluído %s registrado como processado", name)
+		}
+	}
+	var skipped int
+	db.QueryRow("SELECT COUNT(1) FROM skipped_files WHERE tenant = ? AND file LIKE ?", tenant.Name, watchDir+"%").Scan(&skipped)
+	if skipped != 2 {
+		t.Errorf("esperado 2 arquivos contabilizados como ignorados, veio %d", skipped)
+	}
+}
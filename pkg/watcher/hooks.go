@@ -0,0 +1,239 @@
+package watcher
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/thiagozs/go-filewatcher/pkg/sink"
+	"github.com/thiagozs/go-filewatcher/pkg/store"
+)
+
+// Momentos em que um hook é executado.
+const (
+	hookPreCopy   = "pre_copy"
+	hookPostCopy  = "post_copy"
+	hookOnFailure = "on_failure"
+)
+
+// Política para falhas do hook pre_copy.
+const (
+	hookVeto   = "veto"   // a entrega não acontece (padrão)
+	hookIgnore = "ignore" // a falha só é registrada
+)
+
+// Limite da saída do hook gravada em hook_runs.
+const hookOutputLimit = 4096
+
+// errHookVeto indica que o hook pre_copy recusou a entrega.
+var errHookVeto = errors.New("pre_copy hook vetoed the transfer")
+
+// HookConfig é um comando executado em um momento da entrega. O comando não
+// passa por shell; use ["sh", "-c", "..."] quando precisar de um.
+type HookConfig struct {
+	Command []string `yaml:"command"`
+	Timeout Duration `yaml:"timeout"`
+	OnError string   `yaml:"on_error"` // só pre_copy: veto ou ignore
+}
+
+type HooksConfig struct {
+	PreCopy   *HookConfig `yaml:"pre_copy"`
+	PostCopy  *HookConfig `yaml:"post_copy"`
+	OnFailure *HookConfig `yaml:"on_failure"`
+}
+
+func (hc HooksConfig) validate() error {
+	for _, h := range []struct {
+		name string
+		cfg  *HookConfig
+	}{{hookPreCopy, hc.PreCopy}, {hookPostCopy, hc.PostCopy}, {hookOnFailure, hc.OnFailure}} {
+		if h.cfg == nil {
+			continue
+		}
+		if len(h.cfg.Command) == 0 || h.cfg.Command[0] == "" {
+			return fmt.Errorf("hook %s requires a command", h.name)
+		}
+		switch h.cfg.OnError {
+		case "":
+		case hookVeto, hookIgnore:
+			if h.name != hookPreCopy {
+				return fmt.Errorf("hook %s: on_error is only supported by pre_copy", h.name)
+			}
+		default:
+			return fmt.Errorf("hook %s: unknown on_error %q", h.name, h.cfg.OnError)
+		}
+	}
+	return nil
+}
+
+// hookEvent descreve a entrega para o hook. É enviado como JSON no stdin e
+// como variáveis de ambiente GFW_*.
+type hookEvent struct {
+	Hook        string `json:"hook"`
+	Tenant      string `json:"tenant"`
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	DestPath    string `json:"dest_path"`
+	Size        int64  `json:"size"`
+	Checksum    string `json:"checksum,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+func (ev hookEvent) env() []string {
+	return []string{
+		"GFW_HOOK=" + ev.Hook,
+		"GFW_TENANT=" + ev.Tenant,
+		"GFW_SOURCE=" + ev.Source,
+		"GFW_DESTINATION=" + ev.Destination,
+		"GFW_DEST_PATH=" + ev.DestPath,
+		"GFW_SIZE=" + strconv.FormatInt(ev.Size, 10),
+		"GFW_CHECKSUM=" + ev.Checksum,
+		"GFW_ERROR=" + ev.Error,
+	}
+}
+
+// hookRun é o resultado de uma execução, gravado em hook_runs.
+type hookRun struct {
+	ExitCode int
+	Output   string
+	Duration time.Duration
+	Err      error
+}
+
+// execHook executa o comando com o evento no stdin e no ambiente, esperando
+// no máximo o timeout do hook (padrão 30s). A saída combinada é truncada em
+// hookOutputLimit.
+func execHook(h *HookConfig, ev hookEvent) hookRun {
+	ctx, cancel := context.WithTimeout(context.Background(), h.Timeout.or(30*time.Second))
+	defer cancel()
+	payload, _ := json.Marshal(ev)
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, h.Command[0], h.Command[1:]...)
+	cmd.Env = append(os.Environ(), ev.env()...)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	// Processos filhos que herdaram a saída não prendem o hook além do timeout
+	cmd.WaitDelay = time.Second
+
+	start := time.Now()
+	err := cmd.Run()
+	run := hookRun{ExitCode: -1, Duration: time.Since(start), Err: err}
+	if cmd.ProcessState != nil {
+		run.ExitCode = cmd.ProcessState.ExitCode()
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		run.Err = fmt.Errorf("hook timed out after %v", h.Timeout.or(30*time.Second))
+	}
+	output := out.Bytes()
+	if len(output) > hookOutputLimit {
+		output = output[:hookOutputLimit]
+	}
+	run.Output = string(output)
+	return run
+}
+
+// runHook executa o hook do tenant, se configurado, e registra o resultado
+// em hook_runs. Retorna erro quando o comando falha ou sai com código
+// diferente de zero.
+func runHook(db *sql.DB, tc TenantConfig, ev hookEvent) error {
+	var h *HookConfig
+	switch ev.Hook {
+	case hookPreCopy:
+		h = tc.Hooks.PreCopy
+	case hookPostCopy:
+		h = tc.Hooks.PostCopy
+	case hookOnFailure:
+		h = tc.Hooks.OnFailure
+	}
+	if h == nil {
+		return nil
+	}
+	ev.Tenant = tc.Name
+	run := execHook(h, ev)
+	var errMsg string
+	if run.Err != nil {
+		errMsg = run.Err.Error()
+	}
+	_, err := db.Exec(
+		"INSERT INTO hook_runs(tenant, file, destination, hook, exit_code, output, error, duration_ms) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		tc.Name, ev.Source, ev.Destination, ev.Hook, run.ExitCode, run.Output, store.NullString(errMsg), run.Duration.Milliseconds(),
+	)
+	if err != nil {
+		log.Printf("[%s] Failed to record %s hook run: %v", tc.Name, ev.Hook, err)
+	}
+	if run.Err != nil {
+		log.Printf("[%s] Hook %s failed for %s: %v", tc.Name, ev.Hook, ev.Source, run.Err)
+		return run.Err
+	}
+	debugf("[%s] Hook %s ran for %s in %v", tc.Name, ev.Hook, ev.Source, run.Duration)
+	return nil
+}
+
+// preCopyHook executa o hook pre_copy antes da transferência de f para
+// destPath. Retorna erro quando a falha do hook veta a entrega.
+func preCopyHook(db *sql.DB, tc TenantConfig, f sink.File, vars *pathVars, destPath string) error {
+	if tc.Hooks.PreCopy == nil {
+		return nil
+	}
+	sum, _ := vars.checksum()
+	ev := hookEvent{Hook: hookPreCopy, Source: f.Source, Destination: f.Destination, DestPath: destPath, Size: f.Info.Size(), Checksum: sum}
+	if err := runHook(db, tc, ev); err != nil && tc.Hooks.PreCopy.vetoes() {
+		log.Printf("[%s] Transfer of %s to destination %s vetoed by pre_copy hook", tc.Name, f.Source, f.Destination)
+		if err := store.RecordFailure(db, tc.Name, f.Source, "pre_copy_veto", err); err != nil {
+			log.Printf("[%s] Failed to record failure: %v", tc.Name, err)
+		}
+		return fmt.Errorf("%w: %v", errHookVeto, err)
+	}
+	return nil
+}
+
+// hookedSink executa o pre_copy antes de um sink próprio, que não conhece o
+// caminho final antes da entrega.
+func hookedSink(db *sql.DB, tc TenantConfig, vars *pathVars, s sink.Sink) sink.Sink {
+	return sink.SinkFunc(func(ctx context.Context, f sink.File) error {
+		if err := preCopyHook(db, tc, f, vars, ""); err != nil {
+			return err
+		}
+		return s.Deliver(ctx, f)
+	})
+}
+
+// vetoes informa se uma falha do hook pre_copy impede a entrega.
+func (h *HookConfig) vetoes() bool {
+	return h != nil && h.OnError != hookIgnore
+}
+
+// runDeliveryHook executa post_copy após uma transferência concluída ou
+// on_failure após uma entrega que falhou. Entregas que não copiaram nada
+// (conteúdo já presente no destino) não disparam hooks.
+func runDeliveryHook(db *sql.DB, tc TenantConfig, name string, fi os.FileInfo, r delivery) {
+	ev := hookEvent{Source: name, Destination: r.Destination, DestPath: r.DestPath, Size: fi.Size(), Checksum: r.Checksum}
+	switch {
+	case r.Status == deliveryDone && r.Method != "":
+		ev.Hook = hookPostCopy
+	case r.Status == deliveryFailed:
+		ev.Hook = hookOnFailure
+		if r.Err != nil {
+			ev.Error = r.Err.Error()
+		}
+	default:
+		return
+	}
+	runHook(db, tc, ev)
+}
+
+// linkHookRuns associa ao registro de processed_files as execuções de hooks
+// do arquivo ainda sem registro.
+func linkHookRuns(db *sql.DB, processedID int64, tenant, file string) error {
+	_, err := db.Exec("UPDATE hook_runs SET processed_id = ? WHERE tenant = ? AND file = ? AND processed_id IS NULL", processedID, tenant, file)
+	return err
+}
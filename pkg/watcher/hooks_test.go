@@ -0,0 +1,141 @@
+package watcher
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thiagozs/go-filewatcher/pkg/store"
+)
+
+func TestHooksValidate(t *testing.T) {
+	invalid := []HooksConfig{
+		{PreCopy: &HookConfig{}},
+		{PreCopy: &HookConfig{Command: []string{"true"}, OnError: "abort"}},
+		{PostCopy: &HookConfig{Command: []string{"true"}, OnError: hookVeto}},
+	}
+	for _, hc := range invalid {
+		if err := hc.validate(); err == nil {
+			t.Errorf("esperado erro para %+v", hc)
+		}
+	}
+	if err := (HooksConfig{PreCopy: &HookConfig{Command: []string{"true"}, OnError: hookIgnore}}).validate(); err != nil {
+		t.Errorf("configuração válida rejeitada: %v", err)
+	}
+}
+
+func TestHandleFilePostCopyHook(t *testing.T) {
+	db, err := initDB(t)
+	if err != nil {
+		t.Fatalf("erro ao iniciar db: %v", err)
+	}
+	defer db.Close()
+
+	out := filepath.Join(t.TempDir(), "hook.out")
+	tc := TenantConfig{
+		Name:      "tenantHookPost",
+		WatchDir:  t.TempDir(),
+		DestDir:   t.TempDir(),
+		Readiness: ReadinessConfig{Strategy: readinessCloseWrite},
+		Hooks: HooksConfig{
+			PostCopy: &HookConfig{Command: []string{"sh", "-c", `cat > "$1"; echo "notificado $GFW_TENANT $GFW_SIZE"`, "hook", out}},
+		},
+	}
+	filter, _ := newFileFilter(tc)
+	name := filepath.Join(tc.WatchDir, "extrato.csv")
+	os.WriteFile(name, []byte("abc"), 0644)
+
+	if err := handleFile(context.Background(), db, tc, filter, name, true, evCreate); err != nil {
+		t.Fatalf("erro ao processar: %v", err)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("hook post_copy não executado: %v", err)
+	}
+	var ev hookEvent
+	if err := json.Unmarshal(data, &ev); err != nil {
+		t.Fatalf("stdin do hook inválido: %v", err)
+	}
+	if ev.Hook != hookPostCopy || ev.Source != name || ev.DestPath != filepath.Join(tc.DestDir, "extrato.csv") || ev.Size != 3 || !strings.HasPrefix(ev.Checksum, "sha256:") {
+		t.Errorf("evento incorreto: %+v", ev)
+	}
+
+	rec, _ := store.GetProcessed(db, tc.Name, name)
+	if rec == nil {
+		t.Fatalf("arquivo não registrado")
+	}
+	var output string
+	var exitCode int
+	err = db.QueryRow("SELECT exit_code, output FROM hook_runs WHERE processed_id = ? AND hook = ?", rec.ID, hookPostCopy).Scan(&exitCode, &output)
+	if err != nil {
+		t.Fatalf("execução do hook não registrada: %v", err)
+	}
+	if exitCode != 0 || output != "notificado tenantHookPost 3\n" {
+		t.Errorf("hook_runs incorreto: exit_code=%d output=%q", exitCode, output)
+	}
+}
+
+func TestPreCopyHookVeto(t *testing.T) {
+	db, err := initDB(t)
+	if err != nil {
+		t.Fatalf("erro ao iniciar db: %v", err)
+	}
+	defer db.Close()
+
+	failures := filepath.Join(t.TempDir(), "failures.log")
+	tc := TenantConfig{
+		Name:      "tenantHookVeto",
+		WatchDir:  t.TempDir(),
+		DestDir:   t.TempDir(),
+		Readiness: ReadinessConfig{Strategy: readinessCloseWrite},
+		Hooks: HooksConfig{
+			PreCopy:   &HookConfig{Command: []string{"sh", "-c", `echo "recusado $GFW_SOURCE" >&2; exit 3`}},
+			OnFailure: &HookConfig{Command: []string{"sh", "-c", `echo "$GFW_ERROR" >> "$1"`, "hook", failures}},
+		},
+	}
+	filter, _ := newFileFilter(tc)
+	name := filepath.Join(tc.WatchDir, "pedido.csv")
+	os.WriteFile(name, []byte("1;2"), 0644)
+
+	if err := handleFile(context.Background(), db, tc, filter, name, false, evCreate); err != nil {
+		t.Errorf("veto não deveria gerar nova tentativa: %v", err)
+	}
+	if fileExists(filepath.Join(tc.DestDir, "pedido.csv")) || !fileExists(name) {
+		t.Errorf("arquivo vetado não deveria ser entregue nem removido da origem")
+	}
+	var exitCode int
+	var output string
+	db.QueryRow("SELECT exit_code, output FROM hook_runs WHERE tenant = ? AND file = ? AND hook = ?", tc.Name, name, hookPreCopy).Scan(&exitCode, &output)
+	if exitCode != 3 || output != "recusado "+name+"\n" {
+		t.Errorf("hook_runs incorreto: exit_code=%d output=%q", exitCode, output)
+	}
+	if data, _ := os.ReadFile(failures); !strings.Contains(string(data), "vetoed") {
+		t.Errorf("on_failure não recebeu o erro do veto: %q", data)
+	}
+
+	// Com on_error: ignore a falha do hook não impede a entrega
+	tc.Hooks.PreCopy.OnError = hookIgnore
+	handleFile(context.Background(), db, tc, filter, name, false, evCreate)
+	if !fileExists(filepath.Join(tc.DestDir, "pedido.csv")) {
+		t.Errorf("arquivo deveria ser entregue com on_error ignore")
+	}
+}
+
+func TestExecHookTimeout(t *testing.T) {
+	h := &HookConfig{Command: []string{"sh", "-c", "echo inicio; sleep 5"}, Timeout: Duration(200 * time.Millisecond)}
+	run := execHook(h, hookEvent{Hook: hookPreCopy})
+	if run.Err == nil || !strings.Contains(run.Err.Error(), "timed out") {
+		t.Errorf("esperado erro de timeout, veio %v", run.Err)
+	}
+	if run.Duration > 3*time.Second {
+		t.Errorf("hook não foi interrompido no timeout: %v", run.Duration)
+	}
+	if run.Output != "inicio\n" {
+		t.Errorf("saída parcial não capturada: %q", run.Output)
+	}
+}
@@ -0,0 +1,118 @@
+package watcher
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thiagozs/go-filewatcher/pkg/sink"
+)
+
+// HTTPConfig é o endpoint de um destino com type: http. O segredo do HMAC vem
+// de uma variável de ambiente e os cabeçalhos aceitam ${VAR}, para que tokens
+// não fiquem no config.
+type HTTPConfig struct {
+	URL           string            `yaml:"url"`    // template com as variáveis do dest_template
+	Method        string            `yaml:"method"` // POST (padrão) ou PUT
+	Headers       map[string]string `yaml:"headers"`
+	Multipart     bool              `yaml:"multipart"`
+	FieldName     string            `yaml:"field_name"` // campo do arquivo no multipart; padrão file
+	HMACSecretEnv string            `yaml:"hmac_secret_env"`
+	Timeout       Duration          `yaml:"timeout"`
+	SuccessStatus []string          `yaml:"success_status"` // ex.: ["2xx", "409"]; padrão 2xx
+	RetryStatus   []string          `yaml:"retry_status"`   // padrão 5xx, 408 e 429
+}
+
+func (c *HTTPConfig) validate() error {
+	if c == nil || c.URL == "" {
+		return fmt.Errorf("http destinations require http.url")
+	}
+	if _, err := parseDestTemplate(c.URL); err != nil {
+		return fmt.Errorf("invalid http.url: %w", err)
+	}
+	switch strings.ToUpper(c.Method) {
+	case "", http.MethodPost, http.MethodPut:
+	default:
+		return fmt.Errorf("http.method must be POST or PUT")
+	}
+	if _, err := parseStatusSet(c.SuccessStatus); err != nil {
+		return fmt.Errorf("invalid http.success_status: %w", err)
+	}
+	if _, err := parseStatusSet(c.RetryStatus); err != nil {
+		return fmt.Errorf("invalid http.retry_status: %w", err)
+	}
+	return nil
+}
+
+// newHTTPSink monta o sink do destino, lendo o segredo do HMAC.
+func newHTTPSink(tc TenantConfig, d DestinationConfig) (*sink.HTTP, error) {
+	c := d.HTTP
+	s := &sink.HTTP{
+		URL:       httpURL(tc, c.URL),
+		Method:    strings.ToUpper(c.Method),
+		Header:    make(http.Header),
+		Multipart: c.Multipart,
+		FieldName: c.FieldName,
+		Timeout:   time.Duration(c.Timeout),
+		Checksum:  tc.Checksum,
+	}
+	for k, v := range c.Headers {
+		s.Header.Set(k, os.ExpandEnv(v))
+	}
+	if c.HMACSecretEnv != "" {
+		secret := os.Getenv(c.HMACSecretEnv)
+		if secret == "" {
+			return nil, fmt.Errorf("http.hmac_secret_env: %s is empty", c.HMACSecretEnv)
+		}
+		s.HMACSecret = []byte(secret)
+	}
+	// Listas vazias ficam com nil e o sink usa o padrão
+	s.Success, _ = parseStatusSet(c.SuccessStatus)
+	s.Retry, _ = parseStatusSet(c.RetryStatus)
+	return s, nil
+}
+
+// httpURL renderiza a URL do arquivo. Use urlquery para escapar variáveis
+// que podem conter espaços ou barras.
+func httpURL(tc TenantConfig, text string) func(sink.File) (string, error) {
+	return func(f sink.File) (string, error) {
+		rendered, err := renderRemote(tc, "http.url", text, f)
+		if err != nil {
+			return "", err
+		}
+		u, err := url.Parse(rendered)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return "", fmt.Errorf("%w: http.url rendered %q for %s", errTemplate, rendered, f.Source)
+		}
+		return rendered, nil
+	}
+}
+
+// parseStatusSet converte uma lista como ["2xx", "409"] em um teste de
+// status. Lista vazia retorna nil.
+func parseStatusSet(list []string) (func(int) bool, error) {
+	if len(list) == 0 {
+		return nil, nil
+	}
+	classes := make(map[int]bool)
+	codes := make(map[int]bool)
+	for _, item := range list {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if len(item) == 3 && strings.HasSuffix(item, "xx") && item[0] >= '1' && item[0] <= '5' {
+			classes[int(item[0]-'0')] = true
+			continue
+		}
+		code, err := strconv.Atoi(item)
+		if err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("invalid status %q", item)
+		}
+		codes[code] = true
+	}
+	return func(status int) bool {
+		return codes[status] || classes[status/100]
+	}, nil
+}
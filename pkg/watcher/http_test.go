@@ -0,0 +1,123 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/thiagozs/go-filewatcher/pkg/sink"
+	"github.com/thiagozs/go-filewatcher/pkg/store"
+)
+
+func TestHTTPConfigValidation(t *testing.T) {
+	ok := HTTPConfig{URL: "https://erp.local/notas/{{.Name}}"}
+	cases := map[string]func(c *HTTPConfig){
+		"sem url":             func(c *HTTPConfig) { c.URL = "" },
+		"url inválida":        func(c *HTTPConfig) { c.URL = "{{.Tenant" },
+		"método inválido":     func(c *HTTPConfig) { c.Method = "GET" },
+		"status inválido":     func(c *HTTPConfig) { c.SuccessStatus = []string{"2yy"} },
+		"retry fora da faixa": func(c *HTTPConfig) { c.RetryStatus = []string{"600"} },
+	}
+	for name, mutate := range cases {
+		c := ok
+		mutate(&c)
+		tc := TenantConfig{Name: "x", WatchDir: "/tmp/x", Destinations: []DestinationConfig{{Name: "erp", Type: destinationHTTP, HTTP: &c}}}
+		if err := validateDestinations(&tc); err == nil {
+			t.Errorf("%s: esperado erro", name)
+		}
+	}
+
+	match, err := parseStatusSet([]string{"2xx", "409"})
+	if err != nil {
+		t.Fatalf("erro no parseStatusSet: %v", err)
+	}
+	for status, want := range map[int]bool{200: true, 204: true, 409: true, 404: false, 500: false} {
+		if match(status) != want {
+			t.Errorf("status %d: esperado %v", status, want)
+		}
+	}
+}
+
+func TestHandleFileHTTPDestination(t *testing.T) {
+	db, err := initDB(t)
+	if err != nil {
+		t.Fatalf("erro ao iniciar db: %v", err)
+	}
+	defer db.Close()
+	status, body := http.StatusCreated, `{"protocolo":"123"}`
+	var path, received string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		path, received = r.URL.Path, string(data)
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	defer srv.Close()
+	t.Setenv("GFW_TEST_HMAC", "segredo")
+
+	tc := TenantConfig{
+		Name:     "tenantHTTP",
+		WatchDir: t.TempDir(),
+		Destinations: []DestinationConfig{{
+			Name: "erp",
+			Type: destinationHTTP,
+			HTTP: &HTTPConfig{URL: srv.URL + "/{{.Tenant}}/{{.Name | urlquery}}", HMACSecretEnv: "GFW_TEST_HMAC"},
+		}},
+		Readiness: ReadinessConfig{Strategy: readinessCloseWrite},
+	}
+	w, err := New(&Config{Tenants: []TenantConfig{tc}}, db)
+	if err != nil {
+		t.Fatalf("erro no New: %v", err)
+	}
+	tc = w.cfg.Tenants[0]
+	filter, _ := newFileFilter(tc)
+	name := filepath.Join(tc.WatchDir, "nfe.xml")
+	os.WriteFile(name, []byte("<nfe/>"), 0644)
+
+	if err := handleFile(context.Background(), db, tc, filter, name, false, evCreate); err != nil {
+		t.Fatalf("erro no handleFile: %v", err)
+	}
+	if path != "/tenantHTTP/nfe.xml" || received != "<nfe/>" {
+		t.Fatalf("upload inesperado: %s %q", path, received)
+	}
+	rec, _ := store.GetProcessed(db, tc.Name, name)
+	if rec == nil || rec.DestPath != srv.URL+"/tenantHTTP/nfe.xml" {
+		t.Fatalf("dest_path deveria ser a URL: %+v", rec)
+	}
+	var code int
+	var snippet string
+	db.QueryRow("SELECT response_status, response_body FROM deliveries WHERE processed_id = ?", rec.ID).Scan(&code, &snippet)
+	if code != http.StatusCreated || snippet != body {
+		t.Errorf("resposta não registrada: %d %q", code, snippet)
+	}
+
+	// 422 não se resolve com novas tentativas: a origem fica e a falha é registrada
+	status, body = http.StatusUnprocessableEntity, "xml inválido"
+	other := filepath.Join(tc.WatchDir, "ruim.xml")
+	os.WriteFile(other, []byte("<x"), 0644)
+	if err := handleFile(context.Background(), db, tc, filter, other, false, evCreate); err != nil {
+		t.Errorf("falha permanente não deveria agendar nova tentativa: %v", err)
+	}
+	if !fileExists(other) {
+		t.Errorf("origem deveria ficar no watch_dir")
+	}
+	var reason, msg string
+	db.QueryRow("SELECT reason, error FROM file_failures WHERE tenant = ? AND file = ?", tc.Name, other).Scan(&reason, &msg)
+	if reason != "http_status" || msg == "" {
+		t.Errorf("falha http não registrada: %q %q", reason, msg)
+	}
+
+	// 503 vale nova tentativa
+	status = http.StatusServiceUnavailable
+	if err := handleFile(context.Background(), db, tc, filter, other, false, evCreate); !errors.Is(err, errDeliveryFailed) {
+		t.Errorf("503 deveria agendar nova tentativa: %v", err)
+	}
+	if _, ok := tc.sinks["erp"].(*sink.HTTP); !ok {
+		t.Errorf("destino http deveria usar sink.HTTP")
+	}
+}
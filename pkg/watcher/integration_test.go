@@ -1,4 +1,4 @@
-package main
+package watcher
 
 import (
 	"context"
@@ -47,7 +47,7 @@ func TestWatcher_BasicFlow(t *testing.T) {
 	os.Rename(configFile.Name(), "config.yaml")
 	defer os.Remove("config.yaml")
 
-	db, err := initDB()
+	db, err := initDB(t)
 	if err != nil {
 		t.Fatalf("erro ao iniciar db: %v", err)
 	}
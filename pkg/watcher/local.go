@@ -0,0 +1,92 @@
+package watcher
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"os"
+
+	"github.com/thiagozs/go-filewatcher/pkg/sink"
+	"github.com/thiagozs/go-filewatcher/pkg/store"
+)
+
+// localSink é a entrega padrão: grava no path do destino aplicando
+// dest_template, on_conflict, transfer_mode, compress, encrypt e preserve. tc já é a
+// configuração efetiva do destino (forDestination).
+type localSink struct {
+	db         *sql.DB
+	tc         TenantConfig
+	vars       *pathVars
+	keepSource bool
+}
+
+func (s *localSink) Deliver(ctx context.Context, f sink.File) error {
+	tc, name := s.tc, f.Source
+	base, err := renderDestPath(tc, name, s.vars)
+	if err != nil {
+		log.Printf("[%s] Failed to build destination path for %s: %v", tc.Name, name, err)
+		if err := store.RecordFailure(s.db, tc.Name, name, "dest_template", err); err != nil {
+			log.Printf("[%s] Failed to record failure: %v", tc.Name, err)
+		}
+		return err
+	}
+	enc, err := tc.encoding()
+	if err != nil {
+		log.Printf("[%s] Failed to load encryption keys for destination %s: %v", tc.Name, f.Destination, err)
+		return err
+	}
+	base += enc.Ext()
+	destFile, err := resolveDest(tc, f.Path, base)
+	if errors.Is(err, errAlreadyDelivered) {
+		log.Printf("[%s] Destination %s already has the same content as %s. Not copied.", tc.Name, destFile, name)
+		f.Record(s.receipt(destFile, "", deliveredChecksum(tc, destFile), enc))
+		return nil
+	}
+	if err != nil {
+		reportConflict(s.db, tc, name, err)
+		return err
+	}
+	if err := preCopyHook(s.db, tc, f, s.vars, destFile); err != nil {
+		return err
+	}
+	// Só a origem pode ser consumida; temporários de um Processor são copiados
+	keepSource := s.keepSource || f.Path != f.Source
+	method, sum, err := transferFile(tc, f.Path, destFile, keepSource, enc)
+	if err != nil {
+		log.Printf("[%s] Failed to copy %s to destination %s: %v", tc.Name, name, f.Destination, err)
+		if errors.Is(err, sink.ErrChecksumMismatch) {
+			// A origem fica intacta para nova tentativa
+			if err := store.RecordFailure(s.db, tc.Name, name, "checksum_mismatch", err); err != nil {
+				log.Printf("[%s] Failed to record failure: %v", tc.Name, err)
+			}
+		}
+		return err
+	}
+	log.Printf("[%s] Delivered %s -> %s via %s (%s)", tc.Name, name, destFile, method, sink.ShortChecksum(sum))
+	// Rename e hardlink mantêm o próprio inode da origem
+	if method == transferCopy || method == transferReflink {
+		applyPreserve(s.db, tc, name, f.Info, destFile)
+	}
+	if tc.OnConflict == conflictVersion {
+		pruneVersions(tc, base, tc.VersionHistory)
+	}
+	f.Record(s.receipt(destFile, method, sum, enc))
+	return nil
+}
+
+// receipt descreve o arquivo gravado em destFile, com o tamanho em disco, a
+// compressão e a chave da cifragem.
+func (s *localSink) receipt(destFile, method, sum string, enc sink.Encoding) sink.Receipt {
+	r := sink.Receipt{Location: destFile, Method: method, Checksum: sum}
+	if fi, err := os.Stat(destFile); err == nil {
+		r.Size = fi.Size()
+	}
+	if enc.Compression != nil {
+		r.Compression = enc.Compression.Algorithm
+	}
+	if enc.Encryption != nil {
+		r.KeyID = enc.Encryption.KeyID
+	}
+	return r
+}
@@ -0,0 +1,112 @@
+package watcher
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/thiagozs/go-filewatcher/pkg/store"
+)
+
+// Atributos que podem ser preservados na cópia (opção preserve do tenant).
+const (
+	preserveMode   = "mode"   // permissões, incluindo setuid/setgid/sticky
+	preserveMtime  = "mtime"  // data de modificação
+	preserveAtime  = "atime"  // data de acesso
+	preserveOwner  = "owner"  // uid/gid; só tem efeito rodando como root
+	preserveXattrs = "xattrs" // atributos estendidos (Linux)
+	preserveACLs   = "acls"   // ACLs POSIX, gravadas como xattrs system.posix_acl_* (Linux)
+)
+
+var errPreserveUnsupported = errors.New("not supported on this platform")
+
+func validatePreserve(attrs []string) error {
+	for _, a := range attrs {
+		switch a {
+		case preserveMode, preserveMtime, preserveAtime, preserveOwner, preserveXattrs, preserveACLs:
+		default:
+			return fmt.Errorf("unknown preserve attribute %q", a)
+		}
+	}
+	return nil
+}
+
+func (tc TenantConfig) preserves(attr string) bool {
+	for _, a := range tc.Preserve {
+		if a == attr {
+			return true
+		}
+	}
+	return false
+}
+
+// preserveMetadata copia para dst os atributos listados em preserve. fi deve
+// ser obtido antes da cópia, já que ler a origem atualiza o atime.
+// Cada atributo é aplicado de forma independente; as falhas são agregadas no
+// erro retornado sem desfazer a cópia.
+func preserveMetadata(tc TenantConfig, src string, fi os.FileInfo, dst string) error {
+	if len(tc.Preserve) == 0 {
+		return nil
+	}
+	var errs []error
+	if tc.preserves(preserveOwner) {
+		// Fora do root o chown para outro usuário sempre falharia
+		if os.Geteuid() == 0 {
+			if err := copyOwner(fi, dst); err != nil {
+				errs = append(errs, fmt.Errorf("owner: %w", err))
+			}
+		} else {
+			debugf("[%s] Not running as root, ownership of %s not preserved", tc.Name, dst)
+		}
+	}
+	// Depois do chown, que pode limpar os bits setuid/setgid
+	if tc.preserves(preserveMode) {
+		if err := os.Chmod(dst, fi.Mode()&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); err != nil {
+			errs = append(errs, fmt.Errorf("mode: %w", err))
+		}
+	}
+	if tc.preserves(preserveXattrs) || tc.preserves(preserveACLs) {
+		if err := copyXattrs(src, dst, tc.preserves(preserveXattrs), tc.preserves(preserveACLs)); err != nil {
+			errs = append(errs, fmt.Errorf("xattrs: %w", err))
+		}
+	}
+	// Por último: as etapas anteriores alteram o ctime, mas não as datas
+	if tc.preserves(preserveMtime) || tc.preserves(preserveAtime) {
+		if err := copyTimes(tc, fi, dst); err != nil {
+			errs = append(errs, fmt.Errorf("times: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// copyTimes aplica mtime e/ou atime da origem; o que não for preservado
+// mantém o valor atual do destino.
+func copyTimes(tc TenantConfig, src os.FileInfo, dst string) error {
+	cur, err := os.Stat(dst)
+	if err != nil {
+		return err
+	}
+	atime, mtime := fileAtime(cur), cur.ModTime()
+	if tc.preserves(preserveAtime) {
+		atime = fileAtime(src)
+	}
+	if tc.preserves(preserveMtime) {
+		mtime = src.ModTime()
+	}
+	return os.Chtimes(dst, atime, mtime)
+}
+
+// applyPreserve preserva os metadados após a cópia. Falhas não interrompem o
+// processamento: são registradas no log e em file_failures.
+func applyPreserve(db *sql.DB, tc TenantConfig, src string, fi os.FileInfo, dst string) {
+	if err := preserveMetadata(tc, src, fi, dst); err != nil {
+		log.Printf("[%s] Warning: failed to preserve metadata of %s on %s: %v", tc.Name, src, dst, err)
+		if db != nil {
+			if err := store.RecordFailure(db, tc.Name, src, "preserve_metadata", err); err != nil {
+				log.Printf("[%s] Failed to record failure: %v", tc.Name, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package watcher
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func fileAtime(fi os.FileInfo) time.Time {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return time.Unix(st.Atim.Unix())
+	}
+	return fi.ModTime()
+}
+
+func copyOwner(src os.FileInfo, dst string) error {
+	st, ok := src.Sys().(*syscall.Stat_t)
+	if !ok {
+		return errPreserveUnsupported
+	}
+	return os.Lchown(dst, int(st.Uid), int(st.Gid))
+}
+
+// copyXattrs copia os atributos estendidos de src. As ACLs POSIX ficam em
+// system.posix_acl_access/default e são controladas separadamente.
+func copyXattrs(src, dst string, xattrs, acls bool) error {
+	names, err := listXattrs(src)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, name := range names {
+		isACL := strings.HasPrefix(name, "system.posix_acl_")
+		if (isACL && !acls) || (!isACL && !xattrs) {
+			continue
+		}
+		value, err := getXattr(src, name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := unix.Lsetxattr(dst, name, value, 0); err != nil {
+			errs = append(errs, &os.PathError{Op: "setxattr " + name, Path: dst, Err: err})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func listXattrs(path string) ([]string, error) {
+	size, err := unix.Llistxattr(path, nil)
+	if err != nil {
+		if err == unix.ENOTSUP {
+			return nil, nil
+		}
+		return nil, &os.PathError{Op: "listxattr", Path: path, Err: err}
+	}
+	if size == 0 {
+		return nil, nil
+	}
+	buf := make([]byte, size)
+	size, err = unix.Llistxattr(path, buf)
+	if err != nil {
+		return nil, &os.PathError{Op: "listxattr", Path: path, Err: err}
+	}
+	var names []string
+	for _, name := range strings.Split(string(buf[:size]), "\x00") {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+func getXattr(path, name string) ([]byte, error) {
+	size, err := unix.Lgetxattr(path, name, nil)
+	if err != nil {
+		return nil, &os.PathError{Op: "getxattr " + name, Path: path, Err: err}
+	}
+	buf := make([]byte, size)
+	size, err = unix.Lgetxattr(path, name, buf)
+	if err != nil {
+		return nil, &os.PathError{Op: "getxattr " + name, Path: path, Err: err}
+	}
+	return buf[:size], nil
+}
@@ -0,0 +1,29 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestPreserveXattrs(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "laudo.pdf")
+	dst := filepath.Join(t.TempDir(), "laudo.pdf")
+	os.WriteFile(src, []byte("pdf"), 0644)
+	os.WriteFile(dst, []byte("pdf"), 0644)
+	if err := unix.Setxattr(src, "user.origem", []byte("scanner-3"), 0); err != nil {
+		t.Skipf("sistema de arquivos sem suporte a xattrs: %v", err)
+	}
+
+	tc := TenantConfig{Name: "tenantXattr", Preserve: []string{preserveXattrs}}
+	fi, _ := os.Stat(src)
+	if err := preserveMetadata(tc, src, fi, dst); err != nil {
+		t.Fatalf("erro ao preservar xattrs: %v", err)
+	}
+	got, err := getXattr(dst, "user.origem")
+	if err != nil || string(got) != "scanner-3" {
+		t.Errorf("xattr não copiado: %q, %v", got, err)
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+
+package watcher
+
+import (
+	"os"
+	"time"
+)
+
+func fileAtime(fi os.FileInfo) time.Time {
+	return fi.ModTime()
+}
+
+func copyOwner(src os.FileInfo, dst string) error {
+	return errPreserveUnsupported
+}
+
+func copyXattrs(src, dst string, xattrs, acls bool) error {
+	return errPreserveUnsupported
+}
@@ -0,0 +1,66 @@
+package watcher
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestHandleFilePreservesModeAndTimes(t *testing.T) {
+	db, err := initDB(t)
+	if err != nil {
+		t.Fatalf("erro ao iniciar db: %v", err)
+	}
+	defer db.Close()
+
+	tc := TenantConfig{
+		Name:      "tenantPreserve",
+		WatchDir:  t.TempDir(),
+		DestDir:   t.TempDir(),
+		Preserve:  []string{preserveMode, preserveMtime, preserveAtime},
+		Readiness: ReadinessConfig{Strategy: readinessCloseWrite},
+	}
+	filter, _ := newFileFilter(tc)
+	name := filepath.Join(tc.WatchDir, "backup.sh")
+	os.WriteFile(name, []byte("#!/bin/sh\n"), 0644)
+	os.Chmod(name, 0750)
+	mtime := time.Date(2023, 3, 15, 8, 0, 0, 0, time.UTC)
+	atime := time.Date(2023, 3, 16, 9, 0, 0, 0, time.UTC)
+	os.Chtimes(name, atime, mtime)
+
+	handleFile(context.Background(), db, tc, filter, name, true, evCreate)
+
+	fi, err := os.Stat(filepath.Join(tc.DestDir, "backup.sh"))
+	if err != nil {
+		t.Fatalf("arquivo não copiado: %v", err)
+	}
+	if fi.Mode().Perm() != 0750 {
+		t.Errorf("modo %v, esperado 0750", fi.Mode().Perm())
+	}
+	if !fi.ModTime().Equal(mtime) {
+		t.Errorf("mtime %v, esperado %v", fi.ModTime(), mtime)
+	}
+	if runtime.GOOS == "linux" && !fileAtime(fi).Equal(atime) {
+		t.Errorf("atime %v, esperado %v", fileAtime(fi), atime)
+	}
+}
+
+func TestPreserveFailureIsNotFatal(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "dados.bin")
+	os.WriteFile(src, []byte("x"), 0644)
+	fi, _ := os.Stat(src)
+	tc := TenantConfig{Name: "tenantPreserveErr", Preserve: []string{preserveMode}}
+	// Destino inexistente: o erro é retornado, sem pânico
+	if err := preserveMetadata(tc, src, fi, filepath.Join(t.TempDir(), "sumiu")); err == nil {
+		t.Errorf("esperado erro ao preservar em destino inexistente")
+	}
+	if err := validatePreserve([]string{"mode", "owner", "acls"}); err != nil {
+		t.Errorf("atributos válidos rejeitados: %v", err)
+	}
+	if err := validatePreserve([]string{"ctime"}); err == nil {
+		t.Errorf("esperado erro para atributo desconhecido")
+	}
+}
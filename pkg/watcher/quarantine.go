@@ -0,0 +1,174 @@
+package watcher
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// Sufixo do arquivo que acompanha cada entrada do failed_dir.
+const errorSidecarSuffix = ".error.json"
+
+// Motivos de quarentena.
+const (
+	quarantineNotReady         = "not_ready"
+	quarantineRetriesExhausted = "retries_exhausted"
+	quarantineExtractRejected  = "extract_rejected"
+)
+
+// deadLetter descreve um arquivo movido para o failed_dir. É gravado no
+// sidecar .error.json e na tabela dead_letters.
+type deadLetter struct {
+	Tenant        string    `json:"tenant"`
+	File          string    `json:"file"`
+	FailedPath    string    `json:"failed_path"`
+	Reason        string    `json:"reason"`
+	Error         string    `json:"error"`
+	Attempts      int       `json:"attempts"`
+	FirstFailedAt time.Time `json:"first_failed_at"`
+	QuarantinedAt time.Time `json:"quarantined_at"`
+}
+
+func validateFailedDir(tc TenantConfig) error {
+	if tc.FailedDir == "" {
+		return nil
+	}
+	rel, err := filepath.Rel(tc.WatchDir, tc.FailedDir)
+	if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("failed_dir must be outside watch_dir")
+	}
+	return nil
+}
+
+// quarantine move o arquivo para o failed_dir do tenant, preservando o
+// caminho relativo, e grava o sidecar com o motivo da falha.
+func quarantine(db *sql.DB, tc TenantConfig, name, reason string, cause error, attempts int, firstFailed time.Time) (string, error) {
+	dst := filepath.Join(tc.FailedDir, relPath(tc, name))
+	now := time.Now()
+	if fileExists(dst) || fileExists(dst+errorSidecarSuffix) {
+		dst = renamedDest(dst, suffixTimestamp, now)
+	}
+	if err := moveFile(name, dst); err != nil {
+		return "", err
+	}
+	if sentinel, ok := findSentinel(tc, name); ok && tc.Readiness.Strategy == readinessSentinel {
+		os.Remove(sentinel)
+	}
+	if firstFailed.IsZero() {
+		firstFailed = now
+	}
+	dl := deadLetter{
+		Tenant:        tc.Name,
+		File:          name,
+		FailedPath:    dst,
+		Reason:        reason,
+		Error:         cause.Error(),
+		Attempts:      attempts,
+		FirstFailedAt: firstFailed.UTC(),
+		QuarantinedAt: now.UTC(),
+	}
+	data, _ := json.MarshalIndent(dl, "", "  ")
+	if err := os.WriteFile(dst+errorSidecarSuffix, append(data, '\n'), 0644); err != nil {
+		log.Printf("[%s] Failed to write error sidecar for %s: %v", tc.Name, dst, err)
+	}
+	_, err := db.Exec(
+		"INSERT INTO dead_letters(tenant, file, failed_path, reason, error, attempts, first_failed_at, quarantined_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		dl.Tenant, dl.File, dl.FailedPath, dl.Reason, dl.Error, dl.Attempts, dl.FirstFailedAt, dl.QuarantinedAt,
+	)
+	if err != nil {
+		log.Printf("[%s] Failed to record dead letter for %s: %v", tc.Name, name, err)
+	}
+	log.Printf("[%s] File %s quarantined to %s (%s): %v", tc.Name, name, dst, reason, cause)
+	return dst, nil
+}
+
+// quarantineExhausted move para o failed_dir o arquivo cujo job esgotou as
+// tentativas, com os dados do job no sidecar.
+func quarantineExhausted(db *sql.DB, tc TenantConfig, name string, cause error) {
+	var attempts int
+	var created sql.NullTime
+	db.QueryRow("SELECT attempts, created_at FROM jobs WHERE tenant = ? AND file = ?", tc.Name, name).Scan(&attempts, &created)
+	if _, err := quarantine(db, tc, name, quarantineRetriesExhausted, cause, attempts, created.Time); err != nil {
+		log.Printf("[%s] Failed to quarantine %s: %v", tc.Name, name, err)
+	}
+}
+
+func listDeadLetters(db *sql.DB, tenant string, page, pageSize int) error {
+	offset := (page - 1) * pageSize
+	if offset < 0 {
+		offset = 0
+	}
+	query := "SELECT id, tenant, file, failed_path, reason, error, attempts, quarantined_at FROM dead_letters WHERE requeued_at IS NULL "
+	var args []interface{}
+	if tenant != "" {
+		query += "AND tenant = ? "
+		args = append(args, tenant)
+	}
+	query += "ORDER BY quarantined_at DESC LIMIT ? OFFSET ?"
+	args = append(args, pageSize, offset)
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.Header([]string{"ID", "Tenant", "File", "Failed Path", "Reason", "Attempts", "Error", "Quarantined At"})
+	for rows.Next() {
+		var id, attempts int
+		var tenantName, file, failedPath, reason, errMsg, quarantinedAt string
+		if err := rows.Scan(&id, &tenantName, &file, &failedPath, &reason, &errMsg, &attempts, &quarantinedAt); err != nil {
+			return err
+		}
+		table.Append([]string{
+			fmt.Sprintf("%d", id),
+			tenantName,
+			truncateFileName(filepath.Base(file), 40),
+			normalizePath(failedPath, 28),
+			reason,
+			fmt.Sprintf("%d", attempts),
+			truncateFileName(errMsg, 40),
+			quarantinedAt,
+		})
+	}
+	table.Render()
+	fmt.Printf("Page %d (Page Size %d)\n", page, pageSize)
+	return nil
+}
+
+// requeueDeadLetters devolve os arquivos em quarentena para o caminho
+// original no watch_dir e zera as tentativas, para serem processados de novo.
+func requeueDeadLetters(db *sql.DB, tenant string, ids []int) error {
+	if tenant == "" {
+		return fmt.Errorf("tenant must be specified for requeue")
+	}
+	for _, id := range ids {
+		var file, failedPath string
+		err := db.QueryRow("SELECT file, failed_path FROM dead_letters WHERE id = ? AND tenant = ? AND requeued_at IS NULL", id, tenant).
+			Scan(&file, &failedPath)
+		if err != nil {
+			log.Printf("[Requeue] Failed to find dead letter with id %d: %v", id, err)
+			continue
+		}
+		if fileExists(file) {
+			log.Printf("[Requeue] Dead letter id %d: %s already exists in the watch dir. Skipping.", id, file)
+			continue
+		}
+		if err := moveFile(failedPath, file); err != nil {
+			log.Printf("[Requeue] Failed to move dead letter id %d back to %s: %v", id, file, err)
+			continue
+		}
+		os.Remove(failedPath + errorSidecarSuffix)
+		db.Exec("DELETE FROM jobs WHERE tenant = ? AND file = ?", tenant, file)
+		db.Exec("UPDATE dead_letters SET requeued_at = CURRENT_TIMESTAMP WHERE id = ?", id)
+		log.Printf("[Requeue] Dead letter id %d moved back to %s", id, file)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package watcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestValidateFailedDir(t *testing.T) {
+	watchDir := t.TempDir()
+	if err := validateFailedDir(TenantConfig{WatchDir: watchDir, FailedDir: filepath.Join(watchDir, "failed")}); err == nil {
+		t.Errorf("esperado erro para failed_dir dentro do watch_dir")
+	}
+	if err := validateFailedDir(TenantConfig{WatchDir: watchDir, FailedDir: t.TempDir()}); err != nil {
+		t.Errorf("failed_dir fora do watch_dir deveria ser aceito: %v", err)
+	}
+}
+
+func TestQuarantineNotReadyAndRequeue(t *testing.T) {
+	db, err := initDB(t)
+	if err != nil {
+		t.Fatalf("erro ao iniciar db: %v", err)
+	}
+	defer db.Close()
+
+	tc := TenantConfig{
+		Name:      "tenantQuarantine",
+		WatchDir:  t.TempDir(),
+		DestDir:   t.TempDir(),
+		FailedDir: t.TempDir(),
+		Recursive: true,
+		Readiness: ReadinessConfig{
+			Strategy: readinessSentinel,
+			Poll:     Duration(50 * time.Millisecond),
+			Timeout:  Duration(200 * time.Millisecond),
+		},
+	}
+	filter, _ := newFileFilter(tc)
+	name := filepath.Join(tc.WatchDir, "lote", "orfao.csv")
+	os.MkdirAll(filepath.Dir(name), 0755)
+	os.WriteFile(name, []byte("3;4"), 0644)
+
+	handleFile(context.Background(), db, tc, filter, name, false, evCreate)
+
+	failed := filepath.Join(tc.FailedDir, "lote", "orfao.csv")
+	if fileExists(name) || !fileExists(failed) {
+		t.Fatalf("arquivo não movido para failed_dir")
+	}
+	data, err := os.ReadFile(failed + errorSidecarSuffix)
+	if err != nil {
+		t.Fatalf("sidecar não gravado: %v", err)
+	}
+	var dl deadLetter
+	if err := json.Unmarshal(data, &dl); err != nil {
+		t.Fatalf("sidecar inválido: %v", err)
+	}
+	if dl.Reason != quarantineNotReady || dl.File != name || dl.Attempts != 1 || dl.QuarantinedAt.IsZero() {
+		t.Errorf("sidecar incorreto: %+v", dl)
+	}
+
+	var id int
+	if err := db.QueryRow("SELECT id FROM dead_letters WHERE tenant = ? AND file = ?", tc.Name, name).Scan(&id); err != nil {
+		t.Fatalf("dead letter não registrado: %v", err)
+	}
+	if err := requeueDeadLetters(db, tc.Name, []int{id}); err != nil {
+		t.Fatalf("erro no requeue: %v", err)
+	}
+	if !fileExists(name) || fileExists(failed) || fileExists(failed+errorSidecarSuffix) {
+		t.Errorf("requeue não devolveu o arquivo ao watch_dir")
+	}
+	var pending int
+	db.QueryRow("SELECT COUNT(*) FROM dead_letters WHERE id = ? AND requeued_at IS NULL", id).Scan(&pending)
+	if pending != 0 {
+		t.Errorf("dead letter deveria ser marcado como requeued")
+	}
+}
+
+func TestQuarantineRetriesExhausted(t *testing.T) {
+	db, err := initDB(t)
+	if err != nil {
+		t.Fatalf("erro ao iniciar db: %v", err)
+	}
+	defer db.Close()
+
+	mount := filepath.Join(t.TempDir(), "mnt")
+	os.WriteFile(mount, nil, 0644)
+	tc := TenantConfig{
+		Name:      "tenantQuarantineRetry",
+		WatchDir:  t.TempDir(),
+		DestDir:   mount,
+		FailedDir: t.TempDir(),
+		Readiness: ReadinessConfig{Strategy: readinessCloseWrite},
+		Retry:     RetryConfig{MaxAttempts: 2},
+	}
+	filter, _ := newFileFilter(tc)
+	name := filepath.Join(tc.WatchDir, "remessa.txt")
+	os.WriteFile(name, []byte("remessa"), 0644)
+
+	for i, want := range []string{jobPending, jobFailed} {
+		err := handleFile(context.Background(), db, tc, filter, name, false, evCreate)
+		if !errors.Is(err, errDeliveryFailed) {
+			t.Fatalf("tentativa %d: esperado errDeliveryFailed, veio %v", i+1, err)
+		}
+		status, err := scheduleRetry(db, tc, name, err)
+		if err != nil || status != want {
+			t.Fatalf("tentativa %d: status %q (%v), esperado %q", i+1, status, err, want)
+		}
+	}
+
+	failed := filepath.Join(tc.FailedDir, "remessa.txt")
+	if fileExists(name) || !fileExists(failed) {
+		t.Fatalf("arquivo não movido para failed_dir após esgotar tentativas")
+	}
+	var dl deadLetter
+	data, _ := os.ReadFile(failed + errorSidecarSuffix)
+	json.Unmarshal(data, &dl)
+	if dl.Reason != quarantineRetriesExhausted || dl.Attempts != 2 || dl.FirstFailedAt.After(dl.QuarantinedAt) {
+		t.Errorf("sidecar incorreto: %+v", dl)
+	}
+
+	// O requeue zera as tentativas
+	var id int
+	db.QueryRow("SELECT id FROM dead_letters WHERE tenant = ? AND file = ?", tc.Name, name).Scan(&id)
+	if err := requeueDeadLetters(db, tc.Name, []int{id}); err != nil {
+		t.Fatalf("erro no requeue: %v", err)
+	}
+	var jobs int
+	db.QueryRow("SELECT COUNT(*) FROM jobs WHERE tenant = ? AND file = ?", tc.Name, name).Scan(&jobs)
+	if !fileExists(name) || jobs != 0 {
+		t.Errorf("requeue deveria devolver o arquivo e remover o job: existe=%v jobs=%d", fileExists(name), jobs)
+	}
+}
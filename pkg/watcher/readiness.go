@@ -0,0 +1,283 @@
+package watcher
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Estratégias para decidir quando um arquivo está pronto para ser copiado.
+const (
+	readinessSize       = "size"        // tamanho estável (padrão)
+	readinessSizeMtime  = "size_mtime"  // tamanho e mtime estáveis
+	readinessSentinel   = "sentinel"    // aguarda foo.csv.done / foo.csv.ok
+	readinessLock       = "lock"        // aguarda o arquivo ser liberado pelo writer
+	readinessCloseWrite = "close_write" // confia no evento, sem espera
+)
+
+// O que fazer quando o arquivo não fica pronto dentro do timeout.
+const (
+	timeoutSkip    = "skip"    // apenas registra no log (padrão)
+	timeoutStalled = "stalled" // move para stalled_dir
+	timeoutRetry   = "retry"   // tenta de novo após retry_after
+)
+
+var defaultSentinelSuffixes = []string{".done", ".ok"}
+
+// errNotReady indica que o arquivo não ficou pronto dentro do timeout.
+var errNotReady = errors.New("file not ready")
+
+// errLockUnsupported indica que a plataforma não tem flock.
+var errLockUnsupported = errors.New("readiness strategy lock requires flock, not available on " + runtime.GOOS)
+
+// errRetryLater indica que o arquivo deve ser processado de novo mais tarde.
+var errRetryLater = errors.New("retry later")
+
+// Duration aceita valores como "500ms", "3s" ou "2m" no YAML.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// or retorna a duração configurada ou def quando não informada.
+func (d Duration) or(def time.Duration) time.Duration {
+	if d <= 0 {
+		return def
+	}
+	return time.Duration(d)
+}
+
+type ReadinessConfig struct {
+	Strategy         string   `yaml:"strategy"`
+	Poll             Duration `yaml:"poll"`
+	StableFor        Duration `yaml:"stable_for"`
+	Timeout          Duration `yaml:"timeout"`
+	SentinelSuffixes []string `yaml:"sentinel_suffixes"`
+	RemoveSentinel   bool     `yaml:"remove_sentinel"`
+	OnTimeout        string   `yaml:"on_timeout"`
+	StalledDir       string   `yaml:"stalled_dir"`
+	RetryAfter       Duration `yaml:"retry_after"`
+}
+
+func (rc ReadinessConfig) validate() error {
+	switch rc.Strategy {
+	case "", readinessSize, readinessSizeMtime, readinessSentinel, readinessCloseWrite:
+	case readinessLock:
+		if !flockSupported {
+			return errLockUnsupported
+		}
+	default:
+		return fmt.Errorf("unknown readiness strategy %q", rc.Strategy)
+	}
+	switch rc.OnTimeout {
+	case "", timeoutSkip, timeoutRetry:
+	case timeoutStalled:
+		if rc.StalledDir == "" {
+			return fmt.Errorf("readiness on_timeout %q requires stalled_dir", rc.OnTimeout)
+		}
+	default:
+		return fmt.Errorf("unknown readiness on_timeout %q", rc.OnTimeout)
+	}
+	return nil
+}
+
+func (rc ReadinessConfig) sentinelSuffixes() []string {
+	if len(rc.SentinelSuffixes) > 0 {
+		return rc.SentinelSuffixes
+	}
+	return defaultSentinelSuffixes
+}
+
+// sentinelTarget informa se name é um arquivo sentinela e, se for, qual o
+// arquivo de dados correspondente.
+func sentinelTarget(tc TenantConfig, name string) (string, bool) {
+	if tc.Readiness.Strategy != readinessSentinel {
+		return "", false
+	}
+	for _, suffix := range tc.Readiness.sentinelSuffixes() {
+		if strings.HasSuffix(name, suffix) && len(name) > len(suffix) {
+			return strings.TrimSuffix(name, suffix), true
+		}
+	}
+	return "", false
+}
+
+// findSentinel retorna o sentinela existente do arquivo de dados.
+func findSentinel(tc TenantConfig, name string) (string, bool) {
+	for _, suffix := range tc.Readiness.sentinelSuffixes() {
+		if fileExists(name + suffix) {
+			return name + suffix, true
+		}
+	}
+	return "", false
+}
+
+// waitReady aguarda o arquivo ficar pronto conforme a estratégia do tenant.
+// A espera é interrompida quando ctx é cancelado.
+func waitReady(ctx context.Context, tc TenantConfig, name string, op eventOp) error {
+	rc := tc.Readiness
+	poll := rc.Poll.or(time.Second)
+	timeout := rc.Timeout.or(2 * time.Minute)
+	switch rc.Strategy {
+	case readinessSentinel:
+		if op == evSentinel {
+			return nil
+		}
+		return waitFor(ctx, name, poll, timeout, func() (bool, error) {
+			_, ok := findSentinel(tc, name)
+			return ok, nil
+		})
+	case readinessLock:
+		return waitFor(ctx, name, poll, timeout, func() (bool, error) {
+			return fileReleased(name)
+		})
+	case readinessCloseWrite:
+		return nil
+	}
+	// Com IN_CLOSE_WRITE o writer já terminou, não há o que aguardar
+	if op == evCloseWrite {
+		return nil
+	}
+	return waitFileStable(ctx, name, poll, rc.StableFor.or(3*time.Second), timeout, rc.Strategy == readinessSizeMtime)
+}
+
+// waitFor verifica ready a cada poll até o timeout. O arquivo precisa
+// continuar existindo durante a espera.
+func waitFor(ctx context.Context, filename string, poll, maxWait time.Duration, ready func() (bool, error)) error {
+	for waited := time.Duration(0); waited < maxWait; waited += poll {
+		if _, err := os.Stat(filename); err != nil {
+			return err
+		}
+		ok, err := ready()
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		if err := sleepCtx(ctx, poll); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("file %s not ready within %v: %w", filename, maxWait, errNotReady)
+}
+
+func waitFileStable(ctx context.Context, filename string, poll, stableFor, maxWait time.Duration, checkMtime bool) error {
+	waited := time.Duration(0)
+	var lastSize int64 = -1
+	var lastMtime time.Time
+	stable := time.Duration(0)
+
+	for waited < maxWait {
+		fi, err := os.Stat(filename)
+		if err != nil {
+			return err
+		}
+		size := fi.Size()
+		if size == lastSize && (!checkMtime || fi.ModTime().Equal(lastMtime)) {
+			stable += poll
+			if stable >= stableFor {
+				return nil // Stable!
+			}
+		} else {
+			stable = 0
+			lastSize = size
+			lastMtime = fi.ModTime()
+		}
+		if err := sleepCtx(ctx, poll); err != nil {
+			return err
+		}
+		waited += poll
+	}
+	return fmt.Errorf("file %s did not stabilize within %v: %w", filename, maxWait, errNotReady)
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// fileReleased informa se nenhum outro processo mantém o arquivo aberto e se
+// é possível obter um lock exclusivo (flock) sobre ele.
+func fileReleased(name string) (bool, error) {
+	open, err := openByOtherProcess(name)
+	if err != nil || open {
+		return false, err
+	}
+	return tryLockFile(name)
+}
+
+// moveToStalled tira o arquivo do WatchDir, preservando o caminho relativo.
+func moveToStalled(tc TenantConfig, name string) (string, error) {
+	dst := filepath.Join(tc.Readiness.StalledDir, relPath(tc, name))
+	if err := moveFile(name, dst); err != nil {
+		return "", err
+	}
+	return dst, nil
+}
+
+// moveFile renomeia o arquivo, copiando e removendo a origem quando o
+// destino está em outro sistema de arquivos.
+func moveFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	if err := copyFile(src, dst); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// handleNotReady aplica a política on_timeout. Retorna errRetryLater quando o
+// arquivo deve ser tentado de novo. Com failed_dir, o arquivo que seria ignorado vai
+// para a quarentena.
+func handleNotReady(db *sql.DB, tc TenantConfig, name string, err error) error {
+	switch tc.Readiness.OnTimeout {
+	case timeoutStalled:
+		dst, mvErr := moveToStalled(tc, name)
+		if mvErr != nil {
+			log.Printf("[%s] Failed to move stalled file %s: %v", tc.Name, name, mvErr)
+			return nil
+		}
+		log.Printf("[%s] File %s not ready (%v). Moved to %s", tc.Name, name, err, dst)
+	case timeoutRetry:
+		retryAfter := tc.Readiness.RetryAfter.or(time.Minute)
+		log.Printf("[%s] File %s not ready (%v). Retrying in %v", tc.Name, name, err, retryAfter)
+		return errRetryLater
+	default:
+		if tc.FailedDir != "" {
+			if _, qErr := quarantine(db, tc, name, quarantineNotReady, err, 1, time.Time{}); qErr != nil {
+				log.Printf("[%s] Failed to quarantine %s: %v", tc.Name, name, qErr)
+			}
+			return nil
+		}
+		log.Printf("[%s] File %s did not stabilize: %v", tc.Name, name, err)
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package watcher
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+const flockSupported = true
+
+// tryLockFile tenta um flock exclusivo não bloqueante e o libera em seguida.
+func tryLockFile(name string) (bool, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	if err := unix.Flock(int(f.Fd()), unix.LOCK_EX|unix.LOCK_NB); err != nil {
+		if err == unix.EWOULDBLOCK {
+			return false, nil
+		}
+		return false, err
+	}
+	unix.Flock(int(f.Fd()), unix.LOCK_UN)
+	return true, nil
+}
@@ -0,0 +1,43 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// No Linux a estratégia lock também consulta os descritores abertos em /proc.
+const lockChecksOpenFiles = true
+
+// openByOtherProcess procura o arquivo entre os descritores abertos em /proc.
+// Processos de outros usuários só são visíveis quando rodando como root.
+func openByOtherProcess(name string) (bool, error) {
+	target, err := filepath.Abs(name)
+	if err != nil {
+		return false, err
+	}
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return false, nil
+	}
+	self := strconv.Itoa(os.Getpid())
+	for _, p := range procs {
+		if !p.IsDir() || p.Name() == self {
+			continue
+		}
+		if _, err := strconv.Atoi(p.Name()); err != nil {
+			continue
+		}
+		fdDir := filepath.Join("/proc", p.Name(), "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			if link, err := os.Readlink(filepath.Join(fdDir, fd.Name())); err == nil && link == target {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
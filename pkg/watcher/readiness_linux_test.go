@@ -0,0 +1,37 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestWaitReadyLock(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "travado.bin")
+	os.WriteFile(name, []byte("x"), 0644)
+	holder, err := os.Open(name)
+	if err != nil {
+		t.Fatalf("erro ao abrir arquivo: %v", err)
+	}
+	defer holder.Close()
+	if err := unix.Flock(int(holder.Fd()), unix.LOCK_EX); err != nil {
+		t.Fatalf("erro ao obter lock: %v", err)
+	}
+	tc := TenantConfig{Readiness: ReadinessConfig{
+		Strategy: readinessLock,
+		Poll:     Duration(50 * time.Millisecond),
+		Timeout:  Duration(200 * time.Millisecond),
+	}}
+	if err := waitReady(context.Background(), tc, name, evCreate); !errors.Is(err, errNotReady) {
+		t.Fatalf("esperado errNotReady com lock ativo, veio %v", err)
+	}
+	unix.Flock(int(holder.Fd()), unix.LOCK_UN)
+	if err := waitReady(context.Background(), tc, name, evCreate); err != nil {
+		t.Errorf("esperado pronto após liberar lock: %v", err)
+	}
+}
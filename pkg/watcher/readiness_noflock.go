@@ -0,0 +1,11 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+
+package watcher
+
+// Sem flock (Windows, entre outros) a estratégia lock é recusada na
+// validação da configuração.
+const flockSupported = false
+
+func tryLockFile(name string) (bool, error) {
+	return false, errLockUnsupported
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package watcher
+
+// Sem o /proc do Linux não há como saber se outro processo mantém o arquivo
+// aberto; a estratégia lock fica só com o flock, que é consultivo e não
+// detecta writers que não o usam (ver watchTenant).
+const lockChecksOpenFiles = false
+
+func openByOtherProcess(name string) (bool, error) {
+	return false, nil
+}
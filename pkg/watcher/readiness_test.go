@@ -0,0 +1,125 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigReadiness(t *testing.T) {
+	f, err := os.CreateTemp("", "config-*.yaml")
+	if err != nil {
+		t.Fatalf("erro ao criar temp: %v", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`tenants:
+  - name: sftp
+    watch_dir: /tmp/sftp/in
+    dest_dir: /tmp/sftp/out
+    readiness:
+      strategy: sentinel
+      poll: 250ms
+      timeout: 10m
+      sentinel_suffixes: [".ready"]
+      on_timeout: stalled
+      stalled_dir: /tmp/sftp/stalled
+`)
+	f.Close()
+
+	cfg, err := LoadConfig(f.Name())
+	if err != nil {
+		t.Fatalf("erro ao carregar config: %v", err)
+	}
+	rc := cfg.Tenants[0].Readiness
+	if rc.Poll.or(time.Second) != 250*time.Millisecond || rc.Timeout.or(0) != 10*time.Minute {
+		t.Errorf("durações lidas incorretamente: poll=%v timeout=%v", time.Duration(rc.Poll), time.Duration(rc.Timeout))
+	}
+	if rc.StableFor.or(3*time.Second) != 3*time.Second {
+		t.Errorf("esperado padrão de stable_for quando não informado")
+	}
+}
+
+func TestReadinessValidate(t *testing.T) {
+	if err := (ReadinessConfig{Strategy: "magic"}).validate(); err == nil {
+		t.Errorf("esperado erro para estratégia desconhecida")
+	}
+	if err := (ReadinessConfig{OnTimeout: timeoutStalled}).validate(); err == nil {
+		t.Errorf("esperado erro para stalled sem stalled_dir")
+	}
+}
+
+func TestWaitReadySentinel(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "lote.csv")
+	os.WriteFile(name, []byte("a;b"), 0644)
+	tc := TenantConfig{Readiness: ReadinessConfig{
+		Strategy: readinessSentinel,
+		Poll:     Duration(50 * time.Millisecond),
+		Timeout:  Duration(200 * time.Millisecond),
+	}}
+	if err := waitReady(context.Background(), tc, name, evCreate); !errors.Is(err, errNotReady) {
+		t.Fatalf("esperado errNotReady sem sentinela, veio %v", err)
+	}
+	os.WriteFile(name+".ok", nil, 0644)
+	if err := waitReady(context.Background(), tc, name, evCreate); err != nil {
+		t.Errorf("esperado pronto com sentinela: %v", err)
+	}
+	if target, ok := sentinelTarget(tc, name+".done"); !ok || target != name {
+		t.Errorf("sentinela não associado ao arquivo de dados: %q", target)
+	}
+}
+
+func TestHandleFileSentinelAndStalled(t *testing.T) {
+	db, err := initDB(t)
+	if err != nil {
+		t.Fatalf("erro ao iniciar db: %v", err)
+	}
+	defer db.Close()
+
+	watchDir := t.TempDir()
+	destDir := t.TempDir()
+	stalledDir := t.TempDir()
+	tc := TenantConfig{
+		Name:     "tenantSentinel",
+		WatchDir: watchDir,
+		DestDir:  destDir,
+		Readiness: ReadinessConfig{
+			Strategy:       readinessSentinel,
+			Poll:           Duration(50 * time.Millisecond),
+			Timeout:        Duration(200 * time.Millisecond),
+			RemoveSentinel: true,
+			OnTimeout:      timeoutStalled,
+			StalledDir:     stalledDir,
+		},
+	}
+	filter, _ := newFileFilter(tc)
+
+	// Chegada do sentinela libera o arquivo de dados
+	data := filepath.Join(watchDir, "pedido.csv")
+	os.WriteFile(data, []byte("1;2"), 0644)
+	os.WriteFile(data+".done", nil, 0644)
+	handleFile(context.Background(), db, tc, filter, data+".done", false, evCreate)
+	if _, err := os.Stat(filepath.Join(destDir, "pedido.csv")); err != nil {
+		t.Errorf("arquivo não copiado após sentinela: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(destDir, "pedido.csv.done")); !os.IsNotExist(err) {
+		t.Errorf("sentinela não deveria ser copiado")
+	}
+	if fileExists(data + ".done") {
+		t.Errorf("sentinela não removido após processamento")
+	}
+
+	// Sem sentinela dentro do timeout o arquivo vai para stalled_dir
+	orphan := filepath.Join(watchDir, "orfao.csv")
+	os.WriteFile(orphan, []byte("3;4"), 0644)
+	handleFile(context.Background(), db, tc, filter, orphan, false, evCreate)
+	if fileExists(orphan) {
+		t.Errorf("arquivo sem sentinela não removido do watch dir")
+	}
+	if _, err := os.Stat(filepath.Join(stalledDir, "orfao.csv")); err != nil {
+		t.Errorf("arquivo não movido para stalled_dir: %v", err)
+	}
+}
@@ -1,9 +1,11 @@
-package main
+package watcher
 
 import (
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/thiagozs/go-filewatcher/pkg/store"
 )
 
 func TestRecopyFiles(t *testing.T) {
@@ -14,7 +16,7 @@ func TestRecopyFiles(t *testing.T) {
 	os.Remove(dbFile.Name())
 	defer os.Remove(dbFile.Name())
 
-	db, err := initDB()
+	db, err := initDB(t)
 	if err != nil {
 		t.Fatalf("erro ao iniciar db: %v", err)
 	}
@@ -27,7 +29,7 @@ func TestRecopyFiles(t *testing.T) {
 	os.WriteFile(file, []byte("recopy"), 0644)
 	defer os.Remove(file)
 	defer os.RemoveAll(destDir)
-	if err := markProcessed(db, tenant, file, 6, destDir); err != nil {
+	if err := store.MarkProcessed(db, tenant, file, 6, destDir); err != nil {
 		t.Fatalf("erro ao marcar processado: %v", err)
 	}
 	var id int
@@ -36,7 +38,7 @@ func TestRecopyFiles(t *testing.T) {
 		t.Fatalf("id não encontrado")
 	}
 	os.Remove(filepath.Join(destDir, filepath.Base(file))) // garante que não existe
-	if err := recopyFiles(db, tenant, []int{id}); err != nil {
+	if err := recopyFiles(db, nil, tenant, "", []int{id}, false); err != nil {
 		t.Fatalf("erro ao recopy: %v", err)
 	}
 	if _, err := os.Stat(filepath.Join(destDir, filepath.Base(file))); err != nil {
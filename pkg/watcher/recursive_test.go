@@ -0,0 +1,102 @@
+package watcher
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thiagozs/go-filewatcher/pkg/store"
+)
+
+func TestSyncTenantDirsRecursive(t *testing.T) {
+	db, err := initDB(t)
+	if err != nil {
+		t.Fatalf("erro ao iniciar db: %v", err)
+	}
+	defer db.Close()
+
+	watchDir := t.TempDir()
+	destDir := t.TempDir()
+	nested := filepath.Join(watchDir, "2025-01-01", "parceiro")
+	os.MkdirAll(nested, 0755)
+	watchFile := filepath.Join(nested, "nota.xml")
+	os.WriteFile(watchFile, []byte("<nota/>"), 0644)
+
+	tenant := TenantConfig{
+		Name:      "tenantSyncRecursive",
+		WatchDir:  watchDir,
+		DestDir:   destDir,
+		Recursive: true,
+	}
+	if err := syncTenantDirs(db, tenant); err != nil {
+		t.Fatalf("erro no syncTenantDirs: %v", err)
+	}
+
+	destFile := filepath.Join(destDir, "2025-01-01", "parceiro", "nota.xml")
+	if _, err := os.Stat(destFile); err != nil {
+		t.Errorf("estrutura de diretórios não espelhada no destino: %v", err)
+	}
+	processed, err := store.HasProcessed(db, tenant.Name, watchFile)
+	if err != nil {
+		t.Fatalf("erro ao checar store.HasProcessed: %v", err)
+	}
+	if !processed {
+		t.Errorf("arquivo aninhado não registrado no banco após sync")
+	}
+}
+
+func TestWatcher_RecursiveNewSubdir(t *testing.T) {
+	db, err := initDB(t)
+	if err != nil {
+		t.Fatalf("erro ao iniciar db: %v", err)
+	}
+	defer db.Close()
+
+	dirWatch := t.TempDir()
+	dirDest := t.TempDir()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go watchTenant(ctx, TenantConfig{
+		Name:      "testRecursive",
+		WatchDir:  dirWatch,
+		DestDir:   dirDest,
+		Recursive: true,
+	}, db, &wg, false)
+
+	time.Sleep(500 * time.Millisecond)
+
+	// Subdiretório criado depois do watcher iniciar
+	subDir := filepath.Join(dirWatch, "remetente", "2025")
+	if err := os.MkdirAll(subDir, 0755); err != nil {
+		cancel()
+		wg.Wait()
+		t.Fatalf("erro ao criar subdiretório: %v", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if err := os.WriteFile(filepath.Join(subDir, "arquivo.txt"), []byte("aninhado"), 0644); err != nil {
+		cancel()
+		wg.Wait()
+		t.Fatalf("erro ao criar arquivo: %v", err)
+	}
+
+	destFile := filepath.Join(dirDest, "remetente", "2025", "arquivo.txt")
+	ok := false
+	for i := 0; i < 20; i++ {
+		if _, err := os.Stat(destFile); err == nil {
+			ok = true
+			break
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	cancel()
+	wg.Wait()
+
+	if !ok {
+		t.Fatalf("arquivo aninhado não copiado para destino: %s", destFile)
+	}
+}
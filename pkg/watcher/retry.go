@@ -0,0 +1,194 @@
+package watcher
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/thiagozs/go-filewatcher/pkg/sink"
+)
+
+// Situação de um job na tabela jobs. Só arquivos que falharam ao menos uma
+// vez ganham um job.
+const (
+	jobPending    = "pending"     // aguardando next_attempt_at
+	jobInProgress = "in_progress" // reenviado ao pool de workers
+	jobDone       = "done"        // entregue em uma nova tentativa
+	jobFailed     = "failed"      // tentativas esgotadas
+)
+
+// errDeliveryFailed indica uma falha de entrega que vale tentar de novo
+// (destino indisponível, disco cheio, checksum divergente).
+var errDeliveryFailed = errors.New("delivery failed")
+
+// RetryConfig controla as novas tentativas de arquivos cuja entrega falhou.
+type RetryConfig struct {
+	MaxAttempts    int      `yaml:"max_attempts"`
+	InitialBackoff Duration `yaml:"initial_backoff"`
+	MaxBackoff     Duration `yaml:"max_backoff"`
+	Multiplier     float64  `yaml:"multiplier"`
+	Poll           Duration `yaml:"poll"`
+}
+
+func (rc RetryConfig) validate() error {
+	if rc.MaxAttempts < 0 {
+		return fmt.Errorf("retry max_attempts must not be negative")
+	}
+	if rc.Multiplier != 0 && rc.Multiplier < 1 {
+		return fmt.Errorf("retry multiplier must be at least 1")
+	}
+	return nil
+}
+
+func (rc RetryConfig) maxAttempts() int {
+	if rc.MaxAttempts <= 0 {
+		return 5
+	}
+	return rc.MaxAttempts
+}
+
+// backoff retorna a espera antes da tentativa seguinte à attempt-ésima falha.
+func (rc RetryConfig) backoff(attempt int) time.Duration {
+	initial := rc.InitialBackoff.or(30 * time.Second)
+	maxBackoff := rc.MaxBackoff.or(30 * time.Minute)
+	mult := rc.Multiplier
+	if mult == 0 {
+		mult = 2
+	}
+	d := float64(initial) * math.Pow(mult, float64(attempt-1))
+	if d > float64(maxBackoff) {
+		return maxBackoff
+	}
+	return time.Duration(d)
+}
+
+// retryable informa se a falha de entrega pode se resolver sozinha. Conflitos
+// resolvidos por on_conflict, templates inválidos, vetos do pre_copy e
+// recusas permanentes do destino não mudam com o tempo.
+func retryable(err error) bool {
+	return !errors.Is(err, errConflictSkip) && !errors.Is(err, errDestExists) && !errors.Is(err, errTemplate) &&
+		!errors.Is(err, errHookVeto) && !errors.Is(err, sink.ErrPermanent)
+}
+
+// deliveryError resume as falhas dos destinos obrigatórios. Retorna nil quando
+// nenhuma delas deve ser tentada de novo.
+func deliveryError(results []delivery) error {
+	for _, r := range results {
+		if r.Required && r.Status != deliveryDone && r.Err != nil && retryable(r.Err) {
+			return fmt.Errorf("%w: destination %s: %v", errDeliveryFailed, r.Destination, r.Err)
+		}
+	}
+	return nil
+}
+
+// scheduleRetry registra a falha do arquivo e agenda a próxima tentativa com
+// backoff exponencial, ou marca o job como failed ao esgotar as tentativas.
+// Retorna o status gravado.
+func scheduleRetry(db *sql.DB, tc TenantConfig, name string, cause error) (string, error) {
+	var attempts int
+	err := db.QueryRow("SELECT attempts FROM jobs WHERE tenant = ? AND file = ?", tc.Name, name).Scan(&attempts)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	attempts++
+	status, next := jobPending, sql.NullTime{Time: time.Now().Add(tc.Retry.backoff(attempts)).UTC(), Valid: true}
+	if attempts >= tc.Retry.maxAttempts() {
+		status, next = jobFailed, sql.NullTime{}
+	}
+	_, err = db.Exec(`
+        INSERT INTO jobs(tenant, file, status, attempts, last_error, next_attempt_at) VALUES (?, ?, ?, ?, ?, ?)
+        ON CONFLICT(tenant, file) DO UPDATE SET
+            status = excluded.status,
+            attempts = excluded.attempts,
+            last_error = excluded.last_error,
+            next_attempt_at = excluded.next_attempt_at,
+            updated_at = CURRENT_TIMESTAMP`,
+		tc.Name, name, status, attempts, cause.Error(), next,
+	)
+	if err != nil {
+		return "", err
+	}
+	if status == jobFailed {
+		log.Printf("[%s] Giving up on %s after %d attempts: %v", tc.Name, name, attempts, cause)
+		if tc.FailedDir != "" {
+			quarantineExhausted(db, tc, name, cause)
+		}
+	} else {
+		log.Printf("[%s] Attempt %d for %s failed: %v. Retrying at %s", tc.Name, attempts, name, cause, next.Time.Local().Format(time.RFC3339))
+	}
+	return status, nil
+}
+
+// completeJob marca como done o job de um arquivo que voltou a ser tratado
+// sem erro. Arquivos sem job não são afetados.
+func completeJob(db *sql.DB, tenant, name string) error {
+	_, err := db.Exec(`UPDATE jobs SET status = ?, next_attempt_at = NULL, updated_at = CURRENT_TIMESTAMP
+        WHERE tenant = ? AND file = ? AND status IN (?, ?)`,
+		jobDone, tenant, name, jobPending, jobInProgress)
+	return err
+}
+
+// claimDueJobs marca como in_progress e retorna os jobs cuja próxima
+// tentativa já venceu.
+func claimDueJobs(db *sql.DB, tenant string, now time.Time) ([]string, error) {
+	rows, err := db.Query("SELECT id, file FROM jobs WHERE tenant = ? AND status = ? AND next_attempt_at <= ? ORDER BY next_attempt_at",
+		tenant, jobPending, now.UTC())
+	if err != nil {
+		return nil, err
+	}
+	var ids []int64
+	var files []string
+	for rows.Next() {
+		var id int64
+		var file string
+		if err := rows.Scan(&id, &file); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids, files = append(ids, id), append(files, file)
+	}
+	rows.Close()
+	for _, id := range ids {
+		if _, err := db.Exec("UPDATE jobs SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", jobInProgress, id); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// resetInterruptedJobs devolve para pending os jobs que estavam em andamento
+// quando o processo parou.
+func resetInterruptedJobs(db *sql.DB, tenant string) error {
+	_, err := db.Exec("UPDATE jobs SET status = ?, next_attempt_at = ? WHERE tenant = ? AND status = ?",
+		jobPending, time.Now().UTC(), tenant, jobInProgress)
+	return err
+}
+
+// runRetryScheduler reenvia ao pool os jobs pendentes do tenant conforme o
+// next_attempt_at, até ctx ser cancelado.
+func runRetryScheduler(ctx context.Context, db *sql.DB, tc TenantConfig, pool *workerPool) {
+	if err := resetInterruptedJobs(db, tc.Name); err != nil {
+		log.Printf("[%s] Failed to reset interrupted jobs: %v", tc.Name, err)
+	}
+	ticker := time.NewTicker(tc.Retry.Poll.or(5 * time.Second))
+	defer ticker.Stop()
+	for {
+		files, err := claimDueJobs(db, tc.Name, time.Now())
+		if err != nil {
+			log.Printf("[%s] Failed to load pending jobs: %v", tc.Name, err)
+		}
+		for _, name := range files {
+			log.Printf("[%s] Retrying %s", tc.Name, name)
+			pool.submit(ctx, fileJob{name: name, op: evCreate})
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package watcher
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	rc := RetryConfig{InitialBackoff: Duration(time.Second), MaxBackoff: Duration(10 * time.Second)}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second}
+	for i, w := range want {
+		if got := rc.backoff(i + 1); got != w {
+			t.Errorf("tentativa %d: backoff %v, esperado %v", i+1, got, w)
+		}
+	}
+	if err := (RetryConfig{Multiplier: 0.5}).validate(); err == nil {
+		t.Errorf("esperado erro para multiplier menor que 1")
+	}
+}
+
+func TestScheduleRetryExhaustsAttempts(t *testing.T) {
+	db, err := initDB(t)
+	if err != nil {
+		t.Fatalf("erro ao iniciar db: %v", err)
+	}
+	defer db.Close()
+
+	tc := TenantConfig{Name: "tenantRetry", Retry: RetryConfig{MaxAttempts: 3, InitialBackoff: Duration(time.Hour)}}
+	name := filepath.Join(t.TempDir(), "lote.csv")
+	cause := errors.New("no space left on device")
+	for i, want := range []string{jobPending, jobPending, jobFailed} {
+		status, err := scheduleRetry(db, tc, name, cause)
+		if err != nil {
+			t.Fatalf("erro ao agendar: %v", err)
+		}
+		if status != want {
+			t.Errorf("tentativa %d: status %q, esperado %q", i+1, status, want)
+		}
+	}
+	var attempts int
+	var lastError string
+	db.QueryRow("SELECT attempts, last_error FROM jobs WHERE tenant = ? AND file = ?", tc.Name, name).Scan(&attempts, &lastError)
+	if attempts != 3 || lastError != cause.Error() {
+		t.Errorf("job registrado incorretamente: attempts=%d last_error=%q", attempts, lastError)
+	}
+	// Jobs esgotados não voltam para a fila
+	if files, _ := claimDueJobs(db, tc.Name, time.Now().Add(48*time.Hour)); len(files) != 0 {
+		t.Errorf("job failed não deveria ser reenviado: %v", files)
+	}
+}
+
+func TestWatcher_RetryHealsTransientFailure(t *testing.T) {
+	dirWatch := t.TempDir()
+	mount := filepath.Join(t.TempDir(), "mnt")
+	// Destino "desmontado": um arquivo regular no lugar do diretório
+	os.WriteFile(mount, nil, 0644)
+	tc := TenantConfig{
+		Name:      "tenantRetryWatch",
+		WatchDir:  dirWatch,
+		DestDir:   mount,
+		Readiness: ReadinessConfig{Strategy: readinessCloseWrite},
+		Retry: RetryConfig{
+			InitialBackoff: Duration(300 * time.Millisecond),
+			Poll:           Duration(100 * time.Millisecond),
+		},
+	}
+	db, stop := startWatcher(t, tc, false)
+	defer stop()
+
+	src := filepath.Join(dirWatch, "remessa.txt")
+	os.WriteFile(src, []byte("remessa"), 0644)
+	time.Sleep(200 * time.Millisecond)
+	os.Remove(mount)
+	os.MkdirAll(mount, 0755)
+
+	if !waitForContent(filepath.Join(mount, "remessa.txt"), "remessa", 5*time.Second) {
+		t.Fatalf("arquivo não foi entregue após o destino voltar")
+	}
+	var status string
+	var attempts int
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		db.QueryRow("SELECT status, attempts FROM jobs WHERE tenant = ? AND file = ?", tc.Name, src).Scan(&status, &attempts)
+		if status == jobDone {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if status != jobDone || attempts < 1 {
+		t.Errorf("job deveria terminar como done após falha: status=%q attempts=%d", status, attempts)
+	}
+}
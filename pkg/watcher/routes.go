@@ -0,0 +1,267 @@
+package watcher
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Nome do destino dos arquivos que não casam com nenhuma regra, quando o
+// tenant configura unrouted.
+const unroutedDestination = "unrouted"
+
+// Bytes lidos do começo do arquivo para detectar o MIME e a primeira linha.
+const routeSniffLen = 4096
+
+// RouteConfig é uma regra de roteamento do tenant. Arquivos que casam com
+// match vão só para o destino da regra (path, type e as mesmas opções de
+// destinations), no lugar dos destinos padrão. O nome da regra é também o
+// nome do destino nas entregas.
+type RouteConfig struct {
+	DestinationConfig `yaml:",inline"`
+	Match             RouteMatch `yaml:"match"`
+
+	// Condições compiladas em Validate
+	matcher *routeMatcher
+}
+
+// RouteMatch reúne as condições de uma regra; todas as informadas precisam
+// casar. Sem condições, a regra casa com qualquer arquivo.
+type RouteMatch struct {
+	Name      string   `yaml:"name"`       // glob ou "re:" sobre o caminho relativo, como em include
+	Ext       []string `yaml:"ext"`        // extensões (ex.: pdf, .tar.gz), sem diferenciar maiúsculas
+	MinSize   ByteSize `yaml:"min_size"`   // inclusive
+	MaxSize   ByteSize `yaml:"max_size"`   // inclusive
+	MIME      []string `yaml:"mime"`       // tipo detectado pelo conteúdo; aceita "image/*"
+	FirstLine string   `yaml:"first_line"` // regex sobre a primeira linha do arquivo
+}
+
+type routeMatcher struct {
+	name      *filePattern
+	ext       []string
+	minSize   int64
+	maxSize   int64
+	mime      []string
+	firstLine *regexp.Regexp
+}
+
+// validateRoutes valida as regras do tenant e compila as condições de cada
+// uma. Recebe o ponteiro porque guarda as condições compiladas no config.
+func validateRoutes(tc *TenantConfig) error {
+	if len(tc.Routes) == 0 {
+		if tc.Unrouted != "" {
+			return fmt.Errorf("unrouted requires routes")
+		}
+		return nil
+	}
+	if tc.Batch != nil {
+		return fmt.Errorf("routes cannot be combined with batch")
+	}
+	if tc.DestDir == "" && tc.Unrouted == "" {
+		return fmt.Errorf("routes require dest_dir, destinations or unrouted for unmatched files")
+	}
+	seen := map[string]bool{unroutedDestination: true}
+	for _, d := range tc.destinations() {
+		seen[d.Name] = true
+	}
+	for i := range tc.Routes {
+		r := &tc.Routes[i]
+		if err := validateDestination(*tc, r.DestinationConfig); err != nil {
+			return fmt.Errorf("route %s: %w", r.Name, err)
+		}
+		if seen[r.Name] {
+			return fmt.Errorf("route %q conflicts with another route or destination", r.Name)
+		}
+		seen[r.Name] = true
+		m, err := compileRouteMatch(r.Match)
+		if err != nil {
+			return fmt.Errorf("route %s: %w", r.Name, err)
+		}
+		r.matcher = m
+	}
+	return nil
+}
+
+func compileRouteMatch(rm RouteMatch) (*routeMatcher, error) {
+	m := &routeMatcher{minSize: int64(rm.MinSize), maxSize: int64(rm.MaxSize)}
+	if rm.Name != "" {
+		p, err := compilePattern(rm.Name)
+		if err != nil {
+			return nil, err
+		}
+		m.name = &p
+	}
+	for _, ext := range rm.Ext {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
+			return nil, fmt.Errorf("empty ext")
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		m.ext = append(m.ext, ext)
+	}
+	if m.minSize < 0 || m.maxSize < 0 {
+		return nil, fmt.Errorf("size range must not be negative")
+	}
+	if m.maxSize > 0 && m.minSize > m.maxSize {
+		return nil, fmt.Errorf("min_size is greater than max_size")
+	}
+	for _, mt := range rm.MIME {
+		mt = strings.ToLower(strings.TrimSpace(mt))
+		if !strings.Contains(mt, "/") {
+			return nil, fmt.Errorf("invalid mime %q", mt)
+		}
+		m.mime = append(m.mime, mt)
+	}
+	if rm.FirstLine != "" {
+		re, err := regexp.Compile(rm.FirstLine)
+		if err != nil {
+			return nil, fmt.Errorf("invalid first_line pattern %q: %w", rm.FirstLine, err)
+		}
+		m.firstLine = re
+	}
+	return m, nil
+}
+
+// match informa se o arquivo casa com todas as condições. As condições de
+// conteúdo ficam por último, para só ler o arquivo quando necessário.
+func (m *routeMatcher) match(rel string, size int64, head *fileHead) bool {
+	if m.name != nil && !m.name.match(rel) {
+		return false
+	}
+	if len(m.ext) > 0 && !hasAnySuffix(strings.ToLower(rel), m.ext) {
+		return false
+	}
+	if size < m.minSize || (m.maxSize > 0 && size > m.maxSize) {
+		return false
+	}
+	if len(m.mime) > 0 && !mimeMatches(m.mime, head.mime()) {
+		return false
+	}
+	if m.firstLine != nil && !m.firstLine.MatchString(head.firstLine()) {
+		return false
+	}
+	return true
+}
+
+func hasAnySuffix(s string, suffixes []string) bool {
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(s, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// mimeMatches compara o tipo detectado (sem parâmetros como charset) com a
+// lista da regra. "tipo/*" casa com qualquer subtipo.
+func mimeMatches(patterns []string, detected string) bool {
+	for _, p := range patterns {
+		if p == detected || (strings.HasSuffix(p, "/*") && strings.HasPrefix(detected, strings.TrimSuffix(p, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// fileHead guarda o começo do arquivo, lido uma única vez para todas as
+// regras.
+type fileHead struct {
+	path string
+	data []byte
+	read bool
+}
+
+func (h *fileHead) bytes() []byte {
+	if h.read {
+		return h.data
+	}
+	h.read = true
+	f, err := os.Open(h.path)
+	if err != nil {
+		debugf("Failed to read %s for routing: %v", h.path, err)
+		return nil
+	}
+	defer f.Close()
+	buf := make([]byte, routeSniffLen)
+	n, _ := io.ReadFull(f, buf)
+	h.data = buf[:n]
+	return h.data
+}
+
+// mime retorna o tipo detectado pelo conteúdo (ver http.DetectContentType).
+func (h *fileHead) mime() string {
+	mt, _, _ := strings.Cut(http.DetectContentType(h.bytes()), ";")
+	return strings.ToLower(strings.TrimSpace(mt))
+}
+
+// firstLine retorna a primeira linha, sem BOM nem \r, limitada aos bytes
+// lidos.
+func (h *fileHead) firstLine() string {
+	b := bytes.TrimPrefix(h.bytes(), []byte("\xef\xbb\xbf"))
+	if i := bytes.IndexByte(b, '\n'); i >= 0 {
+		b = b[:i]
+	}
+	return strings.TrimSuffix(string(b), "\r")
+}
+
+// routeFile aplica as routes do tenant ao arquivo. Retorna a configuração com
+// o destino da primeira regra que casar (ou o unrouted, se nenhuma casar e
+// ele estiver configurado) e o nome da regra, vazio sem regra.
+func routeFile(tc TenantConfig, name string, fi os.FileInfo) (TenantConfig, string) {
+	if len(tc.Routes) == 0 {
+		return tc, ""
+	}
+	rel := filepath.ToSlash(relPath(tc, name))
+	head := &fileHead{path: name}
+	for _, r := range tc.Routes {
+		m := r.matcher
+		if m == nil {
+			// Config montado em código sem passar por Validate
+			var err error
+			if m, err = compileRouteMatch(r.Match); err != nil {
+				continue
+			}
+		}
+		if m.match(rel, fi.Size(), head) {
+			debugf("[%s] File %s matched route %s", tc.Name, name, r.Name)
+			return tc.withDestination(r.DestinationConfig), r.Name
+		}
+	}
+	if tc.Unrouted != "" {
+		debugf("[%s] File %s matched no route, sending to unrouted", tc.Name, name)
+		return tc.withDestination(DestinationConfig{Name: unroutedDestination, Path: tc.Unrouted}), ""
+	}
+	return tc, ""
+}
+
+// withDestination retorna a configuração do tenant com d como único destino.
+func (tc TenantConfig) withDestination(d DestinationConfig) TenantConfig {
+	rtc := tc
+	rtc.Destinations = []DestinationConfig{d}
+	rtc.DestDir = d.Path
+	return rtc
+}
+
+// allDestinations retorna os destinos padrão seguidos dos destinos das
+// routes e do unrouted.
+func (tc TenantConfig) allDestinations() []DestinationConfig {
+	dests := tc.destinations()
+	if len(tc.Routes) == 0 {
+		return dests
+	}
+	all := append([]DestinationConfig(nil), dests...)
+	for _, r := range tc.Routes {
+		all = append(all, r.DestinationConfig)
+	}
+	if tc.Unrouted != "" {
+		all = append(all, DestinationConfig{Name: unroutedDestination, Path: tc.Unrouted})
+	}
+	return all
+}
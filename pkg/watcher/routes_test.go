@@ -0,0 +1,146 @@
+package watcher
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/thiagozs/go-filewatcher/pkg/store"
+	"gopkg.in/yaml.v2"
+)
+
+func TestRoutesByContent(t *testing.T) {
+	db, err := initDB(t)
+	if err != nil {
+		t.Fatalf("erro ao iniciar db: %v", err)
+	}
+	defer db.Close()
+
+	base := t.TempDir()
+	watchDir := filepath.Join(base, "in")
+	os.MkdirAll(watchDir, 0755)
+	data := `
+tenants:
+  - name: tenantRoutes
+    watch_dir: "` + watchDir + `"
+    dest_dir: "` + filepath.Join(base, "default") + `"
+    unrouted: "` + filepath.Join(base, "unrouted") + `"
+    readiness:
+      strategy: close_write
+    routes:
+      - name: notas
+        path: "` + filepath.Join(base, "notas") + `"
+        on_conflict: version
+        match:
+          name: "NF-*"
+          ext: [xml]
+          first_line: '^<\?xml'
+      - name: relatorios
+        path: "` + filepath.Join(base, "relatorios") + `"
+        match:
+          first_line: "^RELATORIO;"
+          max_size: 1KB
+      - name: imagens
+        path: "` + filepath.Join(base, "imagens") + `"
+        match:
+          mime: ["image/*"]
+`
+	var cfg Config
+	if err := yaml.Unmarshal([]byte(data), &cfg); err != nil {
+		t.Fatalf("erro ao ler config: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("erro ao validar: %v", err)
+	}
+	tc := cfg.Tenants[0]
+	if len(tc.Routes) != 3 || tc.Routes[0].Path != filepath.Join(base, "notas") || tc.Routes[0].OnConflict != conflictVersion {
+		t.Fatalf("routes não interpretadas: %+v", tc.Routes)
+	}
+	filter, _ := newFileFilter(tc)
+
+	png := "\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 32)
+	cases := []struct {
+		file, content, route, dir string
+	}{
+		{"NF-001.xml", "<?xml version=\"1.0\"?>\n<nota/>", "notas", "notas"},
+		{"NF-002.txt", "<?xml version=\"1.0\"?>\n<nota/>", "", "unrouted"},
+		{"vendas.csv", "\xef\xbb\xbfRELATORIO;2024\r\n1;2\n", "relatorios", "relatorios"},
+		{"grande.csv", "RELATORIO;2024\n" + strings.Repeat("x", 2048), "", "unrouted"},
+		{"foto.dat", png, "imagens", "imagens"},
+	}
+	for _, c := range cases {
+		name := filepath.Join(watchDir, c.file)
+		os.WriteFile(name, []byte(c.content), 0644)
+		if err := handleFile(context.Background(), db, tc, filter, name, false, evCreate); err != nil {
+			t.Fatalf("%s: erro no handleFile: %v", c.file, err)
+		}
+		if !fileExists(filepath.Join(base, c.dir, c.file)) {
+			t.Errorf("%s: esperado em %s", c.file, c.dir)
+		}
+		rec, _ := store.GetProcessed(db, tc.Name, name)
+		if rec == nil || rec.Route != c.route {
+			t.Errorf("%s: regra registrada incorreta: %+v", c.file, rec)
+		}
+	}
+	if err := listProcessedFiles(db, tc.Name, "notas", 1, 10); err != nil {
+		t.Errorf("erro ao listar por regra: %v", err)
+	}
+	// O nome da regra é o destino das entregas e serve para --recopy --destination
+	if err := recopyFiles(db, &cfg, tc.Name, "notas", nil, false); err != nil {
+		t.Errorf("regra não reconhecida como destino: %v", err)
+	}
+}
+
+func TestRoutesValidation(t *testing.T) {
+	route := func(name string, m RouteMatch) RouteConfig {
+		return RouteConfig{DestinationConfig: DestinationConfig{Name: name, Path: "/tmp/" + name}, Match: m}
+	}
+	cases := map[string]TenantConfig{
+		"nome repetido":       {Routes: []RouteConfig{route("default", RouteMatch{})}},
+		"regex inválida":      {Routes: []RouteConfig{route("a", RouteMatch{FirstLine: "("})}},
+		"faixa invertida":     {Routes: []RouteConfig{route("a", RouteMatch{MinSize: 10, MaxSize: 5})}},
+		"mime inválido":       {Routes: []RouteConfig{route("a", RouteMatch{MIME: []string{"pdf"}})}},
+		"sem path":            {Routes: []RouteConfig{{DestinationConfig: DestinationConfig{Name: "a"}}}},
+		"unrouted sem routes": {Unrouted: "/tmp/unrouted"},
+		"com batch":           {Routes: []RouteConfig{route("a", RouteMatch{})}, Batch: &BatchConfig{MaxFiles: 1}},
+	}
+	for name, tc := range cases {
+		tc.Name, tc.WatchDir, tc.DestDir = "x", "/tmp/in", "/tmp/out"
+		cfg := &Config{Tenants: []TenantConfig{tc}}
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%s: esperado erro", name)
+		}
+	}
+}
+
+func TestNewKeepsCallerRoutes(t *testing.T) {
+	db, err := initDB(t)
+	if err != nil {
+		t.Fatalf("erro ao iniciar db: %v", err)
+	}
+	defer db.Close()
+
+	tc := TenantConfig{
+		Name:     "tenantRoutesCopy",
+		WatchDir: t.TempDir(),
+		DestDir:  t.TempDir(),
+		Routes: []RouteConfig{{
+			DestinationConfig: DestinationConfig{Name: "notas", Path: t.TempDir()},
+			Match:             RouteMatch{Ext: []string{"xml"}},
+		}},
+	}
+	cfg := &Config{Tenants: []TenantConfig{tc}}
+	w, err := New(cfg, db)
+	if err != nil {
+		t.Fatalf("erro ao criar watcher: %v", err)
+	}
+	// As rotas compiladas ficam só na cópia do watcher
+	if cfg.Tenants[0].Routes[0].matcher != nil {
+		t.Errorf("New alterou as rotas do Config do chamador")
+	}
+	if w.cfg.Tenants[0].Routes[0].matcher == nil {
+		t.Errorf("rotas do watcher não foram compiladas")
+	}
+}
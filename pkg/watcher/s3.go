@@ -0,0 +1,150 @@
+package watcher
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/thiagozs/go-filewatcher/pkg/sink"
+)
+
+// S3Config é o bucket de um destino com type: s3. As credenciais vêm das
+// variáveis de ambiente ou de um arquivo no formato do ~/.aws/credentials,
+// nunca do config.
+type S3Config struct {
+	Endpoint        string `yaml:"endpoint"` // padrão https://s3.<region>.amazonaws.com
+	Region          string `yaml:"region"`
+	Bucket          string `yaml:"bucket"`
+	Prefix          string `yaml:"prefix"` // template com as variáveis do dest_template
+	PathStyle       bool   `yaml:"path_style"`
+	AccessKeyEnv    string `yaml:"access_key_env"` // padrão AWS_ACCESS_KEY_ID
+	SecretKeyEnv    string `yaml:"secret_key_env"` // padrão AWS_SECRET_ACCESS_KEY
+	CredentialsFile string `yaml:"credentials_file"`
+	Profile         string `yaml:"profile"` // seção do credentials_file; padrão default
+	PartSizeMB      int    `yaml:"part_size_mb"`
+	SkipETagCheck   bool   `yaml:"skip_etag_check"`
+}
+
+// O S3 recusa partes menores que 5 MiB, exceto a última.
+const minS3PartSizeMB = 5
+
+func (c *S3Config) validate() error {
+	if c == nil || c.Bucket == "" {
+		return fmt.Errorf("s3 destinations require s3.bucket")
+	}
+	if c.PartSizeMB != 0 && c.PartSizeMB < minS3PartSizeMB {
+		return fmt.Errorf("s3.part_size_mb must be at least %d", minS3PartSizeMB)
+	}
+	if _, err := parseDestTemplate(c.Prefix); err != nil {
+		return fmt.Errorf("invalid s3.prefix: %w", err)
+	}
+	return nil
+}
+
+// newS3Sink monta o sink do destino, lendo as credenciais.
+func newS3Sink(tc TenantConfig, d DestinationConfig) (*sink.S3, error) {
+	c := d.S3
+	region := c.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	endpoint := c.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+	s := &sink.S3{
+		Endpoint:      endpoint,
+		Region:        region,
+		Bucket:        c.Bucket,
+		PathStyle:     c.PathStyle,
+		PartSize:      int64(c.PartSizeMB) << 20,
+		Checksum:      tc.Checksum,
+		SkipETagCheck: c.SkipETagCheck,
+		Key:           s3Key(tc, c.Prefix),
+	}
+	var err error
+	if c.CredentialsFile != "" {
+		s.AccessKey, s.SecretKey, s.SessionToken, err = readCredentialsFile(c.CredentialsFile, c.Profile)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		s.AccessKey = os.Getenv(envOr(c.AccessKeyEnv, "AWS_ACCESS_KEY_ID"))
+		s.SecretKey = os.Getenv(envOr(c.SecretKeyEnv, "AWS_SECRET_ACCESS_KEY"))
+		s.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+	if s.AccessKey == "" || s.SecretKey == "" {
+		return nil, fmt.Errorf("missing s3 credentials (access_key_env, secret_key_env or credentials_file)")
+	}
+	return s, nil
+}
+
+func envOr(name, def string) string {
+	if name != "" {
+		return name
+	}
+	return def
+}
+
+// s3Key monta a chave do objeto: o prefixo renderizado seguido do caminho
+// relativo ao watch_dir.
+func s3Key(tc TenantConfig, prefix string) func(sink.File) (string, error) {
+	return func(f sink.File) (string, error) {
+		rendered, err := renderRemote(tc, "s3.prefix", prefix, f)
+		if err != nil {
+			return "", err
+		}
+		key := path.Join(rendered, filepath.ToSlash(f.RelPath))
+		if key == ".." || strings.HasPrefix(key, "../") {
+			return "", fmt.Errorf("%w: s3.prefix rendered %q for %s", errTemplate, rendered, f.Source)
+		}
+		return strings.TrimPrefix(key, "/"), nil
+	}
+}
+
+// readCredentialsFile lê aws_access_key_id, aws_secret_access_key e
+// aws_session_token da seção profile de um arquivo ini.
+func readCredentialsFile(name, profile string) (accessKey, secretKey, token string, err error) {
+	if profile == "" {
+		profile = "default"
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return "", "", "", err
+	}
+	defer f.Close()
+	section := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok || section != profile {
+			continue
+		}
+		switch strings.TrimSpace(k) {
+		case "aws_access_key_id":
+			accessKey = strings.TrimSpace(v)
+		case "aws_secret_access_key":
+			secretKey = strings.TrimSpace(v)
+		case "aws_session_token":
+			token = strings.TrimSpace(v)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", "", "", err
+	}
+	if accessKey == "" || secretKey == "" {
+		return "", "", "", fmt.Errorf("profile %q not found in %s", profile, name)
+	}
+	return accessKey, secretKey, token, nil
+}
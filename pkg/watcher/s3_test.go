@@ -0,0 +1,123 @@
+package watcher
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/thiagozs/go-filewatcher/internal/s3fake"
+	"github.com/thiagozs/go-filewatcher/pkg/sink"
+	"github.com/thiagozs/go-filewatcher/pkg/store"
+)
+
+func TestS3ConfigValidation(t *testing.T) {
+	cases := []struct {
+		name string
+		d    DestinationConfig
+	}{
+		{"sem bucket", DestinationConfig{Name: "s3", Type: destinationS3}},
+		{"parte pequena", DestinationConfig{Name: "s3", Type: destinationS3, S3: &S3Config{Bucket: "b", PartSizeMB: 1}}},
+		{"prefixo inválido", DestinationConfig{Name: "s3", Type: destinationS3, S3: &S3Config{Bucket: "b", Prefix: "{{.Year"}}},
+	}
+	for _, c := range cases {
+		tc := TenantConfig{Name: "x", WatchDir: "/tmp/x", Destinations: []DestinationConfig{c.d}}
+		if err := validateDestinations(&tc); err == nil {
+			t.Errorf("%s: esperado erro", c.name)
+		}
+	}
+}
+
+func TestS3Credentials(t *testing.T) {
+	d := DestinationConfig{Name: "s3", Type: destinationS3, S3: &S3Config{Bucket: "b", AccessKeyEnv: "GFW_TEST_AK", SecretKeyEnv: "GFW_TEST_SK"}}
+	if _, err := newS3Sink(TenantConfig{Name: "x"}, d); err == nil {
+		t.Errorf("esperado erro sem credenciais")
+	}
+	t.Setenv("GFW_TEST_AK", "ak")
+	t.Setenv("GFW_TEST_SK", "sk")
+	s, err := newS3Sink(TenantConfig{Name: "x"}, d)
+	if err != nil || s.AccessKey != "ak" || s.SecretKey != "sk" {
+		t.Errorf("credenciais do ambiente não lidas: %v", err)
+	}
+	if s.Endpoint != "https://s3.us-east-1.amazonaws.com" {
+		t.Errorf("endpoint padrão incorreto: %s", s.Endpoint)
+	}
+
+	creds := filepath.Join(t.TempDir(), "credentials")
+	os.WriteFile(creds, []byte("[default]\naws_access_key_id = a1\naws_secret_access_key = s1\n\n[notas]\naws_access_key_id=a2\naws_secret_access_key=s2\naws_session_token=tok\n"), 0600)
+	d.S3 = &S3Config{Bucket: "b", CredentialsFile: creds, Profile: "notas"}
+	s, err = newS3Sink(TenantConfig{Name: "x"}, d)
+	if err != nil || s.AccessKey != "a2" || s.SecretKey != "s2" || s.SessionToken != "tok" {
+		t.Errorf("credenciais do arquivo não lidas: %+v %v", s, err)
+	}
+	d.S3.Profile = "nope"
+	if _, err := newS3Sink(TenantConfig{Name: "x"}, d); err == nil {
+		t.Errorf("esperado erro para profile inexistente")
+	}
+}
+
+func TestHandleFileS3Destination(t *testing.T) {
+	db, err := initDB(t)
+	if err != nil {
+		t.Fatalf("erro ao iniciar db: %v", err)
+	}
+	defer db.Close()
+	srv := s3fake.New()
+	defer srv.Close()
+	t.Setenv("AWS_ACCESS_KEY_ID", s3fake.AccessKey)
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+
+	tc := TenantConfig{
+		Name:     "tenantS3",
+		WatchDir: t.TempDir(),
+		Destinations: []DestinationConfig{{
+			Name: "bucket",
+			Type: destinationS3,
+			S3:   &S3Config{Endpoint: srv.URL, Bucket: "notas", Prefix: "{{.Tenant}}/{{.Year}}", PathStyle: true},
+		}},
+		Readiness: ReadinessConfig{Strategy: readinessCloseWrite},
+	}
+	w, err := New(&Config{Tenants: []TenantConfig{tc}}, db)
+	if err != nil {
+		t.Fatalf("erro no New: %v", err)
+	}
+	tc = w.cfg.Tenants[0]
+	filter, _ := newFileFilter(tc)
+	name := filepath.Join(tc.WatchDir, "nfe.xml")
+	os.WriteFile(name, []byte("<nfe/>"), 0644)
+
+	if err := handleFile(context.Background(), db, tc, filter, name, true, evCreate); err != nil {
+		t.Fatalf("erro no handleFile: %v", err)
+	}
+	keys := srv.Keys()
+	if len(keys) != 1 || keys[0] != "notas/tenantS3/"+time.Now().Format("2006")+"/nfe.xml" {
+		t.Fatalf("esperado um objeto com o prefixo renderizado, veio %v", keys)
+	}
+	rec, _ := store.GetProcessed(db, tc.Name, name)
+	if rec == nil || rec.DestPath != "s3://"+keys[0] {
+		t.Fatalf("dest_path deveria ser a chave do objeto: %+v", rec)
+	}
+	var etag, deliveryETag string
+	db.QueryRow("SELECT etag FROM processed_files WHERE id = ?", rec.ID).Scan(&etag)
+	db.QueryRow("SELECT etag FROM deliveries WHERE processed_id = ?", rec.ID).Scan(&deliveryETag)
+	if etag == "" || etag != deliveryETag {
+		t.Errorf("ETag não registrado: %q %q", etag, deliveryETag)
+	}
+
+	// --recopy reenvia ao bucket e --delete-processed apaga o objeto
+	key := keys[0][len("notas/"):]
+	tc.sinks["bucket"].(*sink.S3).Remove(context.Background(), rec.DestPath)
+	if err := w.Recopy(tc.Name, "", []int{int(rec.ID)}); err != nil {
+		t.Fatalf("erro no recopy: %v", err)
+	}
+	if data, ok := srv.Object("notas", key); !ok || string(data) != "<nfe/>" {
+		t.Errorf("recopy não reenviou o objeto %s", key)
+	}
+	if err := w.DeleteProcessed(tc.Name, []int{int(rec.ID)}); err != nil {
+		t.Fatalf("erro no delete: %v", err)
+	}
+	if _, ok := srv.Object("notas", key); ok {
+		t.Errorf("delete-processed não apagou o objeto %s", key)
+	}
+}
@@ -0,0 +1,97 @@
+package watcher
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/thiagozs/go-filewatcher/pkg/sink"
+	"golang.org/x/crypto/ssh"
+)
+
+// SFTPConfig é o servidor de um destino com type: sftp. A autenticação é só
+// por chave e a chave do servidor precisa ser fixada em host_key.
+type SFTPConfig struct {
+	Addr           string   `yaml:"addr"` // host ou host:porta (padrão 22)
+	User           string   `yaml:"user"`
+	PrivateKeyFile string   `yaml:"private_key_file"`
+	PassphraseEnv  string   `yaml:"passphrase_env"` // variável com a senha da chave, se houver
+	HostKey        string   `yaml:"host_key"`       // linha do known_hosts sem o host, ou SHA256:...
+	Dir            string   `yaml:"dir"`            // template com as variáveis do dest_template
+	MaxConns       int      `yaml:"max_conns"`
+	Timeout        Duration `yaml:"timeout"`
+}
+
+func (c *SFTPConfig) validate() error {
+	if c == nil || c.Addr == "" || c.User == "" {
+		return fmt.Errorf("sftp destinations require sftp.addr and sftp.user")
+	}
+	if c.PrivateKeyFile == "" {
+		return fmt.Errorf("sftp destinations require sftp.private_key_file")
+	}
+	if c.HostKey == "" {
+		return fmt.Errorf("sftp destinations require sftp.host_key")
+	}
+	if c.MaxConns < 0 {
+		return fmt.Errorf("sftp.max_conns must not be negative")
+	}
+	if _, err := parseDestTemplate(c.Dir); err != nil {
+		return fmt.Errorf("invalid sftp.dir: %w", err)
+	}
+	return nil
+}
+
+// newSFTPSink monta o sink do destino, lendo a chave privada.
+func newSFTPSink(tc TenantConfig, d DestinationConfig) (*sink.SFTP, error) {
+	c := d.SFTP
+	pemBytes, err := os.ReadFile(c.PrivateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	var signer ssh.Signer
+	if c.PassphraseEnv != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(pemBytes, []byte(os.Getenv(c.PassphraseEnv)))
+	} else {
+		signer, err = ssh.ParsePrivateKey(pemBytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("sftp.private_key_file: %w", err)
+	}
+	addr := c.Addr
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "22")
+	}
+	return &sink.SFTP{
+		Addr:     addr,
+		User:     c.User,
+		Auth:     []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKey:  c.HostKey,
+		Path:     sftpPath(tc, c.Dir),
+		Checksum: tc.Checksum,
+		MaxConns: c.MaxConns,
+		Timeout:  time.Duration(c.Timeout),
+	}, nil
+}
+
+// sftpPath monta o caminho remoto: o diretório renderizado seguido do
+// caminho relativo ao watch_dir.
+func sftpPath(tc TenantConfig, dir string) func(sink.File) (string, error) {
+	return func(f sink.File) (string, error) {
+		rendered, err := renderRemote(tc, "sftp.dir", dir, f)
+		if err != nil {
+			return "", err
+		}
+		// Com sftp.dir absoluto o path.Join absorveria o "..", então cada
+		// segmento do diretório renderizado é verificado
+		for _, seg := range strings.Split(rendered, "/") {
+			if seg == ".." {
+				return "", fmt.Errorf("%w: sftp.dir rendered %q for %s", errTemplate, rendered, f.Source)
+			}
+		}
+		return path.Join(rendered, filepath.ToSlash(f.RelPath)), nil
+	}
+}
@@ -0,0 +1,161 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/thiagozs/go-filewatcher/internal/sftpfake"
+	"github.com/thiagozs/go-filewatcher/pkg/sink"
+	"github.com/thiagozs/go-filewatcher/pkg/store"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSFTPConfigValidation(t *testing.T) {
+	ok := SFTPConfig{Addr: "h", User: "u", PrivateKeyFile: "/k", HostKey: "SHA256:x"}
+	cases := map[string]func(c *SFTPConfig){
+		"sem addr":     func(c *SFTPConfig) { c.Addr = "" },
+		"sem chave":    func(c *SFTPConfig) { c.PrivateKeyFile = "" },
+		"sem host_key": func(c *SFTPConfig) { c.HostKey = "" },
+		"dir inválido": func(c *SFTPConfig) { c.Dir = "{{.Tenant" },
+	}
+	for name, mutate := range cases {
+		c := ok
+		mutate(&c)
+		tc := TenantConfig{Name: "x", WatchDir: "/tmp/x", Destinations: []DestinationConfig{{Name: "p", Type: destinationSFTP, SFTP: &c}}}
+		if err := validateDestinations(&tc); err == nil {
+			t.Errorf("%s: esperado erro", name)
+		}
+	}
+}
+
+func sftpTenant(t *testing.T, name string, srv *sftpfake.Server, hostKey string) TenantConfig {
+	keyFile := filepath.Join(t.TempDir(), "id_ed25519")
+	os.WriteFile(keyFile, srv.ClientPEM, 0600)
+	return TenantConfig{
+		Name:     name,
+		WatchDir: t.TempDir(),
+		Destinations: []DestinationConfig{{
+			Name: "parceiro",
+			Type: destinationSFTP,
+			SFTP: &SFTPConfig{
+				Addr:           srv.Addr,
+				User:           sftpfake.User,
+				PrivateKeyFile: keyFile,
+				HostKey:        hostKey,
+				Dir:            filepath.ToSlash(t.TempDir()) + "/{{.Tenant}}",
+			},
+		}},
+		Readiness: ReadinessConfig{Strategy: readinessCloseWrite},
+	}
+}
+
+func TestSFTPPathRejectsParent(t *testing.T) {
+	watchDir := t.TempDir()
+	tc := TenantConfig{Name: "sftpPath", WatchDir: watchDir, NamePattern: `^(?P<cliente>[^_]+)_`}
+	for _, dir := range []string{"/upload/{{.Match.cliente}}", "upload/{{.Match.cliente}}/x"} {
+		for name, want := range map[string]bool{"acme_1.csv": true, ".._1.csv": false} {
+			f := sink.File{Source: filepath.Join(watchDir, name), RelPath: name, Arrival: time.Now()}
+			_, err := sftpPath(tc, dir)(f)
+			if want && err != nil {
+				t.Errorf("%s com %s: erro inesperado: %v", dir, name, err)
+			}
+			if !want && !errors.Is(err, errTemplate) {
+				t.Errorf("%s com %s: esperado errTemplate, veio %v", dir, name, err)
+			}
+		}
+	}
+}
+
+func TestHandleFileSFTPDestination(t *testing.T) {
+	db, err := initDB(t)
+	if err != nil {
+		t.Fatalf("erro ao iniciar db: %v", err)
+	}
+	defer db.Close()
+	srv, err := sftpfake.New()
+	if err != nil {
+		t.Fatalf("erro ao iniciar servidor ssh: %v", err)
+	}
+	defer srv.Close()
+
+	tc := sftpTenant(t, "tenantSFTP", srv, string(ssh.MarshalAuthorizedKey(srv.HostKey)))
+	remoteDir := filepath.Join(filepath.Dir(filepath.FromSlash(tc.Destinations[0].SFTP.Dir)), "tenantSFTP")
+	w, err := New(&Config{Tenants: []TenantConfig{tc}}, db)
+	if err != nil {
+		t.Fatalf("erro no New: %v", err)
+	}
+	defer w.Close()
+	tc = w.cfg.Tenants[0]
+	filter, _ := newFileFilter(tc)
+	name := filepath.Join(tc.WatchDir, "nfe.xml")
+	os.WriteFile(name, []byte("<nfe/>"), 0644)
+
+	if err := handleFile(context.Background(), db, tc, filter, name, false, evCreate); err != nil {
+		t.Fatalf("erro no handleFile: %v", err)
+	}
+	remote := filepath.Join(remoteDir, "nfe.xml")
+	if data, _ := os.ReadFile(remote); string(data) != "<nfe/>" {
+		t.Fatalf("arquivo não entregue no servidor: %q", data)
+	}
+	if fileExists(name) {
+		t.Errorf("origem deveria ser removida após a entrega")
+	}
+	rec, _ := store.GetProcessed(db, tc.Name, name)
+	if rec == nil || rec.DestPath != "sftp://"+sftpfake.User+"@"+srv.Addr+filepath.ToSlash(remote) {
+		t.Fatalf("dest_path deveria ser o caminho remoto: %+v", rec)
+	}
+
+	// --recopy regrava no servidor e --delete-processed apaga o remoto
+	os.Remove(remote)
+	os.WriteFile(name, []byte("<nfe/>"), 0644)
+	if err := w.Recopy(tc.Name, "", []int{int(rec.ID)}); err != nil {
+		t.Fatalf("erro no recopy: %v", err)
+	}
+	if !fileExists(remote) {
+		t.Errorf("recopy não regravou %s", remote)
+	}
+	if err := w.DeleteProcessed(tc.Name, []int{int(rec.ID)}); err != nil {
+		t.Fatalf("erro no delete: %v", err)
+	}
+	if fileExists(remote) {
+		t.Errorf("delete-processed não apagou %s", remote)
+	}
+}
+
+func TestHandleFileSFTPHostKeyMismatch(t *testing.T) {
+	db, err := initDB(t)
+	if err != nil {
+		t.Fatalf("erro ao iniciar db: %v", err)
+	}
+	defer db.Close()
+	srv, err := sftpfake.New()
+	if err != nil {
+		t.Fatalf("erro ao iniciar servidor ssh: %v", err)
+	}
+	defer srv.Close()
+
+	tc := sftpTenant(t, "tenantSFTPPinning", srv, "SHA256:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA")
+	w, err := New(&Config{Tenants: []TenantConfig{tc}}, db)
+	if err != nil {
+		t.Fatalf("erro no New: %v", err)
+	}
+	defer w.Close()
+	tc = w.cfg.Tenants[0]
+	filter, _ := newFileFilter(tc)
+	name := filepath.Join(tc.WatchDir, "nfe.xml")
+	os.WriteFile(name, []byte("<nfe/>"), 0644)
+
+	if err := handleFile(context.Background(), db, tc, filter, name, false, evCreate); err == nil {
+		t.Fatalf("esperado erro com host key divergente")
+	}
+	if !fileExists(name) {
+		t.Errorf("origem deveria ficar para nova tentativa")
+	}
+	if rec, _ := store.GetProcessed(db, tc.Name, name); rec != nil {
+		t.Errorf("arquivo não entregue não deveria ser registrado")
+	}
+}
@@ -0,0 +1,32 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+func TestCopyFile(t *testing.T) {
+	srcFile, err := os.CreateTemp("", "src-*.txt")
+	if err != nil {
+		t.Fatalf("erro ao criar src: %v", err)
+	}
+	defer os.Remove(srcFile.Name())
+	conteudo := []byte("abc123")
+	srcFile.Write(conteudo)
+	srcFile.Close()
+	destFile := filepath.Join(os.TempDir(), "dest-abc123.txt")
+	defer os.Remove(destFile)
+	if err := copyFile(srcFile.Name(), destFile); err != nil {
+		t.Fatalf("erro ao copiar arquivo: %v", err)
+	}
+	data, err := os.ReadFile(destFile)
+	if err != nil {
+		t.Fatalf("erro ao ler destino: %v", err)
+	}
+	if string(data) != string(conteudo) {
+		t.Errorf("conteúdo incorreto: %s", string(data))
+	}
+}
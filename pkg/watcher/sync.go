@@ -0,0 +1,182 @@
+package watcher
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/thiagozs/go-filewatcher/pkg/sink"
+	"github.com/thiagozs/go-filewatcher/pkg/store"
+)
+
+// Sincroniza arquivos entre diretórios e banco ao iniciar
+func syncTenantDirs(db *sql.DB, tc TenantConfig) error {
+	filter, err := newFileFilter(tc)
+	if err != nil {
+		return err
+	}
+	// Restos de cópias interrompidas nunca são arquivos válidos
+	for _, d := range tc.allDestinations() {
+		if _, custom := tc.sinks[d.Name]; !custom && d.Path != "" {
+			sink.CleanupTempFiles(d.Path)
+		}
+	}
+	if tc.Batch != nil {
+		sink.CleanupTempFiles(batchStagingDir(tc))
+	}
+	filesSet := make(map[string]struct{})
+	// Indexa todos os arquivos dos dois diretórios (caminhos relativos)
+	for _, f := range listFiles(tc.WatchDir, tc.Recursive) {
+		filesSet[f] = struct{}{}
+	}
+	// Com dest_template, compressão, cifragem, batch, extract, routes ou um
+	// sink próprio no destino principal o destino não espelha os nomes da
+	// origem, então não há como casar os dois diretórios pelo caminho relativo
+	primary := tc.destinations()[0]
+	_, custom := tc.sinks[primary.Name]
+	ptc := tc.forDestination(primary)
+	templated := custom || ptc.DestTemplate != "" || ptc.Compress != nil || ptc.Encrypt != nil || tc.Batch != nil || tc.Extract != nil || len(tc.Routes) > 0
+	if !templated {
+		for _, f := range listFiles(tc.DestDir, tc.Recursive) {
+			filesSet[f] = struct{}{}
+		}
+	}
+	for fname := range filesSet {
+		srcPath := filepath.Join(tc.WatchDir, fname)
+		dstPath := filepath.Join(tc.DestDir, fname)
+		if !filterFile(db, tc, filter, srcPath) {
+			continue
+		}
+		// Sentinelas nunca são copiados
+		if _, ok := sentinelTarget(tc, srcPath); ok {
+			continue
+		}
+		srcExists := fileExists(srcPath)
+		dstExists := !templated && fileExists(dstPath)
+		prev, _ := store.GetProcessed(db, tc.Name, srcPath)
+		// Com path+content, uma nova versão do mesmo caminho é entregue de novo
+		if prev != nil && prev.DuplicateOf == 0 && srcExists && dedupeMode(tc) == dedupePathContent {
+			if sum, err := sink.FileChecksum(srcPath, tc.Checksum); err == nil && sum != prev.Checksum {
+				if !syncCopy(db, tc, srcPath, true) {
+					continue
+				}
+				log.Printf("[Sync] Content changed: Copied '%s' to '%s' for tenant '%s'", srcPath, dstPath, tc.Name)
+			}
+			continue
+		}
+		// Se não está no banco, processa
+		if prev == nil {
+			// Se só existe no destino, registra no banco
+			if !srcExists && dstExists {
+				fi, _ := os.Stat(dstPath)
+				sum, _ := sink.FileChecksum(dstPath, tc.Checksum)
+				store.SaveProcessed(db, store.Processed{Tenant: tc.Name, File: srcPath, FileSize: fi.Size(), DestPath: dstPath, Checksum: sum}, false)
+				log.Printf("[Sync] Only in dest: Registering file '%s' in database for tenant '%s'", dstPath, tc.Name)
+			}
+			// Se só existe no watch, copia e registra
+			if srcExists && !dstExists {
+				// Sem sentinela o arquivo ainda não está pronto; o watcher o
+				// processa quando o sentinela chegar
+				if _, ok := findSentinel(tc, srcPath); tc.Readiness.Strategy == readinessSentinel && !ok {
+					debugf("[Sync] Waiting for sentinel of '%s' for tenant '%s'", srcPath, tc.Name)
+					continue
+				}
+				if dedupeMode(tc) == dedupeContent {
+					sum, err := sink.FileChecksum(srcPath, tc.Checksum)
+					if err != nil {
+						log.Printf("[Sync] Error hashing '%s': %v", srcPath, err)
+						continue
+					}
+					if dup, _ := findDuplicate(db, tc, nil, sum); dup != nil {
+						fi, _ := os.Stat(srcPath)
+						markDuplicate(db, tc, srcPath, fi.Size(), sum, dup)
+						removeSentinel(tc, srcPath)
+						log.Printf("[Sync] Only in watch: '%s' has the same content as id %d for tenant '%s'. Not copied.", srcPath, dup.ID, tc.Name)
+						continue
+					}
+				}
+				if !syncCopy(db, tc, srcPath, false) {
+					continue
+				}
+				log.Printf("[Sync] Only in watch: Copied '%s' to '%s' for tenant '%s'", srcPath, dstPath, tc.Name)
+			}
+			// Se existe nos dois com o mesmo conteúdo, só registra; se
+			// diverge, aplica on_conflict
+			if srcExists && dstExists {
+				_, err := resolveDest(tc.forDestination(tc.destinations()[0]), srcPath, dstPath)
+				if err != nil && !errors.Is(err, errAlreadyDelivered) {
+					reportConflict(db, tc, srcPath, err)
+					continue
+				}
+				if err == nil {
+					if !syncCopy(db, tc, srcPath, false) {
+						continue
+					}
+					log.Printf("[Sync] In both with different content: Delivered '%s' for tenant '%s'", srcPath, tc.Name)
+					continue
+				}
+				fi, _ := os.Stat(srcPath)
+				sum, _ := sink.FileChecksum(srcPath, tc.Checksum)
+				store.SaveProcessed(db, store.Processed{Tenant: tc.Name, File: srcPath, FileSize: fi.Size(), DestPath: dstPath, SourceMtime: fi.ModTime().UnixNano(), Checksum: sum}, false)
+				log.Printf("[Sync] In both: Registering file '%s' in database for tenant '%s'", srcPath, tc.Name)
+			}
+		}
+	}
+	// O lote pode ter vencido a janela com o serviço parado
+	if tc.Batch != nil {
+		flushDueBatch(db, tc, time.Now())
+	}
+	return nil
+}
+
+// syncCopy entrega o arquivo em todos os destinos durante a sincronização e
+// registra no banco. Retorna false se algum destino obrigatório falhou.
+func syncCopy(db *sql.DB, tc TenantConfig, srcPath string, replace bool) bool {
+	fi, err := os.Stat(srcPath)
+	if err != nil {
+		log.Printf("[Sync] Source '%s' not available: %v", srcPath, err)
+		return false
+	}
+	if tc.Batch != nil {
+		prev, _ := store.GetProcessed(db, tc.Name, srcPath)
+		if err := stageFile(db, tc, srcPath, fi, prev, replace, true); err != nil {
+			if _, err := scheduleRetry(db, tc, srcPath, err); err != nil {
+				log.Printf("[Sync] Failed to schedule retry for '%s': %v", srcPath, err)
+			}
+			return false
+		}
+		return true
+	}
+	if extractFormat(tc, srcPath) != "" {
+		if err := extractFile(context.Background(), db, tc, srcPath, fi, replace, true); err != nil {
+			if _, err := scheduleRetry(db, tc, srcPath, err); err != nil {
+				log.Printf("[Sync] Failed to schedule retry for '%s': %v", srcPath, err)
+			}
+			return false
+		}
+		return true
+	}
+	// A sincronização nunca remove a origem, então move vira cópia
+	results := deliverAll(context.Background(), db, tc, srcPath, srcPath, fi, true)
+	primary, ok := requiredDelivered(results)
+	if !ok {
+		log.Printf("[Sync] '%s' was not delivered to every required destination for tenant '%s'", srcPath, tc.Name)
+		// O watcher tenta de novo sem esperar o próximo start
+		if err := deliveryError(results); err != nil {
+			if _, err := scheduleRetry(db, tc, srcPath, err); err != nil {
+				log.Printf("[Sync] Failed to schedule retry for '%s': %v", srcPath, err)
+			}
+		}
+		return false
+	}
+	removeSentinel(tc, srcPath)
+	store.SaveProcessed(db, store.Processed{Tenant: tc.Name, File: srcPath, FileSize: fi.Size(), DestPath: primary.DestPath, SourceMtime: fi.ModTime().UnixNano(), Checksum: primary.Checksum, Method: primary.Method, ETag: primary.ETag, StoredSize: primary.StoredSize, Compression: primary.Compression, KeyID: primary.KeyID, Route: primary.Route}, replace)
+	if err := saveDeliveries(db, tc.Name, srcPath, results); err != nil {
+		log.Printf("[Sync] Failed to record deliveries of '%s': %v", srcPath, err)
+	}
+	return true
+}
@@ -1,10 +1,12 @@
-package main
+package watcher
 
 import (
 	"database/sql"
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/thiagozs/go-filewatcher/pkg/store"
 )
 
 // Testa a sincronização automática entre diretórios e banco de dados
@@ -36,6 +38,10 @@ func TestSyncTenantDirs(t *testing.T) {
 	if err != nil {
 		t.Fatalf("erro ao criar tabela: %v", err)
 	}
+	// Aplica as migrações sobre o schema antigo
+	if err := store.Migrate(db); err != nil {
+		t.Fatalf("erro ao migrar tabela: %v", err)
+	}
 
 	watchDir := t.TempDir()
 	destDir := t.TempDir()
@@ -61,9 +67,9 @@ func TestSyncTenantDirs(t *testing.T) {
 		t.Errorf("arquivo não copiado para destino")
 	}
 	// Deve estar registrado no banco
-	processed, err := hasProcessed(db, tenant.Name, watchFile)
+	processed, err := store.HasProcessed(db, tenant.Name, watchFile)
 	if err != nil {
-		t.Fatalf("erro ao checar hasProcessed: %v", err)
+		t.Fatalf("erro ao checar store.HasProcessed: %v", err)
 	}
 	if !processed {
 		t.Errorf("arquivo não registrado no banco após sync")
@@ -0,0 +1,175 @@
+package watcher
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/thiagozs/go-filewatcher/pkg/sink"
+)
+
+// errTemplate indica que o caminho de destino não pôde ser montado.
+var errTemplate = errors.New("invalid destination path")
+
+var templateFuncs = template.FuncMap{
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+// parseDestTemplate compila o dest_template. Chaves ausentes (ex.: grupo do
+// name_pattern que não casou) são erro, em vez de gerar "<no value>" no caminho.
+func parseDestTemplate(text string) (*template.Template, error) {
+	return template.New("dest_template").Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+}
+
+func validateTemplate(tc TenantConfig) error {
+	if tc.DestTemplate != "" {
+		if _, err := parseDestTemplate(tc.DestTemplate); err != nil {
+			return fmt.Errorf("invalid dest_template: %w", err)
+		}
+	}
+	if tc.NamePattern != "" {
+		if _, err := regexp.Compile(tc.NamePattern); err != nil {
+			return fmt.Errorf("invalid name_pattern: %w", err)
+		}
+	}
+	return nil
+}
+
+// pathVars são os dados disponíveis no dest_template.
+type pathVars struct {
+	Tenant  string
+	Name    string // nome do arquivo, ex.: "nota.xml"
+	Stem    string // nome sem extensão, ex.: "nota"
+	Ext     string // extensão com ponto, ex.: ".xml"
+	RelDir  string // subdiretório relativo ao watch_dir ("" na raiz)
+	RelPath string // caminho relativo ao watch_dir
+	Size    int64
+	Arrival time.Time
+	Mtime   time.Time
+
+	Year, Month, Day, Hour, Minute  string // data de chegada
+	MtimeYear, MtimeMonth, MtimeDay string // data de modificação da origem
+
+	Match  map[string]string // grupos nomeados do name_pattern
+	Groups []string          // todos os grupos do name_pattern (0 = nome inteiro)
+
+	src  string
+	algo string
+	sum  string
+}
+
+func newPathVars(tc TenantConfig, name string, fi os.FileInfo, arrival time.Time) *pathVars {
+	base := filepath.Base(name)
+	rel := base
+	if r, err := filepath.Rel(tc.WatchDir, name); err == nil && !strings.HasPrefix(r, "..") {
+		rel = r
+	}
+	stem, ext := splitExt(base)
+	v := &pathVars{
+		Tenant:  tc.Name,
+		Name:    base,
+		Stem:    stem,
+		Ext:     ext,
+		RelPath: rel,
+		Arrival: arrival,
+		Match:   make(map[string]string),
+		src:     name,
+		algo:    tc.Checksum,
+	}
+	if dir := filepath.Dir(rel); dir != "." {
+		v.RelDir = dir
+	}
+	if fi != nil {
+		v.Size, v.Mtime = fi.Size(), fi.ModTime()
+	}
+	v.Year, v.Month, v.Day = arrival.Format("2006"), arrival.Format("01"), arrival.Format("02")
+	v.Hour, v.Minute = arrival.Format("15"), arrival.Format("04")
+	v.MtimeYear, v.MtimeMonth, v.MtimeDay = v.Mtime.Format("2006"), v.Mtime.Format("01"), v.Mtime.Format("02")
+	if tc.NamePattern != "" {
+		re := regexp.MustCompile(tc.NamePattern)
+		if m := re.FindStringSubmatch(base); m != nil {
+			v.Groups = m
+			for i, n := range re.SubexpNames() {
+				if n != "" {
+					v.Match[n] = m[i]
+				}
+			}
+		}
+	}
+	return v
+}
+
+// Hash retorna o digest (hex) da origem, calculado só se o template o usar.
+func (v *pathVars) Hash() (string, error) {
+	if v.sum == "" {
+		sum, err := sink.FileChecksum(v.src, v.algo)
+		if err != nil {
+			return "", err
+		}
+		v.sum = sum
+	}
+	_, digest := sink.SplitChecksum(v.sum)
+	return digest, nil
+}
+
+// checksum retorna o checksum da origem no formato algoritmo:hex.
+func (v *pathVars) checksum() (string, error) {
+	if _, err := v.Hash(); err != nil {
+		return "", err
+	}
+	return v.sum, nil
+}
+
+// Hash8 retorna os 8 primeiros caracteres do digest.
+func (v *pathVars) Hash8() (string, error) {
+	h, err := v.Hash()
+	if len(h) > 8 {
+		h = h[:8]
+	}
+	return h, err
+}
+
+// renderDestPath aplica o dest_template do tenant; sem template, o destino
+// espelha o caminho relativo da origem. O resultado precisa ficar dentro do
+// dest_dir.
+func renderDestPath(tc TenantConfig, name string, vars *pathVars) (string, error) {
+	if tc.DestTemplate == "" {
+		return destPathFor(tc, name), nil
+	}
+	tmpl, err := parseDestTemplate(tc.DestTemplate)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errTemplate, err)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, vars); err != nil {
+		return "", fmt.Errorf("%w: render dest_template for %s: %v", errTemplate, name, err)
+	}
+	rel := filepath.Clean(filepath.FromSlash(b.String()))
+	if rel == "." || filepath.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: dest_template rendered %q for %s, outside dest_dir", errTemplate, b.String(), name)
+	}
+	return filepath.Join(tc.DestDir, rel), nil
+}
+
+// renderRemote aplica o template de um campo de destino remoto
+// (s3.prefix, sftp.dir, http.url) com as mesmas variáveis do dest_template.
+func renderRemote(tc TenantConfig, field, text string, f sink.File) (string, error) {
+	if text == "" {
+		return "", nil
+	}
+	tmpl, err := parseDestTemplate(text)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errTemplate, err)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, newPathVars(tc, f.Source, f.Info, f.Arrival)); err != nil {
+		return "", fmt.Errorf("%w: render %s for %s: %v", errTemplate, field, f.Source, err)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,107 @@
+package watcher
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thiagozs/go-filewatcher/pkg/store"
+)
+
+func TestRenderDestPath(t *testing.T) {
+	watchDir := t.TempDir()
+	name := filepath.Join(watchDir, "clientes", "NF_1234_2024.xml")
+	os.MkdirAll(filepath.Dir(name), 0755)
+	os.WriteFile(name, []byte("abc"), 0644)
+	mtime := time.Date(2023, 12, 15, 12, 0, 0, 0, time.UTC)
+	os.Chtimes(name, mtime, mtime)
+	fi, _ := os.Stat(name)
+
+	tc := TenantConfig{
+		Name:        "fiscal",
+		WatchDir:    watchDir,
+		DestDir:     "/dest",
+		Recursive:   true,
+		NamePattern: `^NF_(?P<numero>\d+)_(?P<ano>\d{4})`,
+	}
+	arrival := time.Date(2024, 5, 7, 9, 5, 0, 0, time.UTC)
+	cases := map[string]string{
+		"{{.Tenant}}/{{.Year}}/{{.Month}}/{{.Day}}/{{.Stem}}-{{.Hash8}}{{.Ext}}": "/dest/fiscal/2024/05/07/NF_1234_2024-ba7816bf.xml",
+		"{{.RelDir}}/{{.MtimeYear}}-{{.MtimeMonth}}/{{.Name}}":                   "/dest/clientes/2023-12/NF_1234_2024.xml",
+		"{{.Match.ano}}/{{index .Groups 1}}{{.Ext | upper}}":                     "/dest/2024/1234.XML",
+		"{{.Size}}/{{.Hour}}{{.Minute}}/{{.RelPath}}":                            "/dest/3/0905/clientes/NF_1234_2024.xml",
+	}
+	for tmpl, want := range cases {
+		tc.DestTemplate = tmpl
+		got, err := renderDestPath(tc, name, newPathVars(tc, name, fi, arrival))
+		if err != nil {
+			t.Errorf("%s: erro ao renderizar: %v", tmpl, err)
+			continue
+		}
+		if got != filepath.FromSlash(want) {
+			t.Errorf("%s: veio %q, esperado %q", tmpl, got, want)
+		}
+	}
+
+	for _, tmpl := range []string{"../{{.Name}}", "{{.Match.inexistente}}/{{.Name}}", ""} {
+		tc.DestTemplate = tmpl
+		if tmpl == "" {
+			tc.DestTemplate = "{{if false}}x{{end}}"
+		}
+		if _, err := renderDestPath(tc, name, newPathVars(tc, name, fi, arrival)); err == nil {
+			t.Errorf("%q: esperado erro", tc.DestTemplate)
+		}
+	}
+	if err := validateTemplate(TenantConfig{DestTemplate: "{{.Name"}); err == nil {
+		t.Errorf("esperado erro para template inválido")
+	}
+}
+
+func TestHandleFileDestTemplate(t *testing.T) {
+	db, err := initDB(t)
+	if err != nil {
+		t.Fatalf("erro ao iniciar db: %v", err)
+	}
+	defer db.Close()
+
+	tc := TenantConfig{
+		Name:         "tenantTemplate",
+		WatchDir:     t.TempDir(),
+		DestDir:      t.TempDir(),
+		DestTemplate: "{{.Year}}/{{.Month}}/{{.Stem}}-{{.Hash8}}{{.Ext}}",
+		Readiness:    ReadinessConfig{Strategy: readinessCloseWrite},
+	}
+	filter, _ := newFileFilter(tc)
+	name := filepath.Join(tc.WatchDir, "extrato.csv")
+	os.WriteFile(name, []byte("abc"), 0644)
+
+	handleFile(context.Background(), db, tc, filter, name, true, evCreate)
+
+	now := time.Now()
+	want := filepath.Join(tc.DestDir, now.Format("2006"), now.Format("01"), "extrato-ba7816bf.csv")
+	rec, _ := store.GetProcessed(db, tc.Name, name)
+	if rec == nil || rec.DestPath != want {
+		t.Fatalf("dest_path %+v, esperado %s", rec, want)
+	}
+
+	// recopy e delete usam o caminho renderizado
+	os.Remove(want)
+	if err := recopyFiles(db, nil, tc.Name, "", []int{int(rec.ID)}, false); err != nil {
+		t.Fatalf("erro no recopy: %v", err)
+	}
+	if !fileExists(want) {
+		t.Errorf("recopy não regravou %s", want)
+	}
+	if err := deleteProcessedFiles(db, nil, tc.Name, []int{int(rec.ID)}); err != nil {
+		t.Fatalf("erro no delete: %v", err)
+	}
+	if fileExists(want) {
+		t.Errorf("delete não removeu %s", want)
+	}
+	if entries, _ := os.ReadDir(tc.DestDir); len(entries) != 1 || !strings.HasPrefix(entries[0].Name(), now.Format("2006")) {
+		t.Errorf("arquivos inesperados no destino: %v", entries)
+	}
+}
@@ -0,0 +1,110 @@
+package watcher
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/thiagozs/go-filewatcher/pkg/sink"
+)
+
+// Modos de entrega do arquivo no destino (transfer_mode do tenant).
+const (
+	transferCopy     = "copy"     // cópia com checksum (padrão)
+	transferMove     = "move"     // rename no mesmo dispositivo, cópia + remoção entre dispositivos
+	transferHardlink = "hardlink" // hardlink para a origem; cópia entre dispositivos
+	transferReflink  = "reflink"  // clone copy-on-write (FICLONE, btrfs/xfs); cópia se não suportado
+)
+
+var errReflinkUnsupported = errors.New("reflink not supported")
+
+func validateTransferMode(mode string) error {
+	switch mode {
+	case "", transferCopy, transferMove, transferHardlink, transferReflink:
+		return nil
+	}
+	return fmt.Errorf("unknown transfer_mode %q", mode)
+}
+
+// transferFile entrega src em dst conforme o transfer_mode do tenant e retorna
+// o método efetivamente usado e o checksum do destino. Quando o modo pedido
+// não é possível (outro dispositivo, sistema de arquivos sem suporte) a
+// entrega cai para a cópia. Com keepSource, move vira cópia. Com compress ou
+// encrypt o conteúdo é transformado durante a cópia (enc) e o checksum é o
+// do original.
+// O método transferMove indica que a origem já não existe.
+func transferFile(tc TenantConfig, src, dst string, keepSource bool, enc sink.Encoding) (string, string, error) {
+	if enc.Compression != nil || enc.Encryption != nil {
+		sum, err := sink.EncodeFileWithChecksum(src, dst, tc.Checksum, enc)
+		return transferCopy, sum, err
+	}
+	mode := tc.TransferMode
+	if mode == transferMove && keepSource {
+		mode = transferCopy
+	}
+	var err error
+	switch mode {
+	case transferMove:
+		if err = renameInto(src, dst); err == nil {
+			return transferMove, destChecksum(tc, dst), nil
+		}
+	case transferHardlink:
+		if err = linkInto(src, dst); err == nil {
+			return transferHardlink, destChecksum(tc, dst), nil
+		}
+	case transferReflink:
+		if err = reflinkFile(src, dst); err == nil {
+			return transferReflink, destChecksum(tc, dst), nil
+		}
+		if !errors.Is(err, errReflinkUnsupported) {
+			return "", "", err
+		}
+	}
+	if err != nil {
+		debugf("[%s] %s of %s failed (%v), falling back to copy", tc.Name, mode, src, err)
+	}
+	sum, err := sink.CopyFileWithChecksum(src, dst, tc.Checksum)
+	return transferCopy, sum, err
+}
+
+// destChecksum calcula o checksum do arquivo já entregue. Uma falha aqui não
+// desfaz a entrega: o registro fica sem checksum.
+func destChecksum(tc TenantConfig, dst string) string {
+	sum, err := sink.FileChecksum(dst, tc.Checksum)
+	if err != nil {
+		log.Printf("[%s] Failed to hash %s: %v", tc.Name, dst, err)
+	}
+	return sum
+}
+
+// renameInto move src para dst; falha com EXDEV entre dispositivos.
+func renameInto(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(src, dst); err != nil {
+		return err
+	}
+	return sink.SyncDir(filepath.Dir(dst))
+}
+
+// linkInto cria o hardlink com um nome temporário e o renomeia para dst, para
+// que um destino existente seja substituído de forma atômica.
+func linkInto(src, dst string) error {
+	tmp, err := sink.CreateAtomic(dst)
+	if err != nil {
+		return err
+	}
+	// Só o nome único interessa; o link ocupa o lugar do temporário
+	tmp.Abort()
+	if err := os.Link(src, tmp.Name()); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return sink.SyncDir(filepath.Dir(dst))
+}
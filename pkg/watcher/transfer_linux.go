@@ -0,0 +1,28 @@
+package watcher
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/thiagozs/go-filewatcher/pkg/sink"
+	"golang.org/x/sys/unix"
+)
+
+// reflinkFile clona src em dst com FICLONE, compartilhando os blocos até que
+// um dos lados seja alterado.
+func reflinkFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := sink.CreateAtomic(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Abort()
+	if err := unix.IoctlFileClone(int(out.Fd()), int(in.Fd())); err != nil {
+		return fmt.Errorf("%w: %v", errReflinkUnsupported, err)
+	}
+	return out.Commit()
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+
+package watcher
+
+func reflinkFile(src, dst string) error {
+	return errReflinkUnsupported
+}
@@ -0,0 +1,113 @@
+package watcher
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/thiagozs/go-filewatcher/pkg/sink"
+	"github.com/thiagozs/go-filewatcher/pkg/store"
+)
+
+func transferTenant(t *testing.T, name, mode string) TenantConfig {
+	return TenantConfig{
+		Name:         name,
+		WatchDir:     t.TempDir(),
+		DestDir:      t.TempDir(),
+		TransferMode: mode,
+		Readiness:    ReadinessConfig{Strategy: readinessCloseWrite},
+	}
+}
+
+func TestHandleFileTransferMove(t *testing.T) {
+	db, err := initDB(t)
+	if err != nil {
+		t.Fatalf("erro ao iniciar db: %v", err)
+	}
+	defer db.Close()
+
+	tc := transferTenant(t, "tenantMove", transferMove)
+	filter, _ := newFileFilter(tc)
+	name := filepath.Join(tc.WatchDir, "imagem.iso")
+	os.WriteFile(name, []byte("conteudo grande"), 0644)
+	before, _ := os.Stat(name)
+
+	handleFile(context.Background(), db, tc, filter, name, false, evCreate)
+
+	after, err := os.Stat(filepath.Join(tc.DestDir, "imagem.iso"))
+	if err != nil {
+		t.Fatalf("arquivo não entregue: %v", err)
+	}
+	if !os.SameFile(before, after) {
+		t.Errorf("move no mesmo dispositivo deveria usar rename")
+	}
+	if fileExists(name) {
+		t.Errorf("origem deveria ter sido movida")
+	}
+	rec, _ := store.GetProcessed(db, tc.Name, name)
+	if rec == nil || rec.Method != transferMove || rec.Checksum == "" {
+		t.Errorf("registro incorreto: %+v", rec)
+	}
+}
+
+func TestHandleFileTransferMoveKeepSource(t *testing.T) {
+	db, err := initDB(t)
+	if err != nil {
+		t.Fatalf("erro ao iniciar db: %v", err)
+	}
+	defer db.Close()
+
+	tc := transferTenant(t, "tenantMoveKeep", transferMove)
+	filter, _ := newFileFilter(tc)
+	name := filepath.Join(tc.WatchDir, "planilha.xlsx")
+	os.WriteFile(name, []byte("xlsx"), 0644)
+
+	handleFile(context.Background(), db, tc, filter, name, true, evCreate)
+
+	if !fileExists(name) {
+		t.Errorf("com --keep-source a origem deve ser mantida")
+	}
+	rec, _ := store.GetProcessed(db, tc.Name, name)
+	if rec == nil || rec.Method != transferCopy {
+		t.Errorf("move com --keep-source deveria copiar: %+v", rec)
+	}
+}
+
+func TestTransferFileHardlinkAndReflink(t *testing.T) {
+	tc := transferTenant(t, "tenantLink", transferHardlink)
+	src := filepath.Join(tc.WatchDir, "dump.sql")
+	os.WriteFile(src, []byte("select 1;"), 0644)
+	dst := filepath.Join(tc.DestDir, "dump.sql")
+	os.WriteFile(dst, []byte("antigo"), 0644)
+
+	method, sum, err := transferFile(tc, src, dst, true, sink.Encoding{})
+	if err != nil || method != transferHardlink {
+		t.Fatalf("hardlink falhou: método %q, erro %v", method, err)
+	}
+	si, _ := os.Stat(src)
+	di, _ := os.Stat(dst)
+	if !os.SameFile(si, di) {
+		t.Errorf("destino deveria ser hardlink da origem")
+	}
+	if want, _ := sink.FileChecksum(src, ""); sum != want {
+		t.Errorf("checksum %q, esperado %q", sum, want)
+	}
+
+	// Sem suporte a FICLONE (ex.: tmpfs) a entrega cai para a cópia
+	tc.TransferMode = transferReflink
+	dst2 := filepath.Join(tc.DestDir, "dump2.sql")
+	method, _, err = transferFile(tc, src, dst2, true, sink.Encoding{})
+	if err != nil {
+		t.Fatalf("reflink falhou: %v", err)
+	}
+	if method != transferReflink && method != transferCopy {
+		t.Errorf("método inesperado %q", method)
+	}
+	if b, _ := os.ReadFile(dst2); string(b) != "select 1;" {
+		t.Errorf("conteúdo incorreto após reflink: %q", b)
+	}
+	if err := validateTransferMode("symlink"); err == nil {
+		t.Errorf("esperado erro para transfer_mode desconhecido")
+	}
+}
@@ -0,0 +1,525 @@
+package watcher
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thiagozs/go-filewatcher/pkg/sink"
+	"github.com/thiagozs/go-filewatcher/pkg/store"
+)
+
+// Watcher observa os tenants de um Config e entrega os arquivos que chegam.
+type Watcher struct {
+	cfg        Config
+	db         *sql.DB
+	keepSource bool
+	sinks      map[string]map[string]sink.Sink // tenant -> destino -> sink
+	processors []sink.Processor
+}
+
+// Option configura o Watcher criado por New.
+type Option func(*Watcher)
+
+// WithKeepSource mantém os arquivos de origem após a entrega.
+func WithKeepSource(keep bool) Option {
+	return func(w *Watcher) { w.keepSource = keep }
+}
+
+// WithSink entrega os arquivos do destino do tenant com s em vez da cópia
+// local. Destinos com type: custom precisam de um sink; os com type s3 ou
+// sftp usam o sink montado a partir do config, a menos que recebam outro aqui. Para
+// tenants só com dest_dir, o destino se chama "default".
+func WithSink(tenant, destination string, s sink.Sink) Option {
+	return func(w *Watcher) {
+		if w.sinks[tenant] == nil {
+			w.sinks[tenant] = make(map[string]sink.Sink)
+		}
+		w.sinks[tenant][destination] = s
+	}
+}
+
+// WithProcessors encadeia processadores antes do sink de todos os destinos,
+// na ordem informada.
+func WithProcessors(processors ...sink.Processor) Option {
+	return func(w *Watcher) { w.processors = append(w.processors, processors...) }
+}
+
+// New valida cfg e prepara o Watcher. O banco deve ter sido aberto com
+// store.Open.
+func New(cfg *Config, db *sql.DB, opts ...Option) (*Watcher, error) {
+	w := &Watcher{db: db, sinks: make(map[string]map[string]sink.Sink)}
+	for _, opt := range opts {
+		opt(w)
+	}
+	w.cfg.Tenants = append([]TenantConfig(nil), cfg.Tenants...)
+	// A validação compila as rotas; a cópia deixa o Config do chamador intacto
+	for i := range w.cfg.Tenants {
+		w.cfg.Tenants[i].Routes = append([]RouteConfig(nil), w.cfg.Tenants[i].Routes...)
+	}
+	if err := w.cfg.Validate(); err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool)
+	for i := range w.cfg.Tenants {
+		tc := &w.cfg.Tenants[i]
+		known[tc.Name] = true
+		tc.processors = w.processors
+		for _, d := range tc.allDestinations() {
+			if _, ok := w.sinks[tc.Name][d.Name]; ok {
+				continue
+			}
+			s, err := configuredSink(*tc, d)
+			if err != nil {
+				return nil, fmt.Errorf("tenant %s: destination %s: %w", tc.Name, d.Name, err)
+			}
+			if s != nil {
+				WithSink(tc.Name, d.Name, s)(w)
+			}
+		}
+		tc.sinks = w.sinks[tc.Name]
+		for name := range tc.sinks {
+			if _, ok := tc.findDestination(name); !ok {
+				return nil, fmt.Errorf("tenant %s: sink for unknown destination %q", tc.Name, name)
+			}
+		}
+		for _, d := range tc.allDestinations() {
+			if _, ok := tc.sinks[d.Name]; d.Type == destinationCustom && !ok {
+				return nil, fmt.Errorf("tenant %s: destination %s requires a sink", tc.Name, d.Name)
+			}
+		}
+	}
+	for tenant := range w.sinks {
+		if !known[tenant] {
+			return nil, fmt.Errorf("sink for unknown tenant %q", tenant)
+		}
+	}
+	return w, nil
+}
+
+// Sync concilia o watch_dir e os destinos de cada tenant com o banco,
+// entregando o que chegou com o serviço parado.
+func (w *Watcher) Sync() {
+	for _, tc := range w.cfg.Tenants {
+		if err := syncTenantDirs(w.db, tc); err != nil {
+			log.Printf("[Sync] Error syncing tenant %s: %v", tc.Name, err)
+		}
+	}
+}
+
+// Run observa todos os tenants até ctx ser cancelado.
+func (w *Watcher) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, tc := range w.cfg.Tenants {
+		wg.Add(1)
+		go watchTenant(ctx, tc, w.db, &wg, w.keepSource)
+	}
+	log.Println("Filewatcher started and running.")
+	wg.Wait()
+}
+
+// Close encerra as conexões mantidas pelos sinks (ex.: SFTP). O banco
+// continua aberto; ele pertence a quem chamou New.
+func (w *Watcher) Close() error {
+	var errs []error
+	for _, sinks := range w.sinks {
+		for _, s := range sinks {
+			if c, ok := s.(io.Closer); ok {
+				errs = append(errs, c.Close())
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// copyFile copia src para dst de forma atômica (temporário + rename),
+// verificando o conteúdo gravado.
+func copyFile(src, dst string) error {
+	_, err := sink.CopyFileWithChecksum(src, dst, "")
+	return err
+}
+
+// relPath retorna o caminho do arquivo relativo ao WatchDir do tenant.
+// Sem recursive, mantém o comportamento antigo (apenas o nome do arquivo).
+func relPath(tc TenantConfig, path string) string {
+	if tc.Recursive {
+		if rel, err := filepath.Rel(tc.WatchDir, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return rel
+		}
+	}
+	return filepath.Base(path)
+}
+
+// destPathFor espelha a estrutura relativa do WatchDir dentro do DestDir.
+func destPathFor(tc TenantConfig, path string) string {
+	return filepath.Join(tc.DestDir, relPath(tc, path))
+}
+
+// addWatchTree registra o diretório no watcher e, com recursive, todos os
+// subdiretórios existentes abaixo dele.
+func addWatchTree(watcher eventSource, tc TenantConfig, root string) error {
+	if !tc.Recursive {
+		return watcher.Add(root)
+	}
+	return filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			log.Printf("[%s] Skipping %s: %v", tc.Name, path, err)
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if err := watcher.Add(path); err != nil {
+			return err
+		}
+		if path != root {
+			log.Printf("[%s] Watching subdirectory: %s", tc.Name, path)
+		}
+		return nil
+	})
+}
+
+// listFiles retorna os arquivos de dir como caminhos relativos a ele.
+func listFiles(dir string, recursive bool) []string {
+	var files []string
+	if !recursive {
+		entries, _ := os.ReadDir(dir)
+		for _, f := range entries {
+			if !f.IsDir() {
+				files = append(files, f.Name())
+			}
+		}
+		return files
+	}
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if rel, err := filepath.Rel(dir, path); err == nil {
+			files = append(files, rel)
+		}
+		return nil
+	})
+	return files
+}
+
+// shouldReprocess decide se um arquivo já processado deve ser copiado de novo
+// conforme a política de eventos do tenant.
+func shouldReprocess(tc TenantConfig, prev *store.Processed, name string, op eventOp) bool {
+	switch op {
+	case evMovedTo:
+		return tc.Events.RenameAsArrival
+	case evWrite, evCloseWrite:
+		if !tc.Events.ReprocessOnWrite {
+			return false
+		}
+		fi, err := os.Stat(name)
+		if err != nil {
+			return false
+		}
+		return fi.Size() != prev.FileSize || fi.ModTime().UnixNano() != prev.SourceMtime
+	}
+	return false
+}
+
+// handleFile copia um arquivo detectado para o destino e registra no banco.
+// op indica como o arquivo chegou (evCreate também é usado na varredura).
+// Retorna errRetryLater quando o arquivo deve ser tentado de novo.
+func handleFile(ctx context.Context, db *sql.DB, tc TenantConfig, filter *fileFilter, name string, keepSource bool, op eventOp) error {
+	// A chegada do sentinela libera o arquivo de dados correspondente
+	if target, ok := sentinelTarget(tc, name); ok {
+		if !fileExists(target) {
+			return nil
+		}
+		name, op = target, evSentinel
+	}
+	if !filterFile(db, tc, filter, name) {
+		return nil
+	}
+	prev, err := store.GetProcessed(db, tc.Name, name)
+	if err != nil {
+		log.Printf("[%s] Error checking persistence: %v", tc.Name, err)
+		return nil
+	}
+	replace := false
+	mode := dedupeMode(tc)
+	if prev != nil && mode == dedupePath {
+		if !shouldReprocess(tc, prev, name, op) {
+			if op == evCreate {
+				log.Printf("[%s] File %s already processed. Skipping.", tc.Name, name)
+			} else {
+				debugf("[%s] File %s already processed, event ignored by policy.", tc.Name, name)
+			}
+			return nil
+		}
+		replace = true
+		log.Printf("[%s] File %s arrived again after processing. Reprocessing new version.", tc.Name, name)
+	} else if prev == nil && op == evWrite {
+		// Escrita em arquivo ainda não processado: o Create correspondente cuida dele
+		return nil
+	}
+	if err := waitReady(ctx, tc, name, op); err != nil {
+		if errors.Is(err, errNotReady) {
+			return handleNotReady(db, tc, name, err)
+		}
+		if ctx.Err() != nil {
+			log.Printf("[%s] Shutdown while waiting for %s. It will be handled on next start.", tc.Name, name)
+			return nil
+		}
+		log.Printf("[%s] File %s did not stabilize: %v", tc.Name, name, err)
+		return nil
+	}
+	fi, err := os.Stat(name)
+	if err != nil {
+		log.Printf("[%s] File %s disappeared before copy: %v", tc.Name, name, err)
+		return nil
+	}
+	// Nos modos por conteúdo a decisão depende do hash do arquivo pronto
+	if mode != dedupePath {
+		sum, err := sink.FileChecksum(name, tc.Checksum)
+		if err != nil {
+			log.Printf("[%s] Failed to hash %s: %v", tc.Name, name, err)
+			return nil
+		}
+		dup, err := findDuplicate(db, tc, prev, sum)
+		if err != nil {
+			log.Printf("[%s] Error checking duplicates: %v", tc.Name, err)
+			return nil
+		}
+		if dup != nil {
+			log.Printf("[%s] File %s has the same content as id %d (%s). Skipping (dedupe %s).", tc.Name, name, dup.ID, dup.File, mode)
+			if err := markDuplicate(db, tc, name, fi.Size(), sum, dup); err != nil {
+				log.Printf("[%s] Failed to record duplicate: %v", tc.Name, err)
+			}
+			removeSentinel(tc, name)
+			releaseSource(tc, name, keepSource)
+			return nil
+		}
+		replace = prev != nil
+		if replace {
+			log.Printf("[%s] File %s arrived again with different content. Reprocessing new version.", tc.Name, name)
+		}
+	}
+	if tc.Batch != nil {
+		return stageFile(db, tc, name, fi, prev, replace, keepSource)
+	}
+	if extractFormat(tc, name) != "" {
+		return extractFile(ctx, db, tc, name, fi, replace, keepSource)
+	}
+	results := deliverAll(ctx, db, tc, name, name, fi, keepSource)
+	primary, ok := requiredDelivered(results)
+	if !ok {
+		log.Printf("[%s] File %s was not delivered to every required destination. Source kept.", tc.Name, name)
+		return deliveryError(results)
+	}
+	rec := store.Processed{
+		Tenant:      tc.Name,
+		File:        name,
+		FileSize:    fi.Size(),
+		DestPath:    primary.DestPath,
+		SourceMtime: fi.ModTime().UnixNano(),
+		Checksum:    primary.Checksum,
+		Method:      primary.Method,
+		ETag:        primary.ETag,
+		StoredSize:  primary.StoredSize,
+		Compression: primary.Compression,
+		KeyID:       primary.KeyID,
+		Route:       primary.Route,
+	}
+	if err := store.SaveProcessed(db, rec, replace); err != nil {
+		log.Printf("[%s] Failed to mark file as processed: %v", tc.Name, err)
+	} else if err := saveDeliveries(db, tc.Name, name, results); err != nil {
+		log.Printf("[%s] Failed to record deliveries: %v", tc.Name, err)
+	}
+	removeSentinel(tc, name)
+	if !sourceMoved(results) {
+		releaseSource(tc, name, keepSource)
+	}
+	return nil
+}
+
+// releaseSource remove o arquivo de origem já entregue, a menos que
+// --keep-source tenha sido informado.
+func releaseSource(tc TenantConfig, name string, keepSource bool) {
+	if !keepSource {
+		if err := os.Remove(name); err != nil {
+			log.Printf("[%s] Failed to remove original file %s: %v", tc.Name, name, err)
+		} else {
+			log.Printf("[%s] Removed original file %s", tc.Name, name)
+		}
+	} else {
+		log.Printf("[%s] Source file kept as per --keep-source flag: %s", tc.Name, name)
+	}
+}
+
+// removeSentinel apaga o sentinela do arquivo processado, se configurado.
+func removeSentinel(tc TenantConfig, name string) {
+	if tc.Readiness.Strategy != readinessSentinel || !tc.Readiness.RemoveSentinel {
+		return
+	}
+	if sentinel, ok := findSentinel(tc, name); ok {
+		if err := os.Remove(sentinel); err != nil {
+			log.Printf("[%s] Failed to remove sentinel %s: %v", tc.Name, sentinel, err)
+		}
+	}
+}
+
+// Agora recebe context.Context para shutdown graceful!
+func watchTenant(ctx context.Context, tc TenantConfig, db *sql.DB, wg *sync.WaitGroup, keepSource bool) {
+	defer wg.Done()
+	if _, err := os.Stat(tc.WatchDir); os.IsNotExist(err) {
+		log.Printf("[%s] Watch dir does not exist: %s", tc.Name, tc.WatchDir)
+		return
+	}
+	filter, err := newFileFilter(tc)
+	if err != nil {
+		log.Printf("[%s] Invalid filter configuration: %v", tc.Name, err)
+		return
+	}
+	if tc.Readiness.Strategy == readinessLock && !lockChecksOpenFiles {
+		log.Printf("[%s] readiness lock on %s only waits for flock; writers that do not take the lock are not detected", tc.Name, runtime.GOOS)
+	}
+	watcher, err := newEventSource(tc)
+	if err != nil {
+		log.Printf("[%s] Failed to create watcher: %v", tc.Name, err)
+		return
+	}
+	defer watcher.Close()
+
+	if err := addWatchTree(watcher, tc, tc.WatchDir); err != nil {
+		log.Printf("[%s] Failed to add directory: %v", tc.Name, err)
+		return
+	}
+	// Diretórios observados, para saber o que remover quando forem apagados
+	watchedDirs := make(map[string]struct{})
+	for _, d := range watcher.WatchList() {
+		watchedDirs[d] = struct{}{}
+	}
+	closeWrite := watcher.reportsCloseWrite()
+
+	// Cópias rodam nos workers; o loop só recebe eventos e enfileira
+	ctx, cancel := context.WithCancel(ctx)
+	var pool *workerPool
+	pool = newWorkerPool(ctx, tc.Workers, func(ctx context.Context, job fileJob) {
+		err := handleFile(ctx, db, tc, filter, job.name, keepSource, job.op)
+		switch {
+		case errors.Is(err, errRetryLater):
+			pool.submitAfter(ctx, tc.Readiness.RetryAfter.or(time.Minute), fileJob{name: job.name, op: evCreate})
+		case errors.Is(err, errDeliveryFailed):
+			if _, err := scheduleRetry(db, tc, job.name, err); err != nil {
+				log.Printf("[%s] Failed to schedule retry for %s: %v", tc.Name, job.name, err)
+			}
+		case ctx.Err() == nil:
+			if err := completeJob(db, tc.Name, job.name); err != nil {
+				log.Printf("[%s] Failed to update job of %s: %v", tc.Name, job.name, err)
+			}
+		}
+	})
+	schedulerDone := make(chan struct{})
+	go func() {
+		defer close(schedulerDone)
+		runRetryScheduler(ctx, db, tc, pool)
+	}()
+	// Com window, o lote fecha por tempo mesmo sem novas chegadas
+	batchDone := make(chan struct{})
+	go func() {
+		defer close(batchDone)
+		if tc.Batch != nil && tc.Batch.Window > 0 {
+			runBatchTimer(ctx, db, tc)
+		}
+	}()
+	defer func() {
+		cancel()
+		pool.wait()
+		<-schedulerDone
+		<-batchDone
+	}()
+	process := func(name string, op eventOp) {
+		// Sentinela e arquivo de dados compartilham a mesma entrada na fila
+		if target, ok := sentinelTarget(tc, name); ok {
+			if !fileExists(target) {
+				return
+			}
+			name, op = target, evSentinel
+		}
+		pool.submit(ctx, fileJob{name: name, op: op})
+	}
+	log.Printf("[%s] Watching: %s", tc.Name, tc.WatchDir)
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf("[%s] Shutdown requested, watcher exiting.", tc.Name)
+			return
+		case event, ok := <-watcher.Events():
+			if !ok {
+				return
+			}
+			switch event.Op {
+			case evRemove, evRename:
+				if _, watched := watchedDirs[event.Name]; watched && event.Name != tc.WatchDir {
+					for d := range watchedDirs {
+						if d == event.Name || strings.HasPrefix(d, event.Name+string(os.PathSeparator)) {
+							watcher.Remove(d)
+							delete(watchedDirs, d)
+						}
+					}
+					log.Printf("[%s] Stopped watching removed directory: %s", tc.Name, event.Name)
+				}
+			case evCreate, evMovedTo:
+				fi, err := os.Stat(event.Name)
+				if err != nil {
+					continue
+				}
+				if fi.IsDir() {
+					if !tc.Recursive {
+						continue
+					}
+					if err := addWatchTree(watcher, tc, event.Name); err != nil {
+						log.Printf("[%s] Failed to add directory %s: %v", tc.Name, event.Name, err)
+						continue
+					}
+					for _, d := range watcher.WatchList() {
+						watchedDirs[d] = struct{}{}
+					}
+					// Arquivos criados antes do watch ser registrado
+					for _, rel := range listFiles(event.Name, true) {
+						process(filepath.Join(event.Name, rel), evCreate)
+					}
+					continue
+				}
+				// Com close_write o arquivo é tratado quando o writer o fecha
+				if event.Op == evCreate && closeWrite {
+					continue
+				}
+				process(event.Name, event.Op)
+			case evWrite, evCloseWrite:
+				if event.Op == evWrite && !tc.Events.ReprocessOnWrite {
+					continue
+				}
+				process(event.Name, event.Op)
+			}
+		case err, ok := <-watcher.Errors():
+			if !ok {
+				return
+			}
+			log.Printf("[%s] Watcher error: %v", tc.Name, err)
+		}
+	}
+}
+
+func fileExists(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && !fi.IsDir()
+}
@@ -0,0 +1,147 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/thiagozs/go-filewatcher/pkg/sink"
+	"github.com/thiagozs/go-filewatcher/pkg/store"
+)
+
+func customTenant(t *testing.T, name string) TenantConfig {
+	return TenantConfig{
+		Name:     name,
+		WatchDir: t.TempDir(),
+		Destinations: []DestinationConfig{
+			{Name: "archive", Path: t.TempDir()},
+			{Name: "remote", Type: destinationCustom},
+		},
+	}
+}
+
+func TestNewValidation(t *testing.T) {
+	db, err := initDB(t)
+	if err != nil {
+		t.Fatalf("erro ao iniciar db: %v", err)
+	}
+	defer db.Close()
+
+	noop := sink.SinkFunc(func(ctx context.Context, f sink.File) error { return nil })
+	cfg := &Config{Tenants: []TenantConfig{customTenant(t, "tenantNew")}}
+	cases := []struct {
+		name string
+		opts []Option
+	}{
+		{"destino custom sem sink", nil},
+		{"sink para destino desconhecido", []Option{WithSink("tenantNew", "remote", noop), WithSink("tenantNew", "nope", noop)}},
+		{"sink para tenant desconhecido", []Option{WithSink("tenantNew", "remote", noop), WithSink("outro", "remote", noop)}},
+	}
+	for _, c := range cases {
+		if _, err := New(cfg, db, c.opts...); err == nil {
+			t.Errorf("%s: esperado erro", c.name)
+		}
+	}
+	if _, err := New(cfg, db, WithSink("tenantNew", "remote", noop)); err != nil {
+		t.Errorf("config válida recusada: %v", err)
+	}
+	if cfg.Tenants[0].sinks != nil {
+		t.Errorf("New não deveria alterar o Config recebido")
+	}
+}
+
+func TestWatcherCustomSink(t *testing.T) {
+	db, err := initDB(t)
+	if err != nil {
+		t.Fatalf("erro ao iniciar db: %v", err)
+	}
+	defer db.Close()
+
+	tc := customTenant(t, "tenantCustomSink")
+	name := filepath.Join(tc.WatchDir, "nfe.xml")
+	os.WriteFile(name, []byte("<nfe/>"), 0644)
+
+	var got []string
+	remote := sink.SinkFunc(func(ctx context.Context, f sink.File) error {
+		data, err := os.ReadFile(f.Path)
+		if err != nil {
+			return err
+		}
+		got = append(got, f.RelPath+"="+string(data))
+		f.Record(sink.Receipt{Location: "mem://" + f.RelPath, Method: "memory"})
+		return nil
+	})
+	w, err := New(&Config{Tenants: []TenantConfig{tc}}, db, WithSink(tc.Name, "remote", remote))
+	if err != nil {
+		t.Fatalf("erro no New: %v", err)
+	}
+	w.Sync()
+
+	if len(got) != 1 || got[0] != "nfe.xml=<nfe/>" {
+		t.Errorf("sink recebeu %v", got)
+	}
+	if !fileExists(filepath.Join(tc.Destinations[0].Path, "nfe.xml")) {
+		t.Errorf("destino local também deveria receber o arquivo")
+	}
+	rec, _ := store.GetProcessed(db, tc.Name, name)
+	if rec == nil {
+		t.Fatalf("arquivo não registrado")
+	}
+	var location, method string
+	err = db.QueryRow("SELECT dest_path, transfer_method FROM deliveries WHERE processed_id = ? AND destination = 'remote'", rec.ID).Scan(&location, &method)
+	if err != nil {
+		t.Fatalf("entrega do sink não registrada: %v", err)
+	}
+	if location != "mem://nfe.xml" || method != "memory" {
+		t.Errorf("receipt não gravado: %s %s", location, method)
+	}
+}
+
+func TestWatcherProcessorVeto(t *testing.T) {
+	db, err := initDB(t)
+	if err != nil {
+		t.Fatalf("erro ao iniciar db: %v", err)
+	}
+	defer db.Close()
+
+	tc := TenantConfig{Name: "tenantProcessorVeto", WatchDir: t.TempDir(), DestDir: t.TempDir()}
+	empty := filepath.Join(tc.WatchDir, "vazio.xml")
+	full := filepath.Join(tc.WatchDir, "nfe.xml")
+	os.WriteFile(empty, nil, 0644)
+	os.WriteFile(full, []byte("<nfe/>"), 0644)
+
+	errVazio := errors.New("arquivo vazio")
+	var order []string
+	rejectEmpty := sink.ProcessorFunc(func(ctx context.Context, f sink.File, next sink.Sink) error {
+		order = append(order, "reject")
+		if f.Info.Size() == 0 {
+			return errVazio
+		}
+		return next.Deliver(ctx, f)
+	})
+	audit := sink.ProcessorFunc(func(ctx context.Context, f sink.File, next sink.Sink) error {
+		order = append(order, "audit")
+		return next.Deliver(ctx, f)
+	})
+	w, err := New(&Config{Tenants: []TenantConfig{tc}}, db, WithProcessors(rejectEmpty, audit))
+	if err != nil {
+		t.Fatalf("erro no New: %v", err)
+	}
+	w.Sync()
+
+	if !fileExists(filepath.Join(tc.DestDir, "nfe.xml")) {
+		t.Errorf("arquivo aceito pelos processadores deveria ser entregue")
+	}
+	if fileExists(filepath.Join(tc.DestDir, "vazio.xml")) {
+		t.Errorf("arquivo recusado não deveria ser entregue")
+	}
+	if rec, _ := store.GetProcessed(db, tc.Name, empty); rec != nil {
+		t.Errorf("arquivo recusado não deveria ser registrado")
+	}
+	// reject roda nos dois arquivos; audit só no aceito
+	if len(order) != 3 || order[0] != "reject" {
+		t.Errorf("ordem dos processadores incorreta: %v", order)
+	}
+}
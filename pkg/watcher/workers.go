@@ -0,0 +1,112 @@
+package watcher
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const defaultWorkers = 4
+
+type fileJob struct {
+	name string
+	op   eventOp
+}
+
+type inflightJob struct {
+	rerun bool    // chegou outro evento enquanto o arquivo estava na fila
+	op    eventOp // evento mais recente, usado na nova execução
+}
+
+// workerPool processa os arquivos de um tenant em paralelo. Um caminho que
+// já está na fila ou em processamento não é enfileirado de novo; o evento é
+// guardado e o arquivo é reavaliado quando o worker atual termina.
+type workerPool struct {
+	jobs   chan fileJob
+	handle func(context.Context, fileJob)
+
+	mu       sync.Mutex
+	inflight map[string]*inflightJob
+	wg       sync.WaitGroup
+}
+
+func newWorkerPool(ctx context.Context, workers int, handle func(context.Context, fileJob)) *workerPool {
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+	p := &workerPool{
+		jobs:     make(chan fileJob, workers*16),
+		handle:   handle,
+		inflight: make(map[string]*inflightJob),
+	}
+	for i := 0; i < workers; i++ {
+		p.wg.Add(1)
+		go p.work(ctx)
+	}
+	return p
+}
+
+func (p *workerPool) work(ctx context.Context) {
+	defer p.wg.Done()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-p.jobs:
+			p.handle(ctx, job)
+			p.finish(ctx, job)
+		}
+	}
+}
+
+// submit enfileira o arquivo, bloqueando enquanto a fila estiver cheia.
+func (p *workerPool) submit(ctx context.Context, job fileJob) {
+	if ctx.Err() != nil {
+		return
+	}
+	p.mu.Lock()
+	if e, ok := p.inflight[job.name]; ok {
+		e.rerun, e.op = true, job.op
+		p.mu.Unlock()
+		debugf("File %s already queued, coalescing event", job.name)
+		return
+	}
+	p.inflight[job.name] = &inflightJob{op: job.op}
+	p.mu.Unlock()
+	p.push(ctx, job)
+}
+
+// submitAfter enfileira o arquivo depois de d, se o contexto ainda estiver ativo.
+func (p *workerPool) submitAfter(ctx context.Context, d time.Duration, job fileJob) {
+	time.AfterFunc(d, func() { p.submit(ctx, job) })
+}
+
+func (p *workerPool) push(ctx context.Context, job fileJob) {
+	select {
+	case p.jobs <- job:
+	case <-ctx.Done():
+		p.mu.Lock()
+		delete(p.inflight, job.name)
+		p.mu.Unlock()
+	}
+}
+
+func (p *workerPool) finish(ctx context.Context, job fileJob) {
+	p.mu.Lock()
+	e := p.inflight[job.name]
+	if e == nil || !e.rerun {
+		delete(p.inflight, job.name)
+		p.mu.Unlock()
+		return
+	}
+	e.rerun = false
+	next := fileJob{name: job.name, op: e.op}
+	p.mu.Unlock()
+	// Em goroutine para não travar os workers com a fila cheia
+	go p.push(ctx, next)
+}
+
+// wait aguarda os workers terminarem após o cancelamento do contexto.
+func (p *workerPool) wait() {
+	p.wg.Wait()
+}
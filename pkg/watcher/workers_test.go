@@ -0,0 +1,96 @@
+package watcher
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWorkerPoolCoalescesInflight(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	release := make(chan struct{})
+	var calls int32
+	pool := newWorkerPool(ctx, 2, func(ctx context.Context, job fileJob) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+	})
+	pool.submit(ctx, fileJob{name: "/tmp/a.txt", op: evCreate})
+	time.Sleep(50 * time.Millisecond)
+	// Eventos repetidos enquanto o arquivo está em processamento
+	pool.submit(ctx, fileJob{name: "/tmp/a.txt", op: evWrite})
+	pool.submit(ctx, fileJob{name: "/tmp/a.txt", op: evWrite})
+	close(release)
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	pool.wait()
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("esperado 2 execuções (original + reavaliação), veio %d", got)
+	}
+}
+
+func TestWatcher_SlowFileDoesNotBlockOthers(t *testing.T) {
+	db, err := initDB(t)
+	if err != nil {
+		t.Fatalf("erro ao iniciar db: %v", err)
+	}
+	defer db.Close()
+
+	dirWatch := t.TempDir()
+	dirDest := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go watchTenant(ctx, TenantConfig{
+		Name:     "testWorkers",
+		WatchDir: dirWatch,
+		DestDir:  dirDest,
+		Workers:  2,
+	}, db, &wg, false)
+	time.Sleep(500 * time.Millisecond)
+
+	// Arquivo que nunca estabiliza enquanto o teste roda
+	slow := filepath.Join(dirWatch, "grande.bin")
+	stopWriting := make(chan struct{})
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+		f, err := os.Create(slow)
+		if err != nil {
+			return
+		}
+		defer f.Close()
+		for {
+			select {
+			case <-stopWriting:
+				return
+			case <-time.After(200 * time.Millisecond):
+				f.Write([]byte("bloco"))
+			}
+		}
+	}()
+	time.Sleep(200 * time.Millisecond)
+	os.WriteFile(filepath.Join(dirWatch, "pequeno.txt"), []byte("ok"), 0644)
+
+	copied := waitForContent(filepath.Join(dirDest, "pequeno.txt"), "ok", 8*time.Second)
+
+	start := time.Now()
+	cancel()
+	wg.Wait()
+	elapsed := time.Since(start)
+	close(stopWriting)
+	<-writerDone
+
+	if !copied {
+		t.Fatalf("arquivo pequeno bloqueado pelo arquivo lento")
+	}
+	if elapsed > 2*time.Second {
+		t.Errorf("shutdown demorou %v com worker aguardando estabilização", elapsed)
+	}
+	if fileExists(filepath.Join(dirDest, "grande.bin")) {
+		t.Errorf("arquivo ainda em escrita não deveria ter sido copiado")
+	}
+}